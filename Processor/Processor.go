@@ -2,7 +2,6 @@
 package Processor
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
@@ -10,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"net/http"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -22,10 +20,14 @@ import (
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/filter"
 	"github.com/hoshinonyaruko/gensokyo/handlers"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
 	"github.com/hoshinonyaruko/gensokyo/images"
+	"github.com/hoshinonyaruko/gensokyo/msgstore"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/registry"
+	"github.com/hoshinonyaruko/gensokyo/router"
 	"github.com/hoshinonyaruko/gensokyo/structs"
 	"github.com/hoshinonyaruko/gensokyo/wsclient"
 	"github.com/tencent-connect/botgo/dto"
@@ -35,11 +37,11 @@ import (
 
 // Processor 结构体用于处理消息
 type Processors struct {
-	Api             openapi.OpenAPI                   // API 类型
-	Apiv2           openapi.OpenAPI                   //群的API
-	Settings        *structs.Settings                 // 使用指针
-	Wsclient        []*wsclient.WebSocketClient       // 指针的切片
-	WsServerClients []callapi.WebSocketServerClienter //ws server被连接的客户端
+	Api             openapi.OpenAPI             // API 类型
+	Apiv2           openapi.OpenAPI             //群的API
+	Settings        *structs.Settings           // 使用指针
+	Wsclient        []*wsclient.WebSocketClient // 指针的切片
+	WsServerClients *registry.Registry          //ws server被连接的客户端
 }
 
 type Sender struct {
@@ -223,19 +225,21 @@ func structToMap(obj interface{}) map[string]interface{} {
 // 修改函数的返回类型为 *Processor
 func NewProcessor(api openapi.OpenAPI, apiv2 openapi.OpenAPI, settings *structs.Settings, wsclient []*wsclient.WebSocketClient) *Processors {
 	return &Processors{
-		Api:      api,
-		Apiv2:    apiv2,
-		Settings: settings,
-		Wsclient: wsclient,
+		Api:             api,
+		Apiv2:           apiv2,
+		Settings:        settings,
+		Wsclient:        wsclient,
+		WsServerClients: registry.Default,
 	}
 }
 
 // 修改函数的返回类型为 *Processor
 func NewProcessorV2(api openapi.OpenAPI, apiv2 openapi.OpenAPI, settings *structs.Settings) *Processors {
 	return &Processors{
-		Api:      api,
-		Apiv2:    apiv2,
-		Settings: settings,
+		Api:             api,
+		Apiv2:           apiv2,
+		Settings:        settings,
+		WsServerClients: registry.Default,
 	}
 }
 
@@ -243,7 +247,7 @@ func NewProcessorV2(api openapi.OpenAPI, apiv2 openapi.OpenAPI, settings *struct
 func (p *Processors) SendMessageToAllClients(message map[string]interface{}) error {
 	var result *multierror.Error
 
-	for _, client := range p.WsServerClients {
+	for _, client := range p.WsServerClients.Clients() {
 		// 使用接口的方法
 		err := client.SendMessage(message)
 		if err != nil {
@@ -258,18 +262,26 @@ func (p *Processors) SendMessageToAllClients(message map[string]interface{}) err
 
 // 方便快捷的发信息函数
 func (p *Processors) BroadcastMessageToAllFAF(message map[string]interface{}, api openapi.MessageAPI, data interface{}) error {
-	// 并发发送到我们作为客户端的Wsclient
-	for _, client := range p.Wsclient {
-		go func(c callapi.WebSocketServerClienter) {
-			_ = c.SendMessage(message) // 忽略错误
-		}(client)
+	// 储存信息 供get_msg使用
+	storeInboundMessage(message)
+	traceInboundMessage(message, data)
+
+	// 按路由规则计算需要接收事件的应用端,负载均衡池中只选择一个成员
+	route := router.Route(message)
+	singles, pools := router.Balance(p.eventTargets(message, route), message)
+
+	// 并发发送到正反向ws连接
+	for _, target := range singles {
+		go func(t router.Target) {
+			_ = t.Client.SendMessage(message) // 忽略错误
+		}(target)
 	}
 
-	// 并发发送到我们作为服务器连接到我们的WsServerClients
-	for _, serverClient := range p.WsServerClients {
-		go func(sc callapi.WebSocketServerClienter) {
-			_ = sc.SendMessage(message) // 忽略错误
-		}(serverClient)
+	// 负载均衡池失败时转移到下一个成员
+	for _, members := range pools {
+		go func(m []router.Target) {
+			_ = router.SendToPool(m, message) // 忽略错误
+		}(members)
 	}
 
 	// 不再等待所有 goroutine 完成，直接返回
@@ -278,30 +290,41 @@ func (p *Processors) BroadcastMessageToAllFAF(message map[string]interface{}, ap
 
 // 方便快捷的发信息函数
 func (p *Processors) BroadcastMessageToAll(message map[string]interface{}, api openapi.MessageAPI, data interface{}) error {
+	// 储存信息 供get_msg使用
+	storeInboundMessage(message)
+	traceInboundMessage(message, data)
+
+	// 按路由规则计算需要接收事件的应用端,负载均衡池中只选择一个成员
+	route := router.Route(message)
+	singles, pools := router.Balance(p.eventTargets(message, route), message)
+
+	// 被过滤规则或路由跳过的连接不计入发送尝试,每个负载均衡池计为一次尝试
+	attempted := len(singles) + len(pools)
+
 	var wg sync.WaitGroup
-	errorCh := make(chan string, len(p.Wsclient)+len(p.WsServerClients))
+	errorCh := make(chan string, attempted)
 	defer close(errorCh)
 
-	// 并发发送到我们作为客户端的Wsclient
-	for _, client := range p.Wsclient {
+	// 并发发送到正反向ws连接
+	for _, target := range singles {
 		wg.Add(1)
-		go func(c callapi.WebSocketServerClienter) {
+		go func(t router.Target) {
 			defer wg.Done()
-			if err := c.SendMessage(message); err != nil {
-				errorCh <- fmt.Sprintf("error sending message via wsclient: %v", err)
+			if err := t.Client.SendMessage(message); err != nil {
+				errorCh <- fmt.Sprintf("error sending message via %s: %v", t.Name, err)
 			}
-		}(client)
+		}(target)
 	}
 
-	// 并发发送到我们作为服务器连接到我们的WsServerClients
-	for _, serverClient := range p.WsServerClients {
+	// 负载均衡池失败时转移到下一个成员,全部成员都失败才视为失败
+	for _, members := range pools {
 		wg.Add(1)
-		go func(sc callapi.WebSocketServerClienter) {
+		go func(m []router.Target) {
 			defer wg.Done()
-			if err := sc.SendMessage(message); err != nil {
-				errorCh <- fmt.Sprintf("error sending message via WsServerClient: %v", err)
+			if err := router.SendToPool(m, message); err != nil {
+				errorCh <- fmt.Sprintf("error sending message via pool %s: %v", router.PoolOf(m[0].Name), err)
 			}
-		}(serverClient)
+		}(members)
 	}
 
 	wg.Wait() // 等待所有goroutine完成
@@ -317,7 +340,9 @@ func (p *Processors) BroadcastMessageToAll(message map[string]interface{}, api o
 	// 仅对连接正反ws的bot应用这个判断
 	if !p.Settings.HttpOnlyBot {
 		// 检查是否所有尝试都失败了
-		if failed == len(p.Wsclient)+len(p.WsServerClients) {
+		// 事件被所有连接过滤时不视为失败
+		total := len(p.Wsclient) + p.WsServerClients.Len()
+		if failed == attempted && (attempted > 0 || total == 0) {
 			// 处理全部失败的情况
 			fmt.Println("All ws event sending attempts failed.")
 			downtimemessgae := config.GetDowntimeMessage()
@@ -368,7 +393,7 @@ func (p *Processors) BroadcastMessageToAll(message map[string]interface{}, api o
 
 	// 判断是否填写了反向post地址
 	if !allEmpty(config.GetPostUrl()) {
-		go PostMessageToUrls(message)
+		go p.PostMessageToUrls(message, route)
 	}
 
 	if len(errors) > 0 {
@@ -378,80 +403,86 @@ func (p *Processors) BroadcastMessageToAll(message map[string]interface{}, api o
 	return nil
 }
 
-// allEmpty checks if all the strings in the slice are empty.
-func allEmpty(addresses []string) bool {
-	for _, addr := range addresses {
-		if addr != "" {
-			return false
-		}
+// storeInboundMessage 将message类型的事件写入msgstore
+func storeInboundMessage(message map[string]interface{}) {
+	if err := msgstore.StoreEvent(message); err != nil {
+		mylog.Printf("储存信息到msgstore失败: %v", err)
 	}
-	return true
 }
 
-// PostMessageToUrls 使用并发 goroutines 上报信息给多个反向 HTTP URL
-func PostMessageToUrls(message map[string]interface{}) {
-	// 获取上报 URL 列表
-	postUrls := config.GetPostUrl()
-
-	// 检查 postUrls 是否为空
-	if len(postUrls) == 0 {
-		return
+// traceInboundMessage 将事件的echo和message_id关联到触发它的网关事件的链路追踪ID,应用端据此调用action时沿用同一个ID
+func traceInboundMessage(message map[string]interface{}, data interface{}) {
+	var realID string
+	switch v := data.(type) {
+	case *dto.WSGroupATMessageData:
+		realID = v.ID
+	case *dto.WSATMessageData:
+		realID = v.ID
+	case *dto.WSMessageData:
+		realID = v.ID
+	case *dto.WSDirectMessageData:
+		realID = v.ID
+	case *dto.WSC2CMessageData:
+		realID = v.ID
 	}
-
-	// 转换 message 为 JSON 字符串
-	jsonString, err := handlers.ConvertMapToJSONString(message)
-	if err != nil {
-		mylog.Printf("Error converting message to JSON: %v", err)
+	traceID := mylog.TraceOf(realID)
+	if traceID == "" {
 		return
 	}
-
-	// 使用 WaitGroup 等待所有 goroutines 完成
-	var wg sync.WaitGroup
-	for _, url := range postUrls {
-		wg.Add(1)
-		// 启动一个 goroutine
-		go func(url string) {
-			defer wg.Done() // 确保减少 WaitGroup 的计数器
-			sendPostRequest(jsonString, url)
-		}(url)
+	if echostr, ok := message["echo"].(string); ok {
+		mylog.BindTrace(echostr, traceID)
 	}
-	wg.Wait() // 等待所有 goroutine 完成
+	messageID := msgstore.FormatMessageID(message["message_id"])
+	mylog.BindTrace(messageID, traceID)
+	// 应用端通常使用自己的echo回复,按会话关联最近一个事件,使send_group_msg等回复沿用同一个ID
+	groupID := msgstore.FormatMessageID(message["group_id"])
+	userID := msgstore.FormatMessageID(message["user_id"])
+	if groupID != "" {
+		mylog.BindTrace(mylog.ConversationKey("group", groupID), traceID)
+	} else {
+		mylog.BindTrace(mylog.ConversationKey("user", userID), traceID)
+	}
+	mylog.BindConversation(traceID, groupID, userID)
+	mylog.WithTrace(traceID).Printf("上报事件 post_type:%v message_type:%v message_id:%s", message["post_type"], message["message_type"], messageID)
 }
 
-// sendPostRequest 发送单个 POST 请求
-func sendPostRequest(jsonString, url string) {
-	// 创建请求体
-	reqBody := bytes.NewBufferString(jsonString)
-
-	// 创建 POST 请求
-	req, err := http.NewRequest("POST", url, reqBody)
-	if err != nil {
-		mylog.Printf("Error creating POST request to %s: %v", url, err)
-		return
+// eventTargets 返回按事件路由和各连接的事件过滤规则筛选后需要接收该事件的正反向ws连接
+func (p *Processors) eventTargets(message map[string]interface{}, route *router.Decision) []router.Target {
+	serverClients := p.WsServerClients.Clients()
+	clients := make([]callapi.WebSocketServerClienter, 0, len(p.Wsclient)+len(serverClients))
+	for _, client := range p.Wsclient {
+		clients = append(clients, client)
 	}
+	clients = append(clients, serverClients...)
 
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	// 设置 X-Self-ID
-	var selfid string
-	if config.GetUseUin() {
-		selfid = config.GetUinStr()
-	} else {
-		selfid = config.GetAppIDStr()
+	targets := make([]router.Target, 0, len(clients))
+	for _, client := range clients {
+		if r, ok := client.(callapi.EventReceiver); ok && !r.AcceptsEvents() {
+			continue
+		}
+		var name string
+		if b, ok := client.(callapi.Backender); ok {
+			name = b.BackendName()
+			if !route.Allows(name) {
+				continue
+			}
+		}
+		if f, ok := client.(callapi.EventFilterer); ok && !filter.Match(f.EventFilter(), message) {
+			continue
+		}
+		targets = append(targets, router.Target{Name: name, Client: client})
 	}
-	req.Header.Set("X-Self-ID", selfid)
+	return targets
+}
 
-	// 发送请求
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		mylog.Printf("Error sending POST request to %s: %v", url, err)
-		return
+// allEmpty checks if all the strings in the slice are empty.
+func allEmpty(addresses []string) bool {
+	for _, addr := range addresses {
+		if addr != "" {
+			return false
+		}
 	}
-	defer resp.Body.Close() // 确保释放网络资源
-
-	// 可以在此处添加更多的响应处理逻辑
-	mylog.Printf("Posted to %s successfully", url)
+	return true
 }
 
 func (p *Processors) HandleFrameworkCommand(messageText string, data interface{}, Type string) error {
@@ -0,0 +1,261 @@
+package Processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/filter"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
+	"github.com/hoshinonyaruko/gensokyo/msgstore"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/router"
+)
+
+// 未按顺序配置post_max_retries和post_retries_interval时的默认值,与配置模板一致
+const (
+	defaultPostMaxRetries      = 3
+	defaultPostRetriesInterval = 1500
+)
+
+// 重试间隔的上限
+const maxPostRetriesInterval = 30 * time.Second
+
+// 所有反向http上报共用的client,复用连接,超时时间按请求设置
+var postClient = &http.Client{}
+
+// PostMessageToUrls 使用并发 goroutines 上报信息给多个反向 HTTP URL,route为事件路由结果
+func (p *Processors) PostMessageToUrls(message map[string]interface{}, route *router.Decision) {
+	// 获取上报 URL 列表
+	postUrls := config.GetPostUrl()
+
+	// 检查 postUrls 是否为空
+	if len(postUrls) == 0 {
+		return
+	}
+
+	// 转换 message 为 JSON 字符串
+	jsonString, err := handlers.ConvertMapToJSONString(message)
+	if err != nil {
+		mylog.Printf("Error converting message to JSON: %v", err)
+		return
+	}
+
+	// 使用 WaitGroup 等待所有 goroutines 完成
+	var wg sync.WaitGroup
+	for index, url := range postUrls {
+		if url == "" || !route.Allows(url) || !filter.Match(config.GetPostFilter(index), message) {
+			continue
+		}
+		wg.Add(1)
+		// 启动一个 goroutine
+		go func(index int, url string) {
+			defer wg.Done() // 确保减少 WaitGroup 的计数器
+			body, err := sendPostRequest([]byte(jsonString), index, url)
+			if err != nil {
+				mylog.Printf("Error sending POST request to %s: %v", url, err)
+				return
+			}
+			// 应用端在响应中返回的快速操作
+			p.handleQuickOperation(message, body)
+		}(index, url)
+	}
+	wg.Wait() // 等待所有 goroutine 完成
+}
+
+// sendPostRequest 发送单个 POST 请求,失败时按post_max_retries重试,返回2xx响应的body
+func sendPostRequest(body []byte, index int, url string) ([]byte, error) {
+	maxRetries := configAt(config.GetPostMaxRetries(), index, defaultPostMaxRetries)
+	interval := time.Duration(configAt(config.GetPostRetriesInterval(), index, defaultPostRetriesInterval)) * time.Millisecond
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			// 指数退避,第一次重试等待post_retries_interval
+			wait := interval << (attempt - 1)
+			if wait > maxPostRetriesInterval || wait < 0 {
+				wait = maxPostRetriesInterval
+			}
+			mylog.Printf("POST to %s failed: %v, retrying(%d/%d) in %v", url, lastErr, attempt, maxRetries, wait)
+			time.Sleep(wait)
+		}
+
+		respBody, retry, err := postOnce(body, index, url)
+		if err == nil {
+			mylog.Printf("Posted to %s successfully", url)
+			return respBody, nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// postOnce 发送一次POST请求,返回响应body,以及失败时是否值得重试
+func postOnce(body []byte, index int, url string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postTimeout())
+	defer cancel()
+
+	// 创建 POST 请求
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 设置请求头
+	req.Header.Set("Content-Type", "application/json")
+	// 设置 X-Self-ID
+	var selfid string
+	if config.GetUseUin() {
+		selfid = config.GetUinStr()
+	} else {
+		selfid = config.GetAppIDStr()
+	}
+	req.Header.Set("X-Self-ID", selfid)
+	// 与go-cqhttp相同,使用post_secret对body签名
+	if secrets := config.GetPostSecret(); index < len(secrets) && secrets[index] != "" {
+		req.Header.Set("X-Signature", "sha1="+signBody(secrets[index], body))
+	}
+
+	// 发送请求
+	resp, err := postClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close() // 确保释放网络资源
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// 服务端错误可以重试,其余的状态码重试也不会成功
+		return nil, resp.StatusCode >= 500, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return respBody, false, nil
+}
+
+// signBody 计算X-Signature使用的HMAC-SHA1
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postTimeout 反向http的超时时间,http_timeout小于5秒时使用5秒
+func postTimeout() time.Duration {
+	timeout := config.GetHttpTimeOut()
+	if timeout < 5 {
+		timeout = 5
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// configAt 取出与post_url按顺序对应的配置,未配置时使用默认值
+func configAt(values []int, index int, def int) int {
+	if index < len(values) {
+		return values[index]
+	}
+	return def
+}
+
+// handleQuickOperation 将上报响应中的快速操作交给.handle_quick_operation执行
+func (p *Processors) handleQuickOperation(event map[string]interface{}, body []byte) {
+	if postType, _ := event["post_type"].(string); postType != "message" {
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return
+	}
+
+	var operation callapi.Operation
+	if err := json.Unmarshal(body, &operation); err != nil {
+		mylog.Printf("解析快速操作失败: %v, body: %s", err, string(body))
+		return
+	}
+	if !operation.Delete && !operation.Ban && operation.Reply == nil {
+		return
+	}
+
+	msgContext, err := quickOperationContext(event)
+	if err != nil {
+		mylog.Printf("构造快速操作的context失败,已忽略快速操作: %v", err)
+		return
+	}
+
+	message := callapi.ActionMessage{
+		Action: ".handle_quick_operation",
+		Params: callapi.ParamsContent{
+			Context:   msgContext,
+			Operation: operation,
+		},
+		TraceID: mylog.TraceOf(msgstore.FormatMessageID(event["message_id"])),
+	}
+	callapi.CallAPIFromDict(&callapi.CaptureClient{}, p.Api, p.Apiv2, message)
+}
+
+// quickOperationContext 从上报的事件构造快速操作的context,id不是数字时返回错误
+func quickOperationContext(event map[string]interface{}) (callapi.Context, error) {
+	postType, _ := event["post_type"].(string)
+	messageType, _ := event["message_type"].(string)
+	subType, _ := event["sub_type"].(string)
+	msgContext := callapi.Context{
+		MessageType: messageType,
+		PostType:    postType,
+		SubType:     subType,
+	}
+	var err error
+	if msgContext.MessageID, err = toInt(event["message_id"]); err != nil {
+		return msgContext, fmt.Errorf("message_id: %v", err)
+	}
+	if msgContext.UserID, err = toInt(event["user_id"]); err != nil {
+		return msgContext, fmt.Errorf("user_id: %v", err)
+	}
+	if msgContext.GroupID, err = toInt(event["group_id"]); err != nil {
+		return msgContext, fmt.Errorf("group_id: %v", err)
+	}
+	eventTime, err := toInt(event["time"])
+	if err != nil {
+		return msgContext, fmt.Errorf("time: %v", err)
+	}
+	msgContext.Time = int64(eventTime)
+	return msgContext, nil
+}
+
+// toInt 将事件中的id转换为int,兼容string_ob11,字段不存在时为0
+func toInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return n, nil
+	case int32:
+		return int(n), nil
+	case int64:
+		return int(n), nil
+	case uint64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		if n == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(n)
+	}
+	return 0, fmt.Errorf("unsupported type %T", v)
+}
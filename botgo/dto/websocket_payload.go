@@ -9,6 +9,9 @@ type WSPayload struct {
 	Data       interface{} `json:"d,omitempty"`
 	S          int64       `json:"s,omitempty"`
 	RawMessage []byte      `json:"-"` // 原始的 message 数据
+	TraceID    string      `json:"-"` // [新增] 收到事件时生成的链路追踪ID
+	Ordered    bool        `json:"-"` // [新增] 由webhook worker按会话顺序投递,handler需同步处理以保持顺序
+	Shard      uint32      `json:"-"` // [新增] 收到事件的网关分片,webhook事件为0
 }
 
 // WSPayloadBase 基础消息结构，排除了 data
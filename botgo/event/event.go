@@ -2,34 +2,20 @@ package event
 
 import (
 	"encoding/json"
-	"sync"
-	"time"
 
 	"github.com/tidwall/gjson" // 由于回包的 d 类型不确定，gjson 用于从回包json中提取 d 并进行针对性的解析
 
 	"github.com/tencent-connect/botgo/dto"
 )
 
-func init() {
-	// Start a goroutine for periodic cleaning
-	go cleanProcessedIDs()
-}
-
-func cleanProcessedIDs() {
-	ticker := time.NewTicker(5 * time.Minute) // Adjust the interval as needed
-	defer ticker.Stop()
+// duplicateFilter 重复事件检查，返回 true 时丢弃该事件，webhook 与 websocket 收到的事件都经过这里 [新增]
+var duplicateFilter func(payload *dto.WSPayload) bool
 
-	for range ticker.C {
-		// Clean processedIDs, remove entries which are no longer needed
-		processedIDs.Range(func(key, value interface{}) bool {
-			processedIDs.Delete(key)
-			return true
-		})
-	}
+// RegisterDuplicateFilter 注册重复事件检查 [新增]
+func RegisterDuplicateFilter(filter func(payload *dto.WSPayload) bool) {
+	duplicateFilter = filter
 }
 
-var processedIDs sync.Map
-
 var eventParseFuncMap = map[dto.OPCode]map[dto.EventType]eventParseFunc{
 	dto.WSDispatchEvent: {
 		dto.EventGuildCreate: guildHandler,
@@ -93,6 +79,10 @@ type eventParseFunc func(event *dto.WSPayload, message []byte) error
 
 // ParseAndHandle 处理回调事件
 func ParseAndHandle(payload *dto.WSPayload) error {
+	// [新增] 丢弃在时间窗口内重复收到的事件
+	if duplicateFilter != nil && duplicateFilter(payload) {
+		return nil
+	}
 	// 指定类型的 handler
 	if h, ok := eventParseFuncMap[payload.OPCode][payload.Type]; ok {
 		return h(payload, payload.RawMessage)
@@ -275,9 +265,6 @@ func groupAtMessageHandler(payload *dto.WSPayload, message []byte) error {
 	if err := ParseData(message, data); err != nil {
 		return err
 	}
-	if _, loaded := processedIDs.LoadOrStore(data.ID, struct{}{}); loaded {
-		return nil
-	}
 	if DefaultHandlers.GroupATMessage != nil {
 		return DefaultHandlers.GroupATMessage(payload, data)
 	}
@@ -9,6 +9,8 @@ var DefaultHandlers struct {
 	Ready       ReadyHandler
 	ErrorNotify ErrorNotifyHandler
 	Plain       PlainEventHandler
+	// [新增] 收到任意网关事件时回调,用于统计事件数和会话状态
+	Received ReceivedHandler
 
 	Guild       GuildEventHandler
 	GuildMember GuildMemberEventHandler
@@ -53,6 +55,23 @@ type ReadyHandler func(event *dto.WSPayload, data *dto.WSReadyData)
 // 比如 reconnect invalidSession 等错误，错误可以转换为 bot.Err
 type ErrorNotifyHandler func(err error)
 
+// ShardError ErrorNotify 回调的错误，携带出错连接的分片，可通过 errors.As 取出，Unwrap 为原始错误 [新增]
+type ShardError struct {
+	ShardID uint32
+	Err     error
+}
+
+func (e *ShardError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+// ReceivedHandler 收到网关的事件(包括READY和RESUMED)时回调,在具体的handler之前执行
+type ReceivedHandler func(event *dto.WSPayload)
+
 // PlainEventHandler 透传handler
 type PlainEventHandler func(event *dto.WSPayload, message []byte) error
 
@@ -156,6 +175,8 @@ func RegisterHandlers(handlers ...interface{}) dto.Intent {
 			DefaultHandlers.ErrorNotify = handle
 		case PlainEventHandler:
 			DefaultHandlers.Plain = handle
+		case ReceivedHandler:
+			DefaultHandlers.Received = handle
 		case AudioEventHandler:
 			DefaultHandlers.Audio = handle
 			i = i | dto.EventToIntent(
@@ -10,6 +10,7 @@ require (
 	github.com/hoshinonyaruko/gensokyo v0.0.0-20240524044114-62dbc304940b
 	github.com/stretchr/testify v1.9.0
 	github.com/tidwall/gjson v1.9.3
+	go.etcd.io/bbolt v1.3.9
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -98,7 +99,6 @@ require (
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	github.com/yuin/goldmark v1.4.13 // indirect
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
-	go.etcd.io/bbolt v1.3.9 // indirect
 	go.etcd.io/gofail v0.1.0 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	golang.org/x/arch v0.3.0 // indirect
@@ -3,6 +3,7 @@ package openapi
 import (
 	"net/http"
 	"sync"
+	"time"
 )
 
 // 提供一组过滤器支持，开发者可以通过请求过滤器和返回过滤器，实现模调上报，耗时监控等能力。
@@ -65,3 +66,25 @@ func DoRespFilterChains(req *http.Request, resp *http.Response) error {
 	}
 	return nil
 }
+
+// ResultHook 请求结束后的回调,statusCode为0表示请求没有得到响应,用于统计耗时和错误码
+type ResultHook func(req *http.Request, statusCode int, body []byte, latency time.Duration)
+
+var resultHooks []ResultHook
+
+// RegisterResultHook 注册请求结束后的回调
+func RegisterResultHook(hook ResultHook) {
+	filterLock.Lock()
+	defer filterLock.Unlock()
+	resultHooks = append(resultHooks, hook)
+}
+
+// DoResultHooks 按照注册顺序执行请求结束后的回调
+func DoResultHooks(req *http.Request, statusCode int, body []byte, latency time.Duration) {
+	filterLock.RLock()
+	hooks := resultHooks
+	filterLock.RUnlock()
+	for _, hook := range hooks {
+		hook(req, statusCode, body, latency)
+	}
+}
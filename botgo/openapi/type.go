@@ -1,4 +1,26 @@
 package openapi
 
+import "context"
+
 // TraceIDKey 机器人openapi返回的链路追踪ID
 const TraceIDKey = "X-Tps-trace-ID"
+
+// [新增] 调用方的链路追踪ID在context中的key
+type requestTraceKey struct{}
+
+// WithRequestTraceID 在context中携带调用方的链路追踪ID,过滤器可通过 RequestTraceID 从请求中取出
+func WithRequestTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestTraceKey{}, traceID)
+}
+
+// RequestTraceID 获取context中调用方的链路追踪ID,不存在时返回空
+func RequestTraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	traceID, _ := ctx.Value(requestTraceKey{}).(string)
+	return traceID
+}
@@ -4,6 +4,7 @@ package v1
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -105,6 +106,7 @@ func (o *openAPI) setupClient() {
 		OnAfterResponse(
 			func(client *resty.Client, resp *resty.Response) error {
 				log.Infof("%v", respInfo(resp))
+				openapi.DoResultHooks(resp.Request.RawRequest, resp.StatusCode(), resp.Body(), resp.Time())
 				// 执行请求后过滤器
 				if err := openapi.DoRespFilterChains(resp.Request.RawRequest, resp.RawResponse); err != nil {
 					return err
@@ -117,6 +119,16 @@ func (o *openAPI) setupClient() {
 				}
 				return nil
 			},
+		).
+		// 没有得到响应的请求(如超时),有响应的请求已在OnAfterResponse中回调
+		OnError(
+			func(req *resty.Request, err error) {
+				var respErr *resty.ResponseError
+				if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.RawResponse != nil {
+					return
+				}
+				openapi.DoResultHooks(req.RawRequest, 0, nil, time.Since(req.Time))
+			},
 		)
 }
 
@@ -3,6 +3,7 @@ package v2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -101,6 +102,7 @@ func (o *openAPIv2) setupClient() {
 		OnAfterResponse(
 			func(client *resty.Client, resp *resty.Response) error {
 				log.Infof("%v", respInfo(resp))
+				openapi.DoResultHooks(resp.Request.RawRequest, resp.StatusCode(), resp.Body(), resp.Time())
 				// 执行请求后过滤器
 				if err := openapi.DoRespFilterChains(resp.Request.RawRequest, resp.RawResponse); err != nil {
 					return err
@@ -113,6 +115,16 @@ func (o *openAPIv2) setupClient() {
 				}
 				return nil
 			},
+		).
+		// 没有得到响应的请求(如超时),有响应的请求已在OnAfterResponse中回调
+		OnError(
+			func(req *resty.Request, err error) {
+				var respErr *resty.ResponseError
+				if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.RawResponse != nil {
+					return
+				}
+				openapi.DoResultHooks(req.RawRequest, 0, nil, time.Since(req.Time))
+			},
 		)
 }
 
@@ -46,6 +46,8 @@ func (l *ChanManager) Start(apInfo *dto.WebsocketAP, token *token.Token, intents
 				ShardCount: apInfo.Shards,
 			},
 		}
+		// [新增] 恢复上次运行保存的 session，恢复成功时将执行 resume
+		websocket.RestoreSession(&session)
 		l.sessionChan <- session
 	}
 
@@ -81,6 +83,8 @@ func (l *ChanManager) StartSingle(apInfo *dto.WebsocketAPSingle, token *token.To
 			ShardCount: apInfo.ShardCount,
 		},
 	}
+	// [新增] 恢复上次运行保存的 session，恢复成功时将执行 resume
+	websocket.RestoreSession(&session)
 	l.sessionChan <- session
 
 	for session := range l.sessionChan {
@@ -129,6 +133,7 @@ func (l *ChanManager) newConnect(session dto.Session) {
 		if manager.CanNotResume(err) {
 			currentSession.ID = ""
 			currentSession.LastSeq = 0
+			websocket.ClearSession(currentSession) // [新增]
 		}
 		// 一些错误不能够鉴权，比如机器人被封禁，这里就直接退出了
 		if manager.CanNotIdentify(err) {
@@ -61,6 +61,8 @@ func (sm *ShardManager) StartShard(shardID uint32) {
 				ShardCount: sm.APInfo.Shards,
 			},
 		}
+		// [新增] 恢复上次运行保存的 session，恢复成功时将执行 resume
+		websocket.RestoreSession(&session)
 		sm.Sessions[shardID] = session
 		sm.SessionChans[shardID] <- session
 
@@ -99,6 +101,7 @@ func (sm *ShardManager) newConnect(session dto.Session, shardID uint32) {
 		if manager.CanNotResume(err) {
 			currentSession.ID = ""
 			currentSession.LastSeq = 0
+			websocket.ClearSession(currentSession) // [新增]
 		}
 		// 一些错误不能够鉴权，比如机器人被封禁，这里就直接退出了
 		if manager.CanNotIdentify(err) {
@@ -0,0 +1,440 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/log"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+// [新增] 基于租约的分布式 session manager
+// 每个实例定期在协调后端续期自己持有的分片租约，并按存活实例数平分分片
+// 实例退出或失联后租约过期，其他实例在下一轮检查时接管这些分片
+
+// defaultLeaseTTL 租约的默认有效期，每 1/3 有效期续期一次
+const defaultLeaseTTL = 30 * time.Second
+
+// Backend 分片租约的协调后端 [新增]
+type Backend interface {
+	// Acquire 租约不存在、已过期或已属于 owner 时获取或续期租约，返回是否持有租约
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// Release 释放属于 owner 的租约
+	Release(ctx context.Context, key, owner string) error
+	// Holders 返回 key 以 prefix 开头且未过期的租约，key => owner
+	Holders(ctx context.Context, prefix string) (map[string]string, error)
+}
+
+// LeaseOption 配置 LeaseManager [新增]
+type LeaseOption func(m *LeaseManager)
+
+// WithLeaseClusterKey 自定义集群 key，作为租约 key 的前缀，不同机器人需要使用不同的 key
+func WithLeaseClusterKey(key string) LeaseOption {
+	return func(m *LeaseManager) {
+		m.clusterKey = key
+	}
+}
+
+// WithLeaseTTL 自定义租约有效期，实例失联后超过这个时间分片才会被接管
+func WithLeaseTTL(ttl time.Duration) LeaseOption {
+	return func(m *LeaseManager) {
+		if ttl > 0 {
+			m.ttl = ttl
+		}
+	}
+}
+
+// WithLeaseOwner 自定义实例标识，默认为 主机名-pid-随机串
+func WithLeaseOwner(owner string) LeaseOption {
+	return func(m *LeaseManager) {
+		if owner != "" {
+			m.owner = owner
+		}
+	}
+}
+
+// LeaseManager 通过协调后端自动分配分片的 session 管理器 [新增]
+type LeaseManager struct {
+	backend    Backend
+	clusterKey string
+	owner      string
+	ttl        time.Duration
+
+	mu         sync.Mutex
+	shardCount uint32
+	shards     map[uint32]*leasedShard
+	standby    bool // 上一轮检查时没有持有分片，且所有分片都由其他实例持有
+	stopped    bool
+	stop       chan struct{}
+}
+
+// leasedShard 当前实例持有租约并正在连接的分片
+type leasedShard struct {
+	cancel    context.CancelFunc
+	done      chan struct{}
+	lastRenew time.Time
+}
+
+// NewLeaseManager 创建基于租约的 session 管理器 [新增]
+func NewLeaseManager(backend Backend, opts ...LeaseOption) *LeaseManager {
+	hostname, _ := os.Hostname()
+	m := &LeaseManager{
+		backend:    backend,
+		clusterKey: defaultClusterKey,
+		owner:      fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+		ttl:        defaultLeaseTTL,
+		shards:     make(map[uint32]*leasedShard),
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Owner 当前实例的标识
+func (m *LeaseManager) Owner() string {
+	return m.owner
+}
+
+// Shards 当前实例持有的分片
+func (m *LeaseManager) Shards() []uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]uint32, 0, len(m.shards))
+	for id := range m.shards {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Standby 当前实例是否为备用实例：不持有分片，所有分片都由其他存活实例持有，其他实例失联后接管 [新增]
+func (m *LeaseManager) Standby() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.standby && len(m.shards) == 0
+}
+
+func (m *LeaseManager) setStandby(standby bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.standby = standby
+}
+
+// Start 按 apInfo 中的 shards 数量分配分片，阻塞直到 Close
+func (m *LeaseManager) Start(apInfo *dto.WebsocketAP, token *token.Token, intents *dto.Intent) error {
+	return m.run(apInfo.URL, apInfo.Shards, apInfo.SessionStartLimit, token, intents)
+}
+
+// StartSingle 按 apInfo 中的 ShardCount 分配分片，ShardID 由协调后端决定，阻塞直到 Close
+func (m *LeaseManager) StartSingle(apInfo *dto.WebsocketAPSingle, token *token.Token, intents *dto.Intent) error {
+	return m.run(apInfo.URL, apInfo.ShardCount, apInfo.SessionStartLimit, token, intents)
+}
+
+// Close 停止所有连接并释放租约，其他实例可以立即接管
+func (m *LeaseManager) Close() {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	m.stopped = true
+	close(m.stop)
+	ids := make([]uint32, 0, len(m.shards))
+	for id := range m.shards {
+		ids = append(ids, id)
+	}
+	shardCount := m.shardCount
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range ids {
+		m.stopShard(id)
+		if err := m.backend.Release(ctx, m.shardKey(id, shardCount), m.owner); err != nil {
+			log.Errorf("[ws/session/lease] release shard %d failed: %v", id, err)
+		}
+	}
+	if err := m.backend.Release(ctx, m.memberKey(m.owner), m.owner); err != nil {
+		log.Errorf("[ws/session/lease] release member lease failed: %v", err)
+	}
+}
+
+func (m *LeaseManager) memberPrefix() string {
+	return m.clusterKey + "_member_"
+}
+
+func (m *LeaseManager) memberKey(owner string) string {
+	return m.memberPrefix() + owner
+}
+
+func (m *LeaseManager) shardPrefix(shardCount uint32) string {
+	return fmt.Sprintf("%s_lease_%d_", m.clusterKey, shardCount)
+}
+
+func (m *LeaseManager) shardKey(shardID, shardCount uint32) string {
+	return fmt.Sprintf("%s%d", m.shardPrefix(shardCount), shardID)
+}
+
+func (m *LeaseManager) run(url string, shardCount uint32, limit dto.SessionStartLimit, token *token.Token,
+	intents *dto.Intent) error {
+	defer log.Sync()
+	if shardCount == 0 {
+		shardCount = 1
+	}
+	if shardCount > limit.Remaining {
+		log.Errorf("[ws/session/lease] session limited, shards: %d, limit: %+v", shardCount, limit)
+		return errs.ErrSessionLimit
+	}
+	m.mu.Lock()
+	m.shardCount = shardCount
+	m.mu.Unlock()
+	startInterval := manager.CalcInterval(limit.MaxConcurrency)
+	log.Infof("[ws/session/lease] instance %s joined cluster %s, %d shards, lease ttl %s",
+		m.owner, m.clusterKey, shardCount, m.ttl)
+
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	for {
+		m.balance(url, shardCount, startInterval, token, intents)
+		select {
+		case <-m.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// balance 续期持有的租约，按存活实例数释放多出的分片或接管无人持有的分片
+func (m *LeaseManager) balance(url string, shardCount uint32, startInterval time.Duration, token *token.Token,
+	intents *dto.Intent) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.ttl/3)
+	defer cancel()
+
+	if _, err := m.backend.Acquire(ctx, m.memberKey(m.owner), m.owner, m.ttl); err != nil {
+		log.Errorf("[ws/session/lease] renew member lease failed: %v", err)
+	}
+	m.renewShards(ctx, shardCount)
+
+	members, err := m.backend.Holders(ctx, m.memberPrefix())
+	if err != nil {
+		log.Errorf("[ws/session/lease] list members failed: %v", err)
+		m.setStandby(false)
+		return
+	}
+	holders, err := m.backend.Holders(ctx, m.shardPrefix(shardCount))
+	if err != nil {
+		log.Errorf("[ws/session/lease] list shard leases failed: %v", err)
+		m.setStandby(false)
+		return
+	}
+	heldByOthers := 0
+	for _, owner := range holders {
+		if owner != m.owner {
+			heldByOthers++
+		}
+	}
+	memberCount := uint32(len(members))
+	if _, ok := members[m.memberKey(m.owner)]; !ok {
+		memberCount++
+	}
+	fair := int((shardCount + memberCount - 1) / memberCount)
+
+	owned := m.Shards()
+	defer func() {
+		m.setStandby(len(owned) == 0 && heldByOthers >= int(shardCount))
+	}()
+	if len(owned) > fair {
+		// 每轮只释放一个分片，给新加入的实例接管的时间
+		id := owned[len(owned)-1]
+		log.Infof("[ws/session/lease] holding %d shards, fair share is %d, release shard %d", len(owned), fair, id)
+		m.stopShard(id)
+		if err := m.backend.Release(ctx, m.shardKey(id, shardCount), m.owner); err != nil {
+			log.Errorf("[ws/session/lease] release shard %d failed: %v", id, err)
+		}
+		return
+	}
+
+	started := 0
+	for id := uint32(0); id < shardCount && len(owned) < fair; id++ {
+		key := m.shardKey(id, shardCount)
+		if owner, ok := holders[key]; ok && owner != m.owner {
+			continue
+		}
+		if m.holding(id) {
+			continue
+		}
+		ok, err := m.backend.Acquire(ctx, key, m.owner, m.ttl)
+		if err != nil {
+			log.Errorf("[ws/session/lease] acquire shard %d failed: %v", id, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		log.Infof("[ws/session/lease] acquired shard %d/%d", id, shardCount)
+		session := dto.Session{
+			URL:    url,
+			Token:  *token,
+			Intent: *intents,
+			Shards: dto.ShardConfig{
+				ShardID:    id,
+				ShardCount: shardCount,
+			},
+		}
+		// 同一轮接管的分片依次间隔启动，避免触发服务端的并发控制，续期不需要等待连接
+		if !m.startShard(session, startInterval, time.Duration(started)*startInterval) {
+			// 已经 Close，释放刚获取的租约
+			if err := m.backend.Release(ctx, key, m.owner); err != nil {
+				log.Errorf("[ws/session/lease] release shard %d failed: %v", id, err)
+			}
+			return
+		}
+		owned = append(owned, id)
+		started++
+	}
+}
+
+// renewShards 续期持有的分片，租约被其他实例持有或长时间续期失败时断开分片，避免同一分片被两个实例连接
+func (m *LeaseManager) renewShards(ctx context.Context, shardCount uint32) {
+	for _, id := range m.Shards() {
+		ok, err := m.backend.Acquire(ctx, m.shardKey(id, shardCount), m.owner, m.ttl)
+		m.mu.Lock()
+		shard, exists := m.shards[id]
+		if exists && err == nil && ok {
+			shard.lastRenew = time.Now()
+		}
+		lost := exists && ((err == nil && !ok) || time.Since(shard.lastRenew) > m.ttl*2/3)
+		m.mu.Unlock()
+		if err != nil {
+			log.Errorf("[ws/session/lease] renew shard %d failed: %v", id, err)
+		}
+		if lost {
+			log.Errorf("[ws/session/lease] lost lease of shard %d, disconnect", id)
+			m.stopShard(id)
+		}
+	}
+}
+
+func (m *LeaseManager) holding(id uint32) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.shards[id]
+	return ok
+}
+
+// startShard 启动分片的连接，已经 Close 时返回 false
+func (m *LeaseManager) startShard(session dto.Session, startInterval, delay time.Duration) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	shard := &leasedShard{cancel: cancel, done: make(chan struct{}), lastRenew: time.Now()}
+	m.mu.Lock()
+	if m.stopped {
+		// Close 之后不再启动新的分片
+		m.mu.Unlock()
+		cancel()
+		return false
+	}
+	m.shards[session.Shards.ShardID] = shard
+	m.mu.Unlock()
+
+	go func() {
+		defer close(shard.done)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		m.connectLoop(ctx, session, startInterval)
+	}()
+	return true
+}
+
+func (m *LeaseManager) stopShard(id uint32) {
+	m.mu.Lock()
+	shard, ok := m.shards[id]
+	delete(m.shards, id)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	shard.cancel()
+	<-shard.done
+}
+
+// connectLoop 持有租约期间保持分片的连接，断开后 resume 或 identify，ctx 取消时断开并退出
+func (m *LeaseManager) connectLoop(ctx context.Context, session dto.Session, startInterval time.Duration) {
+	// 同一台机器上接管分片时，可以 resume 上次保存的 session
+	websocket.RestoreSession(&session)
+	for ctx.Err() == nil {
+		session = m.connect(ctx, session)
+		select {
+		case <-ctx.Done():
+		case <-time.After(startInterval):
+		}
+	}
+}
+
+func (m *LeaseManager) connect(ctx context.Context, session dto.Session) (next dto.Session) {
+	defer func() {
+		// panic 留下日志，下一轮重连
+		if err := recover(); err != nil {
+			websocket.PanicHandler(err, &session)
+			next = session
+		}
+	}()
+	wsClient := websocket.ClientImpl.New(session)
+	if err := wsClient.Connect(); err != nil {
+		log.Error(err)
+		return session
+	}
+	// 租约丢失时关闭连接，Listening 随之退出
+	listening := make(chan struct{})
+	defer close(listening)
+	go func() {
+		select {
+		case <-ctx.Done():
+			wsClient.Close()
+		case <-listening:
+		}
+	}()
+
+	var err error
+	// 如果 session id 不为空，则执行的是 resume 操作，如果为空，则执行的是 identify 操作
+	if session.ID != "" {
+		err = wsClient.Resume()
+	} else {
+		err = wsClient.Identify()
+	}
+	if err != nil {
+		log.Errorf("[ws/session/lease] Identify/Resume err %+v", err)
+		return session
+	}
+	if err := wsClient.Listening(); err != nil {
+		log.Errorf("[ws/session/lease] Listening err %+v", err)
+		currentSession := wsClient.Session()
+		// 对于不能够进行重连的session，需要清空 session id 与 seq
+		if manager.CanNotResume(err) {
+			currentSession.ID = ""
+			currentSession.LastSeq = 0
+			websocket.ClearSession(currentSession)
+		}
+		// 一些错误不能够鉴权，比如机器人被封禁，这里就直接退出了
+		if manager.CanNotIdentify(err) {
+			msg := fmt.Sprintf("can not identify because server return %+v, so process exit", err)
+			log.Errorf(msg)
+			panic(msg) // 当机器人被下架，或者封禁，将不能再连接，所以 panic
+		}
+		return *currentSession
+	}
+	return *wsClient.Session()
+}
@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// leaseBucket 保存租约的 bucket
+const leaseBucket = "leases"
+
+// BoltBackend 基于 bbolt 文件锁的分片租约，适合同一台机器上运行多个实例 [新增]
+// 每次操作时打开数据库，bbolt 的文件锁保证同一时间只有一个进程读写，操作完成后立即关闭
+type BoltBackend struct {
+	path    string
+	timeout time.Duration
+}
+
+// NewBoltBackend 创建基于 bbolt 的分片租约后端，path 为各实例共用的数据库文件 [新增]
+func NewBoltBackend(path string) *BoltBackend {
+	return &BoltBackend{path: path, timeout: 5 * time.Second}
+}
+
+type boltLease struct {
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expires_at"` // unix 毫秒
+}
+
+func (b *BoltBackend) update(ctx context.Context, fn func(bucket *bbolt.Bucket) error) error {
+	timeout := b.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout <= 0 {
+			return ctx.Err()
+		}
+	}
+	db, err := bbolt.Open(b.path, 0600, &bbolt.Options{Timeout: timeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(leaseBucket))
+		if err != nil {
+			return err
+		}
+		return fn(bucket)
+	})
+}
+
+func getLease(bucket *bbolt.Bucket, key string) (boltLease, bool) {
+	var lease boltLease
+	data := bucket.Get([]byte(key))
+	if data == nil || json.Unmarshal(data, &lease) != nil {
+		return lease, false
+	}
+	return lease, lease.ExpiresAt > time.Now().UnixMilli()
+}
+
+// Acquire 获取或续期租约
+func (b *BoltBackend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	acquired := false
+	err := b.update(ctx, func(bucket *bbolt.Bucket) error {
+		if lease, ok := getLease(bucket, key); ok && lease.Owner != owner {
+			return nil
+		}
+		data, err := json.Marshal(boltLease{Owner: owner, ExpiresAt: time.Now().Add(ttl).UnixMilli()})
+		if err != nil {
+			return err
+		}
+		acquired = true
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
+
+// Release 释放属于 owner 的租约
+func (b *BoltBackend) Release(ctx context.Context, key, owner string) error {
+	return b.update(ctx, func(bucket *bbolt.Bucket) error {
+		if lease, ok := getLease(bucket, key); ok && lease.Owner != owner {
+			return nil
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// Holders 返回 prefix 开头且未过期的租约，顺便删除已过期的租约
+func (b *BoltBackend) Holders(ctx context.Context, prefix string) (map[string]string, error) {
+	holders := make(map[string]string)
+	err := b.update(ctx, func(bucket *bbolt.Bucket) error {
+		var expired [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			if lease, ok := getLease(bucket, string(k)); ok {
+				holders[string(k)] = lease.Owner
+			} else {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return holders, err
+}
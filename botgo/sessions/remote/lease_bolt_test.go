@@ -0,0 +1,82 @@
+package remote
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltBackend(t *testing.T) {
+	backend := NewBoltBackend(filepath.Join(t.TempDir(), "shards.db"))
+	ctx := context.Background()
+	ttl := 200 * time.Millisecond
+
+	t.Run("acquire", func(t *testing.T) {
+		if ok, err := backend.Acquire(ctx, "k_acquire", "a", ttl); err != nil || !ok {
+			t.Fatalf("a acquire = %v, %v, want true", ok, err)
+		}
+		if ok, err := backend.Acquire(ctx, "k_acquire", "b", ttl); err != nil || ok {
+			t.Fatalf("b acquire = %v, %v, want false", ok, err)
+		}
+		holders, err := backend.Holders(ctx, "k_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if holders["k_acquire"] != "a" {
+			t.Errorf("holders = %v, want k_acquire held by a", holders)
+		}
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		if ok, _ := backend.Acquire(ctx, "k_renew", "a", ttl); !ok {
+			t.Fatal("a acquire failed")
+		}
+		// 续期多次，总时间超过 ttl 仍由 a 持有
+		for i := 0; i < 3; i++ {
+			time.Sleep(ttl / 2)
+			if ok, err := backend.Acquire(ctx, "k_renew", "a", ttl); err != nil || !ok {
+				t.Fatalf("a renew = %v, %v, want true", ok, err)
+			}
+		}
+		if ok, _ := backend.Acquire(ctx, "k_renew", "b", ttl); ok {
+			t.Error("b acquired a renewed lease")
+		}
+	})
+
+	t.Run("expiry takeover", func(t *testing.T) {
+		if ok, _ := backend.Acquire(ctx, "k_expire", "a", ttl); !ok {
+			t.Fatal("a acquire failed")
+		}
+		time.Sleep(ttl + 50*time.Millisecond)
+		holders, err := backend.Holders(ctx, "k_expire")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(holders) != 0 {
+			t.Errorf("holders = %v, want expired lease removed", holders)
+		}
+		if ok, err := backend.Acquire(ctx, "k_expire", "b", ttl); err != nil || !ok {
+			t.Fatalf("b takeover = %v, %v, want true", ok, err)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		if ok, _ := backend.Acquire(ctx, "k_release", "a", ttl); !ok {
+			t.Fatal("a acquire failed")
+		}
+		// 不属于 b 的租约不会被 b 释放
+		if err := backend.Release(ctx, "k_release", "b"); err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := backend.Acquire(ctx, "k_release", "b", ttl); ok {
+			t.Fatal("b acquired after releasing a lease it does not own")
+		}
+		if err := backend.Release(ctx, "k_release", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := backend.Acquire(ctx, "k_release", "b", ttl); err != nil || !ok {
+			t.Fatalf("b acquire after release = %v, %v, want true", ok, err)
+		}
+	})
+}
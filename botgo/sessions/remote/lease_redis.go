@@ -0,0 +1,76 @@
+package remote
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisBackend 基于 redis 的分片租约，适合多台机器部署 [新增]
+// 租约的过期由 redis 的 key 过期实现，不依赖各实例的时钟
+type RedisBackend struct {
+	client *redis.Client
+}
+
+// NewRedisBackend 创建基于 redis 的分片租约后端，超时时间请在 NewClient 时候设置 [新增]
+func NewRedisBackend(client *redis.Client) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+var acquireScript = redis.NewScript(`
+local v = redis.call("get", KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call("set", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// Acquire 获取或续期租约
+func (b *RedisBackend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := acquireScript.Run(ctx, b.client, []string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Release 释放属于 owner 的租约
+func (b *RedisBackend) Release(ctx context.Context, key, owner string) error {
+	return releaseScript.Run(ctx, b.client, []string{key}, owner).Err()
+}
+
+// Holders 返回 prefix 开头的租约
+func (b *RedisBackend) Holders(ctx context.Context, prefix string) (map[string]string, error) {
+	var keys []string
+	iter := b.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	holders := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return holders, nil
+	}
+	values, err := b.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		// 扫描之后过期的 key 返回 nil
+		if owner, ok := value.(string); ok {
+			holders[keys[i]] = owner
+		}
+	}
+	return holders, nil
+}
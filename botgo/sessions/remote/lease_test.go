@@ -0,0 +1,102 @@
+package remote
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+// fakeWebSocket 连接总是失败，分片的连接协程只会按间隔重试，不访问网络
+type fakeWebSocket struct {
+	session dto.Session
+}
+
+func (f *fakeWebSocket) New(session dto.Session) websocket.WebSocket {
+	return &fakeWebSocket{session: session}
+}
+func (f *fakeWebSocket) Connect() error                     { return errors.New("fake websocket") }
+func (f *fakeWebSocket) Identify() error                    { return nil }
+func (f *fakeWebSocket) Session() *dto.Session              { return &f.session }
+func (f *fakeWebSocket) Resume() error                      { return nil }
+func (f *fakeWebSocket) Listening() error                   { return nil }
+func (f *fakeWebSocket) Write(message *dto.WSPayload) error { return nil }
+func (f *fakeWebSocket) Close()                             {}
+
+const (
+	testShardCount    = 4
+	testStartInterval = 10 * time.Millisecond
+)
+
+func newTestLeaseManager(backend Backend, owner string, ttl time.Duration) *LeaseManager {
+	m := NewLeaseManager(backend, WithLeaseClusterKey("test"), WithLeaseTTL(ttl), WithLeaseOwner(owner))
+	m.shardCount = testShardCount
+	return m
+}
+
+func balanceOnce(m *LeaseManager) {
+	intents := dto.Intent(0)
+	m.balance("", testShardCount, testStartInterval, token.BotToken(1, "secret", "", token.TypeBot), &intents)
+}
+
+func TestLeaseManager(t *testing.T) {
+	websocket.Register(&fakeWebSocket{})
+
+	t.Run("fair share", func(t *testing.T) {
+		backend := NewBoltBackend(filepath.Join(t.TempDir(), "shards.db"))
+		a := newTestLeaseManager(backend, "a", 5*time.Second)
+		b := newTestLeaseManager(backend, "b", 5*time.Second)
+		defer a.Close()
+		defer b.Close()
+
+		balanceOnce(a)
+		if got := a.Shards(); !reflect.DeepEqual(got, []uint32{0, 1, 2, 3}) {
+			t.Fatalf("a shards = %v, want all shards", got)
+		}
+		// b 加入后 a 每轮释放一个多出的分片，由 b 接管
+		for i := 0; i < testShardCount; i++ {
+			balanceOnce(b)
+			balanceOnce(a)
+		}
+		if got := a.Shards(); !reflect.DeepEqual(got, []uint32{0, 1}) {
+			t.Errorf("a shards = %v, want [0 1]", got)
+		}
+		if got := b.Shards(); !reflect.DeepEqual(got, []uint32{2, 3}) {
+			t.Errorf("b shards = %v, want [2 3]", got)
+		}
+	})
+
+	t.Run("expiry takeover", func(t *testing.T) {
+		backend := NewBoltBackend(filepath.Join(t.TempDir(), "shards.db"))
+		ttl := 300 * time.Millisecond
+		a := newTestLeaseManager(backend, "a", ttl)
+		b := newTestLeaseManager(backend, "b", ttl)
+		defer a.Close()
+		defer b.Close()
+
+		balanceOnce(a)
+		balanceOnce(b)
+		if got := b.Shards(); len(got) != 0 {
+			t.Fatalf("b shards = %v, want none while a holds every lease", got)
+		}
+		if !b.Standby() || a.Standby() {
+			t.Fatalf("standby a = %v, b = %v, want only b standby", a.Standby(), b.Standby())
+		}
+		// a 失联，租约过期后 b 接管全部分片
+		time.Sleep(ttl + 100*time.Millisecond)
+		balanceOnce(b)
+		if got := b.Shards(); !reflect.DeepEqual(got, []uint32{0, 1, 2, 3}) {
+			t.Fatalf("b shards = %v, want all shards", got)
+		}
+		// a 恢复后发现租约已属于 b，断开这些分片
+		balanceOnce(a)
+		if got := a.Shards(); len(got) != 0 {
+			t.Errorf("a shards = %v, want none after losing leases", got)
+		}
+	})
+}
@@ -110,6 +110,14 @@ func (atoken *AuthTokenInfo) StartRefreshAccessToken(ctx context.Context, tokenU
 // 	return nil
 // }
 
+// ExpiresAt AccessToken的过期时间,未获取到token时为零值 [新增]
+func (info AccessTokenInfo) ExpiresAt() time.Time {
+	if info.Token == "" || info.UpTime.IsZero() {
+		return time.Time{}
+	}
+	return info.UpTime.Add(time.Duration(info.ExpiresIn) * time.Second)
+}
+
 func (atoken *AuthTokenInfo) getAuthToken() AccessTokenInfo {
 	atoken.lock.RLock()
 	defer atoken.lock.RUnlock()
@@ -73,6 +73,14 @@ func (t *Token) InitToken(ctx context.Context) (err error) {
 	return nil
 }
 
+// AccessTokenInfo 取得当前的AccessToken信息,用于健康检查 [新增]
+func (t *Token) AccessTokenInfo() AccessTokenInfo {
+	if t.authToken == nil {
+		return AccessTokenInfo{}
+	}
+	return t.authToken.getAuthToken()
+}
+
 // GetAppID 取得Token中的appid
 func (t *Token) GetAppID() uint64 {
 	return t.appID
@@ -111,7 +111,7 @@ func (c *Client) Listening() error {
 			}
 			if event.DefaultHandlers.ErrorNotify != nil {
 				// 通知到使用方错误
-				event.DefaultHandlers.ErrorNotify(err)
+				event.DefaultHandlers.ErrorNotify(&event.ShardError{ShardID: c.session.Shards.ShardID, Err: err}) // [新增] 携带分片
 			}
 			return err
 		case <-c.heartBeatTicker.C:
@@ -230,6 +230,10 @@ func (c *Client) listenMessageAndHandle() {
 	}()
 	for payload := range c.messageQueue {
 		c.saveSeq(payload.Seq)
+		payload.Shard = c.session.Shards.ShardID // [新增]
+		if event.DefaultHandlers.Received != nil {
+			event.DefaultHandlers.Received(payload)
+		}
 		// ready 事件需要特殊处理
 		if payload.Type == "READY" {
 			c.readyHandler(payload)
@@ -250,6 +254,7 @@ func (c *Client) listenMessageAndHandle() {
 func (c *Client) saveSeq(seq uint32) {
 	if seq > 0 {
 		c.session.LastSeq = seq
+		websocket.SaveSession(c.session) // [新增] 持久化 seq，重启后 resume 时补发之后的事件
 	}
 }
 
@@ -260,6 +265,7 @@ func (c *Client) isHandleBuildIn(payload *dto.WSPayload) bool {
 	case dto.WSHello: // 接收到 hello 后需要开始发心跳
 		c.startHeartBeatTicker(payload.RawMessage)
 	case dto.WSHeartbeatAck: // 心跳 ack 不需要业务处理
+		websocket.SaveSession(c.session) // [新增] 刷新 session 的保存时间，用于判断重启后能否 resume
 	case dto.WSReconnect: // 达到连接时长，需要重新连接，此时可以通过 resume 续传原连接上的事件
 		c.closeChan <- errs.ErrNeedReConnect
 	case dto.WSInvalidSession: // 无效的 sessionLog，需要重新鉴权
@@ -291,6 +297,7 @@ func (c *Client) readyHandler(payload *dto.WSPayload) {
 	c.session.ID = readyData.SessionID
 	c.session.Shards.ShardID = readyData.Shard[0]
 	c.session.Shards.ShardCount = readyData.Shard[1]
+	websocket.SaveSession(c.session) // [新增] 持久化新的 session id
 	c.user = &dto.WSUser{
 		ID:       readyData.User.ID,
 		Username: readyData.User.Username,
@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// SessionStore 持久化各分片的 session id 与 seq，进程重启后先尝试 resume 再 identify [新增]
+type SessionStore interface {
+	// Load 读取相同分片保存的 session id 与 seq 并填入 session，没有可以 resume 的 session 时返回 false
+	Load(session *dto.Session) bool
+	// Save 保存 session 当前的 session id 与 seq
+	Save(session *dto.Session)
+	// Clear 清除分片保存的 session，session 不能再 resume 时调用
+	Clear(session *dto.Session)
+}
+
+var (
+	sessionStoreMu sync.RWMutex
+	sessionStore   SessionStore
+)
+
+// RegisterSessionStore 注册 session 持久化实现，不注册时每次启动都会 identify [新增]
+func RegisterSessionStore(store SessionStore) {
+	sessionStoreMu.Lock()
+	defer sessionStoreMu.Unlock()
+	sessionStore = store
+}
+
+func getSessionStore() SessionStore {
+	sessionStoreMu.RLock()
+	defer sessionStoreMu.RUnlock()
+	return sessionStore
+}
+
+// RestoreSession 从持久化中恢复 session，恢复成功时连接将执行 resume [新增]
+func RestoreSession(session *dto.Session) bool {
+	if store := getSessionStore(); store != nil {
+		return store.Load(session)
+	}
+	return false
+}
+
+// SaveSession 保存 session 的 session id 与 seq [新增]
+func SaveSession(session *dto.Session) {
+	if session.ID == "" {
+		return
+	}
+	if store := getSessionStore(); store != nil {
+		store.Save(session)
+	}
+}
+
+// ClearSession 清除保存的 session [新增]
+func ClearSession(session *dto.Session) {
+	if store := getSessionStore(); store != nil {
+		store.Clear(session)
+	}
+}
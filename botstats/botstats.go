@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hoshinonyaruko/gensokyo/config"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"go.etcd.io/bbolt"
 )
@@ -30,8 +31,10 @@ func InitializeDB() {
 		if err != nil {
 			return err
 		}
-		return nil
+		_, err = tx.CreateBucketIfNotExists([]byte(historyBucketName))
+		return err
 	})
+	PruneHistory()
 }
 
 const (
@@ -40,16 +43,26 @@ const (
 	lastMessageTimeKey = "lastMessageTime"
 )
 
-func RecordMessageReceived() {
-	recordStats(1, 0)
+// 消息类型
+const (
+	MessageTypeGroup        = "group"
+	MessageTypePrivate      = "private"
+	MessageTypeGuild        = "guild"
+	MessageTypeGuildPrivate = "guild_private"
+)
+
+// RecordMessageReceived 记录收到一条信息,groupID为真实的群号或子频道号,私聊为空
+func RecordMessageReceived(msgType string, groupID string) {
+	recordStats(1, 0, msgType, groupID)
 }
 
-func RecordMessageSent() {
-	recordStats(0, 1)
+// RecordMessageSent 记录发出一条信息,groupID为真实的群号或子频道号,私聊为空
+func RecordMessageSent(msgType string, groupID string) {
+	recordStats(0, 1, msgType, groupID)
 }
 
-// 收到增量 发出增量
-func recordStats(receivedIncrement int, sentIncrement int) {
+// 收到增量 发出增量 消息类型 群号
+func recordStats(receivedIncrement int, sentIncrement int, msgType string, groupID string) {
 	if db == nil {
 		mylog.Printf("recordStats db is nil")
 		return
@@ -64,6 +77,12 @@ func recordStats(receivedIncrement int, sentIncrement int) {
 		if lastTimeBytes != nil && !strings.HasPrefix(string(lastTimeBytes), today) {
 			b.Put([]byte(messageReceivedKey), []byte("0"))
 			b.Put([]byte(messageSentKey), []byte("0"))
+			// 跨天时顺便清理过期的历史统计
+			if retention := config.GetStatsRetentionDays(); retention > 0 {
+				if err := pruneHistory(tx, now.AddDate(0, 0, -retention).Format(dayLayout)); err != nil {
+					mylog.Printf("清理历史统计失败: %v", err)
+				}
+			}
 		}
 
 		updateCounter(b, messageReceivedKey, receivedIncrement)
@@ -71,6 +90,9 @@ func recordStats(receivedIncrement int, sentIncrement int) {
 		// Ensure the time format is RFC3339 and only store date and time
 		b.Put([]byte(lastMessageTimeKey), []byte(now.Format(time.RFC3339)))
 
+		if err := updateHistory(tx, now, msgType, groupID, receivedIncrement, sentIncrement); err != nil {
+			mylog.Printf("记录历史统计失败: %v", err)
+		}
 		return nil
 	})
 }
@@ -132,3 +154,13 @@ func getLastMessageTime(b *bbolt.Bucket) int64 {
 func CloseDB() {
 	db.Close()
 }
+
+// Ping 检查botstats.db是否可以读取,用于健康检查
+func Ping() error {
+	if db == nil {
+		return errors.New("database is not initialized")
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
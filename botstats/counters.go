@@ -0,0 +1,203 @@
+package botstats
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// 本次运行期间的连接与调用计数,进程重启后清零
+var (
+	gatewayEvents      uint64 // 收到的网关事件数
+	apiCalls           uint64 // 调用官方api的次数
+	apiFailed          uint64 // 官方api返回非成功状态码的次数
+	gatewayDisconnects uint32 // 与网关的ws连接断开次数
+	wsDisconnects      uint32 // 反向ws与应用端的连接断开次数
+	online             int32  // 网关会话是否在线,负责的分片全部在线时为在线
+	onlineChangedAt    int64  // 在线状态最近一次变化的时间
+)
+
+var (
+	shardMu     sync.Mutex
+	shardStates = make(map[uint32]ShardState) // 各分片最近一次上报的会话状态
+	ownedShards func() []uint32
+	standby     func() bool
+)
+
+// ShardState 一个分片的网关会话状态
+type ShardState struct {
+	ShardID   uint32 `json:"shard_id"`
+	State     string `json:"state"`
+	ChangedAt int64  `json:"changed_at"`
+}
+
+// 网关会话的状态
+const (
+	GatewayConnecting   = "connecting"   // 启动后尚未收到READY
+	GatewayIdentified   = "identified"   // 收到READY
+	GatewayResumed      = "resumed"      // 断线后resume成功
+	GatewayReconnecting = "reconnecting" // 连接断开,等待重连
+	GatewayStandby      = "standby"      // 分片租约模式下不持有分片,所有分片由其他实例持有
+)
+
+// Counters 计数的快照
+type Counters struct {
+	GatewayEvents      uint64
+	APICalls           uint64
+	APIFailed          uint64
+	GatewayDisconnects uint32
+	WsDisconnects      uint32
+	Online             bool
+	OnlineChangedAt    int64
+	GatewayState       string
+}
+
+// RecordGatewayEvent 记录收到一个网关事件
+func RecordGatewayEvent() {
+	atomic.AddUint64(&gatewayEvents, 1)
+}
+
+// RecordGatewayDisconnect 记录分片与网关的连接断开,该分片的会话变为离线
+func RecordGatewayDisconnect(shard uint32) {
+	atomic.AddUint32(&gatewayDisconnects, 1)
+	SetGatewayState(shard, GatewayReconnecting)
+}
+
+// RecordWsDisconnect 记录反向ws与应用端的连接断开
+func RecordWsDisconnect() {
+	atomic.AddUint32(&wsDisconnects, 1)
+}
+
+// refreshOnline 当前实例负责的分片全部在线,或者为备用实例时网关会话在线,在线状态变化时记录时间
+func refreshOnline() bool {
+	state := GetGatewayState()
+	value := state == GatewayIdentified || state == GatewayResumed || state == GatewayStandby
+	var v int32
+	if value {
+		v = 1
+	}
+	if atomic.SwapInt32(&online, v) != v {
+		atomic.StoreInt64(&onlineChangedAt, time.Now().Unix())
+	}
+	return value
+}
+
+// SetGatewayState 设置分片的网关会话状态,identified和resumed为在线
+func SetGatewayState(shard uint32, state string) {
+	shardMu.Lock()
+	shardStates[shard] = ShardState{ShardID: shard, State: state, ChangedAt: time.Now().Unix()}
+	shardMu.Unlock()
+	refreshOnline()
+}
+
+// SetOwnedShards 设置返回当前实例负责的分片的函数,未设置时为上报过状态的分片
+func SetOwnedShards(fn func() []uint32) {
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	ownedShards = fn
+}
+
+// SetStandby 设置判断当前实例是否为备用实例的函数,备用实例不持有分片,视为在线
+func SetStandby(fn func() bool) {
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	standby = fn
+}
+
+// IsStandby 当前实例是否为不持有分片的备用实例
+func IsStandby() bool {
+	shardMu.Lock()
+	fn := standby
+	shardMu.Unlock()
+	return fn != nil && fn()
+}
+
+// GatewayShards 当前实例负责的各分片的会话状态,按分片排序,尚未上报状态的分片为connecting
+func GatewayShards() []ShardState {
+	shardMu.Lock()
+	owned := ownedShards
+	shardMu.Unlock()
+
+	var ids []uint32
+	if owned != nil {
+		ids = owned()
+	}
+
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	if owned == nil {
+		for id := range shardStates {
+			ids = append(ids, id)
+		}
+	}
+	states := make([]ShardState, 0, len(ids))
+	for _, id := range ids {
+		state, ok := shardStates[id]
+		if !ok {
+			state = ShardState{ShardID: id, State: GatewayConnecting}
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ShardID < states[j].ShardID })
+	return states
+}
+
+// GetGatewayState 汇总各分片的会话状态,全部在线时为identified(有分片resume过时为resumed),否则为最差的状态
+// 不持有分片的备用实例为standby
+func GetGatewayState() string {
+	shards := GatewayShards()
+	if len(shards) == 0 {
+		if IsStandby() {
+			return GatewayStandby
+		}
+		return GatewayConnecting
+	}
+	state := GatewayIdentified
+	for _, shard := range shards {
+		switch shard.State {
+		case GatewayReconnecting:
+			return GatewayReconnecting
+		case GatewayConnecting:
+			state = GatewayConnecting
+		case GatewayResumed:
+			if state == GatewayIdentified {
+				state = GatewayResumed
+			}
+		}
+	}
+	return state
+}
+
+// GetCounters 获取本次运行期间的计数
+func GetCounters() Counters {
+	// 负责的分片可能随租约变化,读取时重新汇总
+	isOnline := refreshOnline()
+	return Counters{
+		GatewayEvents:      atomic.LoadUint64(&gatewayEvents),
+		APICalls:           atomic.LoadUint64(&apiCalls),
+		APIFailed:          atomic.LoadUint64(&apiFailed),
+		GatewayDisconnects: atomic.LoadUint32(&gatewayDisconnects),
+		WsDisconnects:      atomic.LoadUint32(&wsDisconnects),
+		Online:             isOnline,
+		OnlineChangedAt:    atomic.LoadInt64(&onlineChangedAt),
+		GatewayState:       GetGatewayState(),
+	}
+}
+
+// RegisterAPIFilters 注册botgo的请求与返回过滤器,统计官方api的调用次数和失败次数
+func RegisterAPIFilters() {
+	openapi.RegisterReqFilter("botstats", func(req *http.Request, _ *http.Response) error {
+		atomic.AddUint64(&apiCalls, 1)
+		return nil
+	})
+	openapi.RegisterRespFilter("botstats", func(_ *http.Request, resp *http.Response) error {
+		if resp != nil && !openapi.IsSuccessStatus(resp.StatusCode) {
+			atomic.AddUint64(&apiFailed, 1)
+		}
+		return nil
+	})
+}
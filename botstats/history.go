@@ -0,0 +1,239 @@
+package botstats
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+// 按天分桶的历史统计,每天一个子桶,键为 时|消息类型|群号,值为收到和发出两个计数
+const historyBucketName = "history"
+
+const (
+	dayLayout = "2006-01-02"
+	// 按小时聚合
+	IntervalHour = "hour"
+	// 按天聚合
+	IntervalDay = "day"
+)
+
+// Point 一个时间段内的收发数量
+type Point struct {
+	Time     int64  `json:"time"` // 时间段开始的unix时间戳
+	Received uint64 `json:"received"`
+	Sent     uint64 `json:"sent"`
+}
+
+// GroupVolume 一个群(子频道)在时间范围内的收发数量
+type GroupVolume struct {
+	GroupID     string `json:"group_id"` // 真实的群号或子频道号
+	MessageType string `json:"message_type"`
+	Received    uint64 `json:"received"`
+	Sent        uint64 `json:"sent"`
+}
+
+// Total 收发总数
+func (g GroupVolume) Total() uint64 {
+	return g.Received + g.Sent
+}
+
+func historyKey(hour int, msgType string, groupID string) []byte {
+	return []byte(strconv.Itoa(100+hour)[1:] + "|" + msgType + "|" + groupID)
+}
+
+func parseHistoryKey(key []byte) (hour int, msgType string, groupID string, ok bool) {
+	parts := strings.SplitN(string(key), "|", 3)
+	if len(parts) != 3 {
+		return 0, "", "", false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", "", false
+	}
+	return hour, parts[1], parts[2], true
+}
+
+func decodeHistoryValue(v []byte) (received uint64, sent uint64) {
+	if len(v) != 16 {
+		return 0, 0
+	}
+	return binary.BigEndian.Uint64(v[:8]), binary.BigEndian.Uint64(v[8:])
+}
+
+// 在同一个事务中累加当前小时的历史计数
+func updateHistory(tx *bbolt.Tx, now time.Time, msgType string, groupID string, receivedIncrement int, sentIncrement int) error {
+	root, err := tx.CreateBucketIfNotExists([]byte(historyBucketName))
+	if err != nil {
+		return err
+	}
+	day, err := root.CreateBucketIfNotExists([]byte(now.Format(dayLayout)))
+	if err != nil {
+		return err
+	}
+	key := historyKey(now.Hour(), msgType, groupID)
+	received, sent := decodeHistoryValue(day.Get(key))
+	received += uint64(receivedIncrement)
+	sent += uint64(sentIncrement)
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value[:8], received)
+	binary.BigEndian.PutUint64(value[8:], sent)
+	return day.Put(key, value)
+}
+
+// PruneHistory 删除超过保留天数的历史统计,保留天数为0时不删除
+func PruneHistory() {
+	if db == nil {
+		return
+	}
+	retention := config.GetStatsRetentionDays()
+	if retention <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -retention).Format(dayLayout)
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return pruneHistory(tx, cutoff)
+	})
+	if err != nil {
+		mylog.Printf("清理历史统计失败: %v", err)
+	}
+}
+
+func pruneHistory(tx *bbolt.Tx, cutoff string) error {
+	root := tx.Bucket([]byte(historyBucketName))
+	if root == nil {
+		return nil
+	}
+	var expired [][]byte
+	c := root.Cursor()
+	// 日期格式可按字典序比较
+	for k, _ := c.First(); k != nil && string(k) < cutoff; k, _ = c.Next() {
+		expired = append(expired, append([]byte(nil), k...))
+	}
+	for _, k := range expired {
+		if err := root.DeleteBucket(k); err != nil {
+			return err
+		}
+	}
+	if len(expired) > 0 {
+		mylog.Printf("已清理%d天的历史统计", len(expired))
+	}
+	return nil
+}
+
+// 遍历[start,end]内的每个小时记录
+func forEachHistory(start time.Time, end time.Time, fn func(at time.Time, msgType string, groupID string, received uint64, sent uint64)) error {
+	if db == nil {
+		return errors.New("database is not initialized")
+	}
+	if end.Before(start) {
+		return errors.New("end time is before start time")
+	}
+	from := start.Truncate(time.Hour)
+	return db.View(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(historyBucketName))
+		if root == nil {
+			return nil
+		}
+		c := root.Cursor()
+		for k, _ := c.Seek([]byte(start.Format(dayLayout))); k != nil && string(k) <= end.Format(dayLayout); k, _ = c.Next() {
+			day, err := time.ParseInLocation(dayLayout, string(k), time.Local)
+			if err != nil {
+				continue
+			}
+			b := root.Bucket(k)
+			if b == nil {
+				continue
+			}
+			b.ForEach(func(key, value []byte) error {
+				hour, msgType, groupID, ok := parseHistoryKey(key)
+				if !ok {
+					return nil
+				}
+				at := day.Add(time.Duration(hour) * time.Hour)
+				if at.Before(from) || at.After(end) {
+					return nil
+				}
+				received, sent := decodeHistoryValue(value)
+				fn(at, msgType, groupID, received, sent)
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// GetHistory 获取时间范围内按小时或按天聚合的收发数量,groupID和msgType为空时不过滤
+func GetHistory(start time.Time, end time.Time, interval string, groupID string, msgType string) ([]Point, error) {
+	points := make(map[int64]*Point)
+	err := forEachHistory(start, end, func(at time.Time, t string, g string, received uint64, sent uint64) {
+		if groupID != "" && g != groupID {
+			return
+		}
+		if msgType != "" && t != msgType {
+			return
+		}
+		if interval == IntervalDay {
+			at = time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+		}
+		p, ok := points[at.Unix()]
+		if !ok {
+			p = &Point{Time: at.Unix()}
+			points[at.Unix()] = p
+		}
+		p.Received += received
+		p.Sent += sent
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Point, 0, len(points))
+	for _, p := range points {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time < result[j].Time
+	})
+	return result, nil
+}
+
+// GetTopGroups 获取时间范围内收发总量最多的群(子频道),limit小于等于0时返回全部
+func GetTopGroups(start time.Time, end time.Time, limit int) ([]GroupVolume, error) {
+	groups := make(map[string]*GroupVolume)
+	err := forEachHistory(start, end, func(_ time.Time, t string, g string, received uint64, sent uint64) {
+		if g == "" {
+			return
+		}
+		key := t + "|" + g
+		v, ok := groups[key]
+		if !ok {
+			v = &GroupVolume{GroupID: g, MessageType: t}
+			groups[key] = v
+		}
+		v.Received += received
+		v.Sent += sent
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]GroupVolume, 0, len(groups))
+	for _, v := range groups {
+		result = append(result, *v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total() != result[j].Total() {
+			return result[i].Total() > result[j].Total()
+		}
+		return result[i].GroupID < result[j].GroupID
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
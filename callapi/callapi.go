@@ -1,9 +1,16 @@
 package callapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/msgstore"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/tencent-connect/botgo/openapi"
 )
@@ -15,6 +22,34 @@ type ActionMessage struct {
 	Echo        interface{}   `json:"echo,omitempty"`
 	PostType    string        `json:"post_type,omitempty"`
 	MessageType string        `json:"message_type,omitempty"`
+	// 链路追踪ID,与触发这次调用的事件相同,找不到对应事件时为新生成的ID
+	TraceID string `json:"-"`
+}
+
+// Context 返回携带链路追踪ID的context,用于调用官方api
+func (a ActionMessage) Context() context.Context {
+	return openapi.WithRequestTraceID(context.Background(), a.TraceID)
+}
+
+// resolveTraceID 通过echo或message_id找到触发这次调用的事件的链路追踪ID,
+// 都找不到时沿用group_id或user_id对应会话最近一个事件的ID
+func resolveTraceID(message ActionMessage) string {
+	if echo, ok := message.Echo.(string); ok {
+		if traceID := mylog.TraceOf(echo); traceID != "" {
+			return traceID
+		}
+	}
+	keys := []string{
+		msgstore.FormatMessageID(message.Params.MessageID),
+		mylog.ConversationKey("group", msgstore.FormatMessageID(message.Params.GroupID)),
+		mylog.ConversationKey("user", msgstore.FormatMessageID(message.Params.UserID)),
+	}
+	for _, key := range keys {
+		if traceID := mylog.TraceOf(key); traceID != "" {
+			return traceID
+		}
+	}
+	return mylog.NewTraceID()
 }
 
 func (a *ActionMessage) UnmarshalJSON(data []byte) error {
@@ -82,6 +117,10 @@ type ParamsContent struct {
 	Context      Context   `json:"context,omitempty"`       // context 字段
 	Operation    Operation `json:"operation,omitempty"`     // operation 字段
 	CallbackData string    `json:"callback_data,omitempty"` // 新增: 用于接收 GenerateURLLink 的参数
+	StartTime    int64     `json:"start_time,omitempty"`    // get_bot_stats 开始时间,unix时间戳
+	EndTime      int64     `json:"end_time,omitempty"`      // get_bot_stats 结束时间,unix时间戳
+	Interval     string    `json:"interval,omitempty"`      // get_bot_stats 聚合粒度 hour或day
+	Limit        int       `json:"limit,omitempty"`         // get_bot_stats 返回的活跃群数量
 }
 
 // Context 结构体用于存储 context 字段相关信息
@@ -100,8 +139,11 @@ type Context struct {
 
 // Operation 结构体用于存储 operation 字段相关信息
 type Operation struct {
-	Reply    string `json:"reply,omitempty"`     // 回复内容
-	AtSender bool   `json:"at_sender,omitempty"` // 是否 @ 发送者
+	Reply       interface{} `json:"reply,omitempty"`        // 回复内容,字符串或信息段数组
+	AtSender    *bool       `json:"at_sender,omitempty"`    // 是否 @ 发送者,群聊中未设置时默认为true
+	Delete      bool        `json:"delete,omitempty"`       // 撤回该条信息
+	Ban         bool        `json:"ban,omitempty"`          // 禁言发送者
+	BanDuration int         `json:"ban_duration,omitempty"` // 禁言时长,单位秒,默认30分钟
 }
 
 // 自定义一个ParamsContent的UnmarshalJSON 让GroupID同时兼容str和int
@@ -191,12 +233,47 @@ type Client interface {
 	SendMessage(message map[string]interface{}) error
 }
 
+// CaptureClient 捕获handler通过client.SendMessage发出的响应,用于http api等需要同步取回结果的场景
+type CaptureClient struct {
+	mu       sync.Mutex
+	response map[string]interface{}
+}
+
+func (c *CaptureClient) SendMessage(message map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.response = message
+	return nil
+}
+
+// Response 返回最后一次捕获的响应,没有响应时为nil
+func (c *CaptureClient) Response() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.response
+}
+
 // 为了解决processor和server循环依赖设计的接口
 type WebSocketServerClienter interface {
 	SendMessage(message map[string]interface{}) error
 	Close() error
 }
 
+// EventFilterer 可选接口,连接实现后按其事件过滤规则筛选上报的事件
+type EventFilterer interface {
+	EventFilter() string
+}
+
+// EventReceiver 可选接口,返回false的连接(如反向ws的API连接)不接收事件
+type EventReceiver interface {
+	AcceptsEvents() bool
+}
+
+// Backender 可选接口,返回连接作为应用端的名称,用于事件路由
+type Backender interface {
+	BackendName() string
+}
+
 // 根据action订阅handler处理api
 type HandlerFunc func(client Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, messgae ActionMessage) (string, error)
 
@@ -207,20 +284,238 @@ func RegisterHandler(action string, handler HandlerFunc) {
 	handlers[action] = handler
 }
 
+// RegisteredActions 返回所有已注册的action名称(已排序)
+func RegisteredActions() []string {
+	actions := make([]string, 0, len(handlers))
+	for action := range handlers {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// HasHandler 判断action是否已注册handler
+func HasHandler(action string) bool {
+	_, ok := handlers[action]
+	return ok
+}
+
+// responseGuard 保证每次action调用只向应用端发送一个响应,并补全响应中的echo
+type responseGuard struct {
+	client   Client
+	action   string
+	echo     interface{}
+	mu       sync.Mutex
+	sent     bool
+	pending  bool                   // handler已在协程中异步发送回执
+	async    int                    // 尚未发送的异步回执数
+	returned bool                   // handler已经返回
+	held     map[string]interface{} // 异步回执在handler返回并且全部完成前暂存,期间handler失败时改为发送失败响应
+	done     chan struct{}          // 发送响应后关闭
+}
+
+// pendingWait CaptureClient的调用方在返回后立即读取响应,等待异步回执的最长时间
+const pendingWait = 30 * time.Second
+
+// MarkPending handler在协程中异步发送回执(threads_ret_msg)前调用,每个异步回执调用一次
+// 回执在handler返回且全部异步回执完成后才发送,后续部分发送失败时应用端收到失败响应
+func MarkPending(client Client) {
+	if g, ok := client.(*responseGuard); ok {
+		g.mu.Lock()
+		g.pending = true
+		g.async++
+		g.mu.Unlock()
+	}
+}
+
+func (g *responseGuard) SendMessage(message map[string]interface{}) error {
+	g.mu.Lock()
+	if g.sent {
+		g.mu.Unlock()
+		mylog.Printf("action[%s]已经发送过响应,忽略重复的响应: %v", g.action, message)
+		return nil
+	}
+	if g.async > 0 {
+		// 异步回执先暂存,保留第一个部分的回执
+		g.async--
+		if g.held == nil {
+			g.held = message
+		}
+		if !g.returned || g.async > 0 {
+			g.mu.Unlock()
+			return nil
+		}
+		message = g.held
+	}
+	return g.sendLocked(message)
+}
+
+// sendLocked 在持有mu时调用,发送响应并释放mu
+func (g *responseGuard) sendLocked(message map[string]interface{}) error {
+	g.sent = true
+	close(g.done)
+	g.mu.Unlock()
+
+	if _, ok := message["echo"]; !ok || message["echo"] == nil {
+		message["echo"] = g.echo
+	}
+	return g.client.SendMessage(message)
+}
+
+// finish handler返回后调用,failure不为nil时发送失败响应并丢弃暂存的回执,
+// 否则在异步回执都已完成时发送暂存的回执,返回是否已经发送或将由异步回执发送响应
+func (g *responseGuard) finish(failure map[string]interface{}) bool {
+	g.mu.Lock()
+	g.returned = true
+	if g.sent {
+		g.mu.Unlock()
+		return true
+	}
+	if failure != nil {
+		if err := g.sendLocked(failure); err != nil {
+			mylog.Printf("Error sending message via client: %v", err)
+		}
+		return true
+	}
+	if g.held != nil && g.async == 0 {
+		g.sendLocked(g.held)
+		return true
+	}
+	pending := g.pending
+	g.mu.Unlock()
+	return pending
+}
+
+func (g *responseGuard) hasSent() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.sent
+}
+
+func (g *responseGuard) isPending() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pending
+}
+
+// flushHeld 等待异步回执超时后发送已暂存的回执
+func (g *responseGuard) flushHeld() bool {
+	g.mu.Lock()
+	if g.sent {
+		g.mu.Unlock()
+		return true
+	}
+	if g.held == nil {
+		g.mu.Unlock()
+		return false
+	}
+	g.sendLocked(g.held)
+	return true
+}
+
+// waitPending 异步回执尚未发送时,CaptureClient需要等待回执,其他连接由协程稍后发送
+func (g *responseGuard) waitPending() bool {
+	if _, ok := g.client.(*CaptureClient); !ok {
+		return true
+	}
+	select {
+	case <-g.done:
+		return true
+	case <-time.After(pendingWait):
+		return g.flushHeld()
+	}
+}
+
 // CallAPIFromDict 处理信息 by calling the 对应的 handler.
+// 无论handler是否成功,都保证向应用端发送且只发送一个携带echo的响应
 func CallAPIFromDict(client Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message ActionMessage) string {
+	if message.TraceID == "" {
+		message.TraceID = resolveTraceID(message)
+	}
+	logger := mylog.WithTrace(message.TraceID)
+
 	handler, ok := handlers[message.Action]
 	if !ok {
-		mylog.Println("Unsupported action:", message.Action)
-		return ""
+		logger.Printf("Unsupported action: %s", message.Action)
+		response := FailedResponse(RetCodeUnsupported, "不支持的action: "+message.Action, "API不存在", message.Echo)
+		return sendFailedResponse(client, response)
 	}
 
-	jsonString, err := handler(client, api, apiv2, message)
+	guard := &responseGuard{
+		client: client,
+		action: message.Action,
+		echo:   message.Echo,
+		done:   make(chan struct{}),
+	}
+	logger.Printf("处理action[%s] echo:%v", message.Action, message.Echo)
+	jsonString, err := handler(guard, api, apiv2, message)
 	if err != nil {
-		// 处理错误
-		mylog.Println("Error handling action:", message.Action, "Error:", err)
-		return ""
+		// 处理错误,尚未发送的异步回执不再发送
+		logger.Errorf("Error handling action: %s Error: %v", message.Action, err)
+		response := errorResponse(err, message.Echo)
+		sent := guard.hasSent()
+		guard.finish(response)
+		if sent {
+			return ""
+		}
+		result, err := json.Marshal(response)
+		if err != nil {
+			return ""
+		}
+		return string(result)
+	}
+
+	if !guard.finish(nil) {
+		// handler只返回了结果而没有通过client发送
+		var response map[string]interface{}
+		if jsonString != "" && json.Unmarshal([]byte(jsonString), &response) == nil {
+			guard.SendMessage(response)
+			return jsonString
+		}
+		if config.GetNoRetMsg() {
+			// no_ret_msg 不发送回执
+			return ""
+		}
+		logger.Printf("action[%s]没有返回响应", message.Action)
+		return sendFailedResponse(guard, FailedResponse(RetCodeNoResponse, message.Action+" 没有返回结果", "没有返回结果", message.Echo))
+	}
+	if guard.isPending() && !guard.waitPending() {
+		logger.Printf("action[%s]等待异步回执超时", message.Action)
+		response := FailedResponse(RetCodeNoResponse, message.Action+" 没有返回结果", "没有返回结果", message.Echo)
+		guard.finish(response)
+		result, err := json.Marshal(response)
+		if err != nil {
+			return ""
+		}
+		return string(result)
 	}
 
 	return jsonString
 }
+
+// sendFailedResponse 发送失败响应,并返回其json字符串
+func sendFailedResponse(client Client, response map[string]interface{}) string {
+	if err := client.SendMessage(response); err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	result, err := json.Marshal(response)
+	if err != nil {
+		return ""
+	}
+	return string(result)
+}
+
+// RegisterTraceFilter 注册botgo的返回过滤器,带有链路追踪ID的官方api请求会记录官方返回的trace id(即openapi.TraceID())
+func RegisterTraceFilter() {
+	openapi.RegisterRespFilter("trace", func(req *http.Request, resp *http.Response) error {
+		if req == nil || resp == nil {
+			return nil
+		}
+		traceID := openapi.RequestTraceID(req.Context())
+		if traceID == "" {
+			return nil
+		}
+		mylog.WithTrace(traceID).Printf("[OPENAPI]%s %s status:%d openapi_trace_id:%s", req.Method, req.URL.Path, resp.StatusCode, resp.Header.Get(openapi.TraceIDKey))
+		return nil
+	})
+}
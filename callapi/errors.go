@@ -0,0 +1,101 @@
+package callapi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tencent-connect/botgo/errs"
+)
+
+// onebot失败响应的retcode
+const (
+	RetCodeFailed      = 100  // 调用官方api失败
+	RetCodeNoResponse  = 102  // handler没有返回结果
+	RetCodeNotFound    = 103  // 请求的消息等资源不存在或已过期
+	RetCodeBadParams   = 1400 // 参数错误,或者参数中的id没有映射
+	RetCodeUnsupported = 1404 // 不支持的action
+)
+
+// ActionError handler返回的错误,携带onebot的retcode和面向用户的wording
+type ActionError struct {
+	RetCode int
+	Message string
+	Wording string
+}
+
+func (e *ActionError) Error() string {
+	if e.Wording != "" {
+		return fmt.Sprintf("retcode:%d, message:%s, wording:%s", e.RetCode, e.Message, e.Wording)
+	}
+	return fmt.Sprintf("retcode:%d, message:%s", e.RetCode, e.Message)
+}
+
+// BadParams 参数错误,如缺少参数或id在idmap中不存在
+func BadParams(format string, args ...interface{}) error {
+	return &ActionError{
+		RetCode: RetCodeBadParams,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Unsupported 当前场景不支持的能力
+func Unsupported(format string, args ...interface{}) error {
+	return &ActionError{
+		RetCode: RetCodeUnsupported,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// NotFound 请求的资源不存在,如消息已过期
+func NotFound(format string, args ...interface{}) error {
+	return &ActionError{
+		RetCode: RetCodeNotFound,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// UpstreamError 调用官方api失败,wording中携带官方的错误码和错误信息
+func UpstreamError(message string, err error) error {
+	return &ActionError{
+		RetCode: RetCodeFailed,
+		Message: message,
+		Wording: Wording(err),
+	}
+}
+
+// Wording 从官方api返回的错误中提取错误码和错误信息
+func Wording(err error) string {
+	if err == nil {
+		return ""
+	}
+	var sdkErr *errs.Err
+	if errors.As(err, &sdkErr) {
+		return fmt.Sprintf("官方api返回错误 code:%d, message:%s", sdkErr.Code(), sdkErr.Text())
+	}
+	return err.Error()
+}
+
+// FailedResponse 构造标准的onebot失败响应
+func FailedResponse(retcode int, message string, wording string, echo interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"status":  "failed",
+		"retcode": retcode,
+		"data":    nil,
+		"message": message,
+		"wording": wording,
+		"echo":    echo,
+	}
+}
+
+// errorResponse 将handler返回的错误转换为失败响应
+func errorResponse(err error, echo interface{}) map[string]interface{} {
+	var actionErr *ActionError
+	if errors.As(err, &actionErr) {
+		wording := actionErr.Wording
+		if wording == "" {
+			wording = actionErr.Message
+		}
+		return FailedResponse(actionErr.RetCode, actionErr.Message, wording, echo)
+	}
+	return FailedResponse(RetCodeFailed, err.Error(), Wording(err), echo)
+}
@@ -36,13 +36,15 @@ type CommentBlock struct {
 
 // 不支持配置热重载的配置项
 var restartRequiredFields = []string{
-	"WsAddress", "WsToken", "ReconnectTimes", "HeartBeatInterval", "LaunchReconnectTimes",
+	"WsAddress", "WsToken", "WsOnebotVersion", "WsRole", "ReconnectTimes", "HeartBeatInterval", "LaunchReconnectTimes",
 	"AppID", "Uin", "Token", "ClientSecret", "ShardCount", "ShardID", "UseUin",
+	"ShardCoordinator", "ShardCoordinatorPath", "ShardRedisAddr", "ShardRedisPassword", "ShardRedisDB", "ShardLeaseTTL",
 	"TextIntent",
 	"ServerDir", "Port", "BackupPort", "Lotus", "LotusPassword", "LotusWithoutIdmaps",
-	"WsServerPath", "EnableWsServer", "WsServerToken",
-	"IdentifyFile", "IdentifyAppids", "Crt", "Key",
-	"DeveloperLog", "LogLevel", "SaveLogs",
+	"WsServerPath", "EnableWsServer", "WsServerToken", "WsServerPathV12",
+	"EnableSatori", "SatoriPath",
+	"IdentifyFile", "IdentifyAppids", "Crt", "Key", "WebhookWorkers", "WebhookQueueSize",
+	"DeveloperLog", "LogLevel", "SaveLogs", "LogFormat",
 	"DisableWebui", "Username", "Password",
 	"Title", // 继续检查和增加
 }
@@ -2549,3 +2551,515 @@ func GetGlobalC2CMsgReceiveMessage() string {
 	}
 	return ""
 }
+
+// 获取EnableMsgStore的值
+func GetEnableMsgStore() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to EnableMsgStore value.")
+		return false
+	}
+	return instance.Settings.EnableMsgStore
+}
+
+// 获取MsgStoreRetention的值 单位小时
+func GetMsgStoreRetention() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to MsgStoreRetention value.")
+		return 72
+	}
+	return instance.Settings.MsgStoreRetention
+}
+
+// GetWsOnebotVersion 获取ws_address对应下标的onebot版本,未配置时默认为11
+func GetWsOnebotVersion(index int) int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WsOnebotVersion value.")
+		return 11
+	}
+	versions := instance.Settings.WsOnebotVersion
+	if index < 0 || index >= len(versions) || versions[index] != 12 {
+		return 11
+	}
+	return 12
+}
+
+// 获取WsServerPathV12的值
+func GetWsServerPathV12() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WsServerPathV12 value.")
+		return ""
+	}
+	return instance.Settings.WsServerPathV12
+}
+
+// 获取EnableSatori的值
+func GetEnableSatori() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to EnableSatori value.")
+		return false
+	}
+	return instance.Settings.EnableSatori
+}
+
+// 获取SatoriPath的值
+func GetSatoriPath() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to SatoriPath value.")
+		return "satori"
+	}
+	return instance.Settings.SatoriPath
+}
+
+// 获取SatoriToken的值
+func GetSatoriToken() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to SatoriToken value.")
+		return ""
+	}
+	return instance.Settings.SatoriToken
+}
+
+// 获取反向ws对应的事件过滤规则
+func GetWsFilter(index int) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WsFilter value.")
+		return ""
+	}
+	filters := instance.Settings.WsFilter
+	if index < 0 || index >= len(filters) {
+		return ""
+	}
+	return filters[index]
+}
+
+// 获取正向ws的事件过滤规则
+func GetWsServerFilter(onebotVersion int) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WsServerFilter value.")
+		return ""
+	}
+	if onebotVersion == 12 {
+		return instance.Settings.WsServerFilterV12
+	}
+	return instance.Settings.WsServerFilter
+}
+
+// 获取http上报对应的事件过滤规则
+func GetPostFilter(index int) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to PostFilter value.")
+		return ""
+	}
+	filters := instance.Settings.PostFilter
+	if index < 0 || index >= len(filters) {
+		return ""
+	}
+	return filters[index]
+}
+
+// 获取事件路由规则
+func GetEventRoutes() []structs.EventRouteConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to EventRoutes value.")
+		return nil
+	}
+	return instance.Settings.EventRoutes
+}
+
+// 获取未命中路由规则时的默认应用端
+func GetEventRouteDefault() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to EventRouteDefault value.")
+		return nil
+	}
+	return instance.Settings.EventRouteDefault
+}
+
+// 获取负载均衡池
+func GetBackendPools() []structs.BackendPoolConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to BackendPools value.")
+		return nil
+	}
+	return instance.Settings.BackendPools
+}
+
+// 获取OutboxMaxAge的值 单位秒
+func GetOutboxMaxAge() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to OutboxMaxAge value.")
+		return 3600
+	}
+	return instance.Settings.OutboxMaxAge
+}
+
+// 获取OutboxMaxSize的值
+func GetOutboxMaxSize() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to OutboxMaxSize value.")
+		return 5000
+	}
+	return instance.Settings.OutboxMaxSize
+}
+
+// 获取OutboxReplyWindow的值 单位秒
+func GetOutboxReplyWindow() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to OutboxReplyWindow value.")
+		return 300
+	}
+	return instance.Settings.OutboxReplyWindow
+}
+
+// GetWsRole 获取ws_address对应下标的X-Client-Role,未配置时默认为Universal
+func GetWsRole(index int) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WsRole value.")
+		return "Universal"
+	}
+	roles := instance.Settings.WsRole
+	if index < 0 || index >= len(roles) {
+		return "Universal"
+	}
+	switch strings.ToLower(roles[index]) {
+	case "api":
+		return "API"
+	case "event":
+		return "Event"
+	default:
+		return "Universal"
+	}
+}
+
+// GetReconnectIntervalMin 获取反向ws重连的初始间隔,单位秒
+func GetReconnectIntervalMin() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ReconnectIntervalMin value.")
+		return 1
+	}
+	if instance.Settings.ReconnectIntervalMin <= 0 {
+		return 1
+	}
+	return instance.Settings.ReconnectIntervalMin
+}
+
+// GetReconnectIntervalMax 获取反向ws重连间隔的上限,单位秒
+func GetReconnectIntervalMax() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ReconnectIntervalMax value.")
+		return 60
+	}
+	if instance.Settings.ReconnectIntervalMax <= 0 {
+		return 60
+	}
+	return instance.Settings.ReconnectIntervalMax
+}
+
+// GetReconnectRedial 获取放弃重连后后台重新连接的间隔,单位秒,0为不再尝试
+func GetReconnectRedial() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ReconnectRedial value.")
+		return 300
+	}
+	return instance.Settings.ReconnectRedial
+}
+
+// GetMetricsToken 获取/metrics的token
+func GetMetricsToken() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to MetricsToken value.")
+		return ""
+	}
+	return instance.Settings.MetricsToken
+}
+
+// GetStatsRetentionDays 获取历史统计的保留天数
+func GetStatsRetentionDays() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to StatsRetentionDays value.")
+		return 0
+	}
+	return instance.Settings.StatsRetentionDays
+}
+
+// GetLogFormat 获取日志格式
+func GetLogFormat() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to LogFormat value.")
+		return ""
+	}
+	return instance.Settings.LogFormat
+}
+
+// GetLogMaxSizeMB 获取单个日志文件的最大大小(MB)
+func GetLogMaxSizeMB() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to LogMaxSizeMB value.")
+		return 0
+	}
+	return instance.Settings.LogMaxSizeMB
+}
+
+// GetLogMaxFiles 获取保留的日志文件数量
+func GetLogMaxFiles() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to LogMaxFiles value.")
+		return 0
+	}
+	return instance.Settings.LogMaxFiles
+}
+
+// GetLogMaxAgeDays 获取日志文件保留天数
+func GetLogMaxAgeDays() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to LogMaxAgeDays value.")
+		return 0
+	}
+	return instance.Settings.LogMaxAgeDays
+}
+
+// GetLogCompress 获取是否压缩切分后的日志文件
+func GetLogCompress() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to LogCompress value.")
+		return false
+	}
+	return instance.Settings.LogCompress
+}
+
+// GetHealthzComponents 获取存活检查中必须健康的组件
+func GetHealthzComponents() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to HealthzComponents value.")
+		return nil
+	}
+	return instance.Settings.HealthzComponents
+}
+
+// GetReadyzComponents 获取就绪检查中必须健康的组件
+func GetReadyzComponents() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ReadyzComponents value.")
+		return nil
+	}
+	return instance.Settings.ReadyzComponents
+}
+
+// GetSessionResumeWindow 获取重启后尝试resume网关session的时间窗口,单位秒
+func GetSessionResumeWindow() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to SessionResumeWindow value.")
+		return 0
+	}
+	return instance.Settings.SessionResumeWindow
+}
+
+// GetShardCoordinator 获取分片协调方式
+func GetShardCoordinator() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ShardCoordinator value.")
+		return ""
+	}
+	return instance.Settings.ShardCoordinator
+}
+
+// GetShardCoordinatorPath 获取bolt分片租约文件路径
+func GetShardCoordinatorPath() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ShardCoordinatorPath value.")
+		return ""
+	}
+	return instance.Settings.ShardCoordinatorPath
+}
+
+// GetShardRedisAddr 获取分片协调的redis地址
+func GetShardRedisAddr() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ShardRedisAddr value.")
+		return ""
+	}
+	return instance.Settings.ShardRedisAddr
+}
+
+// GetShardRedisPassword 获取分片协调的redis密码
+func GetShardRedisPassword() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ShardRedisPassword value.")
+		return ""
+	}
+	return instance.Settings.ShardRedisPassword
+}
+
+// GetShardRedisDB 获取分片协调的redis数据库编号
+func GetShardRedisDB() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ShardRedisDB value.")
+		return 0
+	}
+	return instance.Settings.ShardRedisDB
+}
+
+// GetShardLeaseTTL 获取分片租约的有效期,单位秒
+func GetShardLeaseTTL() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to ShardLeaseTTL value.")
+		return 0
+	}
+	return instance.Settings.ShardLeaseTTL
+}
+
+// GetDedupTTL 获取事件去重的时间窗口,单位秒
+func GetDedupTTL() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to DedupTTL value.")
+		return 0
+	}
+	return instance.Settings.DedupTTL
+}
+
+// GetWebhookWorkers 获取处理webhook事件的worker数
+func GetWebhookWorkers() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WebhookWorkers value.")
+		return 0
+	}
+	return instance.Settings.WebhookWorkers
+}
+
+// GetWebhookQueueSize 获取所有worker共享的webhook事件队列长度
+func GetWebhookQueueSize() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WebhookQueueSize value.")
+		return 0
+	}
+	return instance.Settings.WebhookQueueSize
+}
+
+// GetWebhookOverflow 获取webhook队列已满时的处理方式
+func GetWebhookOverflow() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		fmt.Println("Warning: instance is nil when trying to WebhookOverflow value.")
+		return ""
+	}
+	return instance.Settings.WebhookOverflow
+}
@@ -0,0 +1,111 @@
+// Package dedup 按事件id与信息id在时间窗口内丢弃重复收到的事件
+// UnionFanout转发与网关会话同时投递,或官方平台重发webhook时,同一个事件会收到两次
+package dedup
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/metrics"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/event"
+	"github.com/tidwall/gjson"
+)
+
+// 清理过期记录的间隔
+const cleanupInterval = time.Minute
+
+// dedup_ttl为0时,群@信息仍按信息id在该时间内去重,与原有的行为一致
+const groupATMessageTTL = 5 * time.Minute
+
+var (
+	mu        sync.Mutex
+	seen      = make(map[string]time.Time) // key => 过期时间
+	startOnce sync.Once
+)
+
+// Register 在webhook与网关事件投递给handler之前检查重复
+func Register() {
+	event.RegisterDuplicateFilter(IsDuplicate)
+	startOnce.Do(func() {
+		go cleanup()
+	})
+}
+
+// keys 事件的去重key,外层的事件id,以及信息类事件的信息id
+// 信息id只用于信息类事件,频道等事件的d.id是频道号,不同的事件会相同
+func keys(payload *dto.WSPayload) []string {
+	var result []string
+	if eventID := gjson.GetBytes(payload.RawMessage, "id").String(); eventID != "" {
+		result = append(result, "event:"+eventID)
+	}
+	eventType := string(payload.Type)
+	if strings.HasSuffix(eventType, "MESSAGE_CREATE") || payload.Type == dto.EventInteractionCreate {
+		if msgID := gjson.GetBytes(payload.RawMessage, "d.id").String(); msgID != "" {
+			result = append(result, "msg:"+eventType+":"+msgID)
+		}
+	}
+	return result
+}
+
+// IsDuplicate 事件的任一去重key在dedup_ttl秒内出现过时返回true,并记录到指标
+// dedup_ttl为0时只对群@信息按信息id去重
+func IsDuplicate(payload *dto.WSPayload) bool {
+	if payload.OPCode != dto.WSDispatchEvent {
+		return false
+	}
+	ttl := time.Duration(config.GetDedupTTL()) * time.Second
+	var eventKeys []string
+	if ttl > 0 {
+		eventKeys = keys(payload)
+	} else if payload.Type == dto.EventGroupAtMessageCreate {
+		ttl = groupATMessageTTL
+		if msgID := gjson.GetBytes(payload.RawMessage, "d.id").String(); msgID != "" {
+			eventKeys = []string{"msg:" + string(payload.Type) + ":" + msgID}
+		}
+	}
+	if len(eventKeys) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	mu.Lock()
+	duplicate := ""
+	for _, key := range eventKeys {
+		if expire, ok := seen[key]; ok && expire.After(now) {
+			duplicate = key
+			break
+		}
+	}
+	if duplicate == "" {
+		for _, key := range eventKeys {
+			seen[key] = now.Add(ttl)
+		}
+	}
+	mu.Unlock()
+
+	if duplicate == "" {
+		return false
+	}
+	metrics.EventDuplicate(string(payload.Type))
+	mylog.WithTrace(payload.TraceID).Printf("丢弃重复收到的事件 %s, %s", payload.Type, duplicate)
+	return true
+}
+
+func cleanup() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		mu.Lock()
+		for key, expire := range seen {
+			if !expire.After(now) {
+				delete(seen, key)
+			}
+		}
+		mu.Unlock()
+	}
+}
@@ -370,3 +370,28 @@ func StopCleanupRoutine() {
 		cleanupTicker.Stop()
 	}
 }
+
+// CacheSizes 返回各内存映射当前的条目数,用于监控
+func CacheSizes() map[string]int {
+	globalMessageGroupStack.mu.Lock()
+	stackLen := len(globalMessageGroupStack.stack)
+	globalMessageGroupStack.mu.Unlock()
+	return map[string]int{
+		"msg_type":      syncMapLen(&globalEchoMapping.msgTypeMapping),
+		"msg_id":        syncMapLen(&globalEchoMapping.msgIDMapping),
+		"event_id":      syncMapLen(&globalEchoMapping.eventIDMapping),
+		"int64_mapping": syncMapLen(&globalInt64ToIntMapping.mapping),
+		"seq_mapping":   syncMapLen(&globalStringToIntMappingSeq.mapping),
+		"memory_msgid":  syncMapLen(&globalSyncMapMsgid),
+		"group_stack":   stackLen,
+	}
+}
+
+func syncMapLen(m *sync.Map) int {
+	n := 0
+	m.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
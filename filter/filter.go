@@ -0,0 +1,320 @@
+// 事件过滤器,兼容go-cqhttp的filter.json规则,为每个连接单独筛选需要上报的事件
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// Filter 一条过滤规则,nil Filter 允许所有事件
+type Filter struct {
+	op       string
+	key      string // 字段名,为空时作用于当前值
+	children []*Filter
+	value    interface{}
+	regex    *regexp.Regexp
+}
+
+// fileCheckInterval 规则文件的修改时间最多每隔这么久检查一次
+const fileCheckInterval = time.Second
+
+// cached 缓存的过滤规则,f为nil表示规则有误
+type cached struct {
+	f         *Filter
+	modTime   time.Time // 规则文件的修改时间,json字符串为零值
+	checkedAt time.Time
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*cached)
+)
+
+// Match 按规则判断事件是否需要上报,spec为过滤规则文件路径或json字符串,为空时总是上报
+func Match(spec string, event map[string]interface{}) bool {
+	if strings.TrimSpace(spec) == "" {
+		return true
+	}
+	f, err := load(spec)
+	if err != nil {
+		// 规则有误时不过滤,避免丢失事件
+		return true
+	}
+	return f.Match(event)
+}
+
+// load 加载并缓存过滤规则,规则错误时同样缓存,避免每个事件都重复报错
+// 规则文件的修改时间变化后重新加载
+func load(spec string) (*Filter, error) {
+	isFile := !strings.HasPrefix(strings.TrimSpace(spec), "{")
+	now := time.Now()
+
+	cacheMu.Lock()
+	c, ok := cache[spec]
+	if ok && (!isFile || now.Sub(c.checkedAt) < fileCheckInterval) {
+		cacheMu.Unlock()
+		return c.result(spec)
+	}
+	cacheMu.Unlock()
+
+	var modTime time.Time
+	if isFile {
+		if info, err := os.Stat(strings.TrimSpace(spec)); err == nil {
+			modTime = info.ModTime()
+		}
+		if ok && modTime.Equal(c.modTime) {
+			cacheMu.Lock()
+			c.checkedAt = now
+			cacheMu.Unlock()
+			return c.result(spec)
+		}
+	}
+
+	f, err := Load(spec)
+	if err != nil {
+		mylog.Printf("加载事件过滤规则[%s]失败,将不过滤事件: %v", spec, err)
+	} else if ok {
+		mylog.Printf("事件过滤规则[%s]已修改,重新加载", spec)
+	}
+	cacheMu.Lock()
+	cache[spec] = &cached{f: f, modTime: modTime, checkedAt: now}
+	cacheMu.Unlock()
+	return f, err
+}
+
+func (c *cached) result(spec string) (*Filter, error) {
+	if c.f == nil {
+		return nil, fmt.Errorf("invalid filter: %s", spec)
+	}
+	return c.f, nil
+}
+
+// Load 解析过滤规则,spec以{开头时视为json字符串,否则视为规则文件路径
+func Load(spec string) (*Filter, error) {
+	spec = strings.TrimSpace(spec)
+	data := []byte(spec)
+	if !strings.HasPrefix(spec, "{") {
+		var err error
+		data, err = os.ReadFile(spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var rule interface{}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return nil, err
+	}
+	return Parse(rule)
+}
+
+// Parse 解析json规则对象
+func Parse(rule interface{}) (*Filter, error) {
+	obj, ok := rule.(map[string]interface{})
+	if !ok {
+		// 非对象视为与当前值相等
+		return &Filter{op: ".eq", value: rule}, nil
+	}
+	f := &Filter{op: ".and"}
+	for key, value := range obj {
+		child, err := parseKey(key, value)
+		if err != nil {
+			return nil, err
+		}
+		f.children = append(f.children, child)
+	}
+	return f, nil
+}
+
+func parseKey(key string, value interface{}) (*Filter, error) {
+	if !strings.HasPrefix(key, ".") {
+		// 字段名,规则作用于该字段的值
+		child, err := Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{op: ".field", key: key, children: []*Filter{child}}, nil
+	}
+
+	switch key {
+	case ".and":
+		f := &Filter{op: ".and"}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				child, err := Parse(item)
+				if err != nil {
+					return nil, err
+				}
+				f.children = append(f.children, child)
+			}
+		default:
+			child, err := Parse(v)
+			if err != nil {
+				return nil, err
+			}
+			f.children = append(f.children, child)
+		}
+		return f, nil
+	case ".or":
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf(".or 的值必须是数组")
+		}
+		f := &Filter{op: ".or"}
+		for _, item := range items {
+			child, err := Parse(item)
+			if err != nil {
+				return nil, err
+			}
+			f.children = append(f.children, child)
+		}
+		return f, nil
+	case ".not":
+		child, err := Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{op: ".not", children: []*Filter{child}}, nil
+	case ".eq", ".neq":
+		return &Filter{op: key, value: value}, nil
+	case ".in":
+		switch value.(type) {
+		case []interface{}, string:
+			return &Filter{op: ".in", value: value}, nil
+		}
+		return nil, fmt.Errorf(".in 的值必须是数组或字符串")
+	case ".contains":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf(".contains 的值必须是字符串")
+		}
+		return &Filter{op: ".contains", value: s}, nil
+	case ".regex":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf(".regex 的值必须是字符串")
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{op: ".regex", regex: re}, nil
+	}
+	return nil, fmt.Errorf("不支持的运算符: %s", key)
+}
+
+// Match 判断事件是否满足规则
+func (f *Filter) Match(event map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+	return f.eval(event)
+}
+
+func (f *Filter) eval(v interface{}) bool {
+	switch f.op {
+	case ".and":
+		for _, child := range f.children {
+			if !child.eval(v) {
+				return false
+			}
+		}
+		return true
+	case ".or":
+		for _, child := range f.children {
+			if child.eval(v) {
+				return true
+			}
+		}
+		return false
+	case ".not":
+		return !f.children[0].eval(v)
+	case ".field":
+		return f.children[0].eval(fieldOf(v, f.key))
+	case ".eq":
+		return equal(v, f.value)
+	case ".neq":
+		return !equal(v, f.value)
+	case ".in":
+		switch list := f.value.(type) {
+		case []interface{}:
+			for _, item := range list {
+				if equal(v, item) {
+					return true
+				}
+			}
+			return false
+		case string:
+			// 字符串时判断当前值是否为其子串
+			return strings.Contains(list, toString(v))
+		}
+		return false
+	case ".contains":
+		return strings.Contains(toString(v), f.value.(string))
+	case ".regex":
+		return f.regex.MatchString(toString(v))
+	}
+	return false
+}
+
+// fieldOf 取出字段的值,事件中的结构体(如sender)先转换为map
+func fieldOf(v interface{}, key string) interface{} {
+	if obj, ok := v.(map[string]interface{}); ok {
+		return obj[key]
+	}
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil
+	}
+	return obj[key]
+}
+
+// equal 比较两个值,数字和字符串形式的id视为相等
+func equal(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return toString(a) == toString(b)
+}
+
+// toString 将事件字段转换为字符串,用于比较和匹配
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(data)
+	}
+}
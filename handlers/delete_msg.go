@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 
@@ -50,7 +49,7 @@ func DeleteMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 			mylog.Printf("error retrieving real RChannelID: %v", err)
 		}
 		message.Params.ChannelID = RChannelID
-		err = api.RetractMessage(context.TODO(), message.Params.ChannelID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+		err = api.RetractMessage(message.Context(), message.Params.ChannelID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
 		if err != nil {
 			fmt.Println("Error retracting channel message:", err)
 		}
@@ -62,7 +61,7 @@ func DeleteMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 		//这里很复杂 要取的话需要调用internal-api 根据情况还原，虚拟成群就用群（channel-id）还原完整channel-id，
 		//然后internal-api读配置获取guild-id ，虚拟成私信就用userid还原完整userid，然后读channel-id然后读guild-id
 		//因为GuildID本身不直接出现在ob11事件里。
-		err := api.RetractDMMessage(context.TODO(), message.Params.GuildID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+		err := api.RetractDMMessage(message.Context(), message.Params.GuildID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
 		if err != nil {
 			fmt.Println("Error retracting DM message:", err)
 		}
@@ -79,12 +78,12 @@ func DeleteMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 				mylog.Printf("Error retrieving original GroupID: %v", err)
 			}
 			message.Params.GroupID = originalGroupID
-			err = api.RetractGroupMessage(context.TODO(), message.Params.GroupID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+			err = api.RetractGroupMessage(message.Context(), message.Params.GroupID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
 			if err != nil {
 				fmt.Println("Error retracting group message:", err)
 			}
 		} else {
-			err = api.RetractGroupMessage(context.TODO(), message.Params.GroupID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+			err = api.RetractGroupMessage(message.Context(), message.Params.GroupID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
 			if err != nil {
 				fmt.Println("Error retracting group message:", err)
 			}
@@ -98,10 +97,10 @@ func DeleteMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 		UserID, err := idmap.RetrieveRowByIDv2(message.Params.UserID.(string))
 		if err != nil {
 			mylog.Printf("Error reading config: %v", err)
-			return "", nil
+			return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 		}
 		message.Params.UserID = UserID
-		err = api.RetractC2CMessage(context.TODO(), message.Params.UserID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
+		err = api.RetractC2CMessage(message.Context(), message.Params.UserID.(string), message.Params.MessageID.(string), openapi.RetractMessageOptionHidetip)
 		if err != nil {
 			fmt.Println("Error retracting C2C message:", err)
 		}
@@ -37,12 +37,14 @@ func GetAvatar(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 			_, originalUserID, err = idmap.RetrieveRowByIDv2Pro("690426430", message.Params.UserID.(string))
 			if err != nil {
 				mylog.Printf("Error reading private originalUserID: %v", err)
+				return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 			}
 		}
 	} else {
 		originalUserID, err = idmap.RetrieveRowByIDv2(message.Params.UserID.(string))
 		if err != nil {
 			mylog.Printf("Error retrieving original UserID: %v", err)
+			return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 		}
 	}
 
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/botstats"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+type GetBotStatsResponse struct {
+	Data    *BotStatsData `json:"data"`
+	Message string        `json:"message"`
+	RetCode int           `json:"retcode"`
+	Status  string        `json:"status"`
+	Echo    interface{}   `json:"echo"`
+}
+
+type BotStatsData struct {
+	StartTime int64              `json:"start_time"`
+	EndTime   int64              `json:"end_time"`
+	Interval  string             `json:"interval"`
+	Received  uint64             `json:"received"`
+	Sent      uint64             `json:"sent"`
+	Points    []botstats.Point   `json:"points"`
+	TopGroups []BotStatsGroupRow `json:"top_groups"`
+}
+
+type BotStatsGroupRow struct {
+	GroupID     int64  `json:"group_id"` // 映射后的群号(子频道号)
+	RealGroupID string `json:"real_group_id"`
+	MessageType string `json:"message_type"`
+	Received    uint64 `json:"received"`
+	Sent        uint64 `json:"sent"`
+}
+
+// BotStatsQuery get_bot_stats和webui共用的查询参数
+type BotStatsQuery struct {
+	StartTime int64  // unix时间戳,为0时为结束时间前24小时
+	EndTime   int64  // unix时间戳,为0时为当前时间
+	Interval  string // hour或day,为空时为hour
+	GroupID   string // 映射后的群号,为空时统计全部
+	Limit     int    // 返回的活跃群数量,为0时为10
+}
+
+func init() {
+	callapi.RegisterHandler("get_bot_stats", GetBotStats)
+}
+
+func GetBotStats(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	var response GetBotStatsResponse
+	response.Echo = message.Echo
+
+	groupID, _ := message.Params.GroupID.(string)
+	data, err := BotStats(BotStatsQuery{
+		StartTime: message.Params.StartTime,
+		EndTime:   message.Params.EndTime,
+		Interval:  message.Params.Interval,
+		GroupID:   groupID,
+		Limit:     message.Params.Limit,
+	})
+	if err != nil {
+		return "", err
+	}
+	response.Data = data
+	response.Status = "ok"
+	response.RetCode = 0
+
+	outputMap := structToMap(response)
+
+	mylog.Printf("get_bot_stats: %+v\n", outputMap)
+
+	err = client.SendMessage(outputMap)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	//把结果从struct转换为json
+	result, err := json.Marshal(response)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
+}
+
+// BotStats 查询时间范围内的收发趋势和最活跃的群
+func BotStats(query BotStatsQuery) (*BotStatsData, error) {
+	end := time.Now()
+	if query.EndTime > 0 {
+		end = time.Unix(query.EndTime, 0)
+	}
+	start := end.Add(-24 * time.Hour)
+	if query.StartTime > 0 {
+		start = time.Unix(query.StartTime, 0)
+	}
+	if end.Before(start) {
+		return nil, callapi.BadParams("end_time不能早于start_time")
+	}
+	interval := query.Interval
+	if interval == "" {
+		interval = botstats.IntervalHour
+	}
+	if interval != botstats.IntervalHour && interval != botstats.IntervalDay {
+		return nil, callapi.BadParams("interval只能为hour或day")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	var realGroupID string
+	if query.GroupID != "" {
+		var err error
+		realGroupID, err = idmap.RetrieveRowByIDv2(query.GroupID)
+		if err != nil {
+			return nil, callapi.BadParams("group_id不存在")
+		}
+	}
+
+	points, err := botstats.GetHistory(start, end, interval, realGroupID, "")
+	if err != nil {
+		return nil, callapi.UpstreamError("读取统计失败", err)
+	}
+	groups, err := botstats.GetTopGroups(start, end, limit)
+	if err != nil {
+		return nil, callapi.UpstreamError("读取统计失败", err)
+	}
+
+	data := &BotStatsData{
+		StartTime: start.Unix(),
+		EndTime:   end.Unix(),
+		Interval:  interval,
+		Points:    points,
+		TopGroups: make([]BotStatsGroupRow, 0, len(groups)),
+	}
+	for _, p := range points {
+		data.Received += p.Received
+		data.Sent += p.Sent
+	}
+	for _, g := range groups {
+		// 只读取已有的映射,查询统计不应分配新的群号,没有映射时group_id为0
+		groupID64, err := idmap.RetrieveRowOfIDv2(g.GroupID)
+		if err != nil && err != idmap.ErrKeyNotFound {
+			mylog.Printf("get_bot_stats: 读取群号[%s]的映射失败: %v", g.GroupID, err)
+		}
+		data.TopGroups = append(data.TopGroups, BotStatsGroupRow{
+			GroupID:     groupID64,
+			RealGroupID: g.GroupID,
+			MessageType: g.MessageType,
+			Received:    g.Received,
+			Sent:        g.Sent,
+		})
+	}
+	return data, nil
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"strconv"
 	"time"
@@ -109,15 +108,15 @@ func HandleGetGroupInfo(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		value, err := idmap.ReadConfigv2(RChannelID, "guild_id")
 		if err != nil {
 			mylog.Printf("handleGetGroupInfo:Error reading config: %v\n", err)
-			return "", nil
+			return "", callapi.BadParams("无法找到group_id[%v]对应的guild_id: %v", ChannelID, err)
 		}
 		//最后获取到guildID
 		guildID := value
 		mylog.Printf("调试,准备groupInfoMap(频道)guildID:%v", guildID)
-		guild, err := api.Guild(context.TODO(), guildID)
+		guild, err := api.Guild(message.Context(), guildID)
 		if err != nil {
 			mylog.Printf("获取频道信息失败: %v", err)
-			return "", nil
+			return "", callapi.UpstreamError("获取频道信息失败", err)
 		}
 		groupInfo = ConvertGuildToGroupInfo(guild, guildID, message)
 	default:
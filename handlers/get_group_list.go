@@ -87,7 +87,7 @@ func GetGroupList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 		totalFetched := 0
 
 		for {
-			guilds, err := api.MeGuilds(context.TODO(), pager)
+			guilds, err := api.MeGuilds(message.Context(), pager)
 			if err != nil {
 				mylog.Println("Error fetching guild list:", err)
 				break
@@ -119,10 +119,10 @@ func GetGroupList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 			globalPager = &dto.GuildPager{Limit: guildsLimit}
 		}
 		// 全局pager
-		guilds, err := api.MeGuilds(context.TODO(), globalPager)
+		guilds, err := api.MeGuilds(message.Context(), globalPager)
 		if err != nil {
 			mylog.Println("Error fetching guild list:", err)
-			return "", nil
+			return "", callapi.UpstreamError("获取频道列表失败", err)
 		}
 		if len(guilds) > 0 {
 			// 更新Pager的After为最后一个元素的ID
@@ -132,10 +132,10 @@ func GetGroupList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 		//如果为空 则不使用分页
 		if len(guilds) == 0 {
 			Pager := &dto.GuildPager{Limit: "10"}
-			guilds, err = api.MeGuilds(context.TODO(), Pager)
+			guilds, err = api.MeGuilds(message.Context(), Pager)
 			if err != nil {
 				mylog.Println("Error fetching guild list2:", err)
-				return "", nil
+				return "", callapi.UpstreamError("获取频道列表失败", err)
 			}
 		}
 		for _, guild := range guilds {
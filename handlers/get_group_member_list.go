@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"strconv"
 	"strings"
 	"time"
@@ -50,7 +49,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 	msgType, err := idmap.ReadConfigv2(message.Params.GroupID.(string), "type")
 	if err != nil {
 		mylog.Printf("Error reading config: %v", err)
-		return "", nil
+		return "", callapi.BadParams("无法找到group_id[%v]的类型: %v", message.Params.GroupID, err)
 	}
 
 	switch msgType {
@@ -63,7 +62,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		userIDs, err := idmap.FindSubKeysByIdPro(message.Params.GroupID.(string))
 		if err != nil {
 			mylog.Printf("Error retrieving user IDs: %v", err)
-			return "", nil // 或者处理错误
+			return "", callapi.BadParams("无法从本地获取群[%v]的成员列表: %v", message.Params.GroupID, err)
 		}
 
 		// 获取当前时间的前一天，并转换为10位时间戳
@@ -117,7 +116,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		return string(result), nil
 	case "private":
 		mylog.Printf("getGroupMemberList(private): 目前暂未适配私聊虚拟群场景获取虚拟群列表能力")
-		return "", nil
+		return "", callapi.Unsupported("目前暂未适配私聊虚拟群场景获取虚拟群列表能力")
 	case "guild":
 		//要把group_id还原成guild_id
 		//用group_id还原出channelid 这是虚拟成群的私聊信息
@@ -131,12 +130,12 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		value, err := idmap.ReadConfigv2(RChannelID, "guild_id")
 		if err != nil {
 			mylog.Printf("Error reading config: %v", err)
-			return "", nil
+			return "", callapi.BadParams("无法找到group_id[%v]对应的guild_id: %v", message.Params.GroupID, err)
 		}
 		pager := &dto.GuildMembersPager{
 			Limit: "400",
 		}
-		membersFromAPI, err := api.GuildMembers(context.TODO(), value, pager)
+		membersFromAPI, err := api.GuildMembers(message.Context(), value, pager)
 		if err != nil {
 			mylog.Printf("Failed to fetch group members for guild %s: %v", value, err)
 		}
@@ -150,7 +149,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 			userIDs, err := idmap.FindSubKeysByIdPro(message.Params.ChannelID.(string))
 			if err != nil {
 				mylog.Printf("Error retrieving user IDs: %v", err)
-				return "", nil // 或者处理错误
+				return "", callapi.BadParams("无法从本地获取频道[%v]的成员列表: %v", message.Params.ChannelID, err)
 			}
 			mylog.Printf("返回的userIDs:%v", userIDs)
 			// 获取当前时间的前一天，并转换为10位时间戳
@@ -231,6 +230,10 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		// 	mylog.Printf("Member %d: %+v\n", i+1, *member)
 		// }
 
+		if err != nil {
+			return "", callapi.UpstreamError("获取频道成员列表失败", err)
+		}
+
 		var members []MemberList
 		var userIDUInt uint64
 		var userIDInt64 int64
@@ -263,7 +266,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					userIDInt64, err = idmap.StoreIDv2(memberFromAPI.User.ID)
 					if err != nil {
 						mylog.Printf("Error storing ID 2400: %v", err)
-						return "", nil
+						return "", callapi.UpstreamError("储存成员id失败", err)
 					}
 				}
 			} else {
@@ -351,7 +354,7 @@ func GetGroupMemberList(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 	default:
 		mylog.Printf("Unknown msgType: %s", msgType)
 	}
-	return "", nil
+	return "", callapi.BadParams("未知的group_id类型: %s", msgType)
 }
 
 func buildResponse(members []MemberList, echoValue interface{}) map[string]interface{} {
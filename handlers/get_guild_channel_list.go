@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
@@ -28,12 +27,10 @@ func GetGuildChannelList(client callapi.Client, api openapi.OpenAPI, apiv2 opena
 	guildID := message.Params.GuildID
 
 	// 根据请求参数调用API
-	channels, err := api.Channels(context.TODO(), guildID.(string))
+	channels, err := api.Channels(message.Context(), guildID.(string))
 	if err != nil {
-		// 如果发生错误，记录日志并返回null
 		mylog.Printf("Error fetching channels: %v", err)
-		client.SendMessage(map[string]interface{}{"data": nil})
-		return "", nil
+		return "", callapi.UpstreamError("获取子频道列表失败", err)
 	}
 
 	// 构建响应数据
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
@@ -38,10 +37,10 @@ func GetGuildList(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.Open
 	pager := dto.GuildPager{Limit: "50", After: "0"} // 默认从0开始，取50个
 
 	// 调用 API 获取群组列表
-	guilds, err := api.MeGuilds(context.Background(), &pager)
+	guilds, err := api.MeGuilds(message.Context(), &pager)
 	if err != nil {
 		mylog.Printf("Error fetching guilds: %v", err)
-		return "", nil
+		return "", callapi.UpstreamError("获取频道列表失败", err)
 	}
 
 	// 将获取的群组数据添加到 response 中
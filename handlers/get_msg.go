@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/msgstore"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+type GetMsgResponse struct {
+	Data    *GetMsgData `json:"data"`
+	Message string      `json:"message"`
+	RetCode int         `json:"retcode"`
+	Status  string      `json:"status"`
+	Echo    interface{} `json:"echo"`
+}
+
+type GetMsgData struct {
+	Group       bool        `json:"group"`
+	GroupID     interface{} `json:"group_id,omitempty"`
+	MessageID   interface{} `json:"message_id"`
+	RealID      interface{} `json:"real_id"`
+	MessageType string      `json:"message_type"`
+	Sender      interface{} `json:"sender"`
+	Time        int64       `json:"time"`
+	Message     interface{} `json:"message"`
+	RawMessage  string      `json:"raw_message"`
+}
+
+func init() {
+	callapi.RegisterHandler("get_msg", GetMsg)
+}
+
+func GetMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
+	var response GetMsgResponse
+	response.Echo = message.Echo
+
+	messageID := msgstore.FormatMessageID(message.Params.MessageID)
+	if messageID == "" {
+		return "", callapi.BadParams("message_id不能为空")
+	}
+	record, err := msgstore.GetMessage(messageID)
+	if err != nil {
+		mylog.Printf("get_msg: 获取信息[%s]失败: %v", messageID, err)
+		if errors.Is(err, msgstore.ErrMessageNotFound) {
+			return "", callapi.NotFound("消息不存在或已过期")
+		}
+		return "", callapi.UpstreamError("读取消息失败", err)
+	}
+
+	event := record.Event
+	messageType, _ := event["message_type"].(string)
+	rawMessage, _ := event["raw_message"].(string)
+	var eventTime int64
+	if t, ok := event["time"].(float64); ok {
+		eventTime = int64(t)
+	}
+	response.Data = &GetMsgData{
+		Group:       messageType == "group",
+		GroupID:     event["group_id"],
+		MessageID:   event["message_id"],
+		RealID:      event["message_id"],
+		MessageType: messageType,
+		Sender:      event["sender"],
+		Time:        eventTime,
+		Message:     event["message"],
+		RawMessage:  rawMessage,
+	}
+	response.Status = "ok"
+	response.RetCode = 0
+
+	outputMap := structToMap(response)
+
+	mylog.Printf("get_msg: %+v\n", outputMap)
+
+	err = client.SendMessage(outputMap)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	//把结果从struct转换为json
+	result, err := json.Marshal(response)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/registry"
 	"github.com/tencent-connect/botgo/openapi"
 )
 
@@ -17,8 +18,8 @@ type OnlineClientsResponse struct {
 }
 
 type OnlineClientsData struct {
-	Clients []interface{} `json:"clients"` // It seems you want an empty array for clients
-	TinyID  int64         `json:"tiny_id"`
+	Clients []registry.Info `json:"clients"` // 当前连接正向ws与satori的应用端
+	TinyID  int64           `json:"tiny_id"`
 }
 
 func init() {
@@ -30,7 +31,7 @@ func GetOnlineClients(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.
 	var response OnlineClientsResponse
 
 	response.Data = OnlineClientsData{
-		Clients: make([]interface{}, 0), // Empty array
+		Clients: registry.Default.List(),
 		TinyID:  0,
 	}
 	response.Message = ""
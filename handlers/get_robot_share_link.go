@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"time"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
@@ -42,11 +41,11 @@ func GetRobotShareLink(client callapi.Client, api openapi.OpenAPI, apiv2 openapi
 	// 此时 selfID 最好从配置或 message 中获取，这里演示用 0 或 message.SelfID (如果你的ActionMessage里有)
 	var selfID int64 = int64(config.GetAppID())
 
-	resultData, err := apiv2.GenerateURLLink(context.Background(), req)
+	resultData, err := apiv2.GenerateURLLink(message.Context(), req)
 	if err != nil {
 		mylog.Printf("Error generating robot share link: %v", err)
 		// 如果出错，也可以选择发送一个 notice_type: "share_link_failed"
-		return "", nil // 返回空，不做处理
+		return "", callapi.UpstreamError("生成分享链接失败", err)
 	}
 
 	// 3. 【关键步骤】构建伪造的 Notice 事件
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/hoshinonyaruko/gensokyo/botstats"
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/registry"
 	"github.com/tencent-connect/botgo/openapi"
 )
 
@@ -25,6 +27,10 @@ type StatusData struct {
 	Online         bool       `json:"online"`
 	Good           bool       `json:"good"`
 	Stat           Statistics `json:"stat"`
+	// 各反向ws地址的连接状态,只在get_status中返回
+	ReverseWs []registry.ReverseState `json:"reverse_ws,omitempty"`
+	// 当前实例负责的各网关分片的会话状态,只在get_status中返回
+	Shards []botstats.ShardState `json:"shards,omitempty"`
 }
 
 type Statistics struct {
@@ -46,28 +52,9 @@ func GetStatus(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 
 	var response GetStatusResponse
 
-	messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
-	if err != nil {
-		mylog.Printf("get_status错误,获取机器人发信状态错误:%v", err)
-	}
-	response.Data = StatusData{
-		AppInitialized: true,
-		AppEnabled:     true,
-		PluginsGood:    true,
-		AppGood:        true,
-		Online:         true, //测试数据
-		Good:           true, //测试数据
-		Stat: Statistics{
-			PacketReceived:  1000,            //测试数据
-			PacketSent:      950,             //测试数据
-			PacketLost:      50,              //测试数据
-			MessageReceived: messageReceived, //实际数据
-			MessageSent:     messageSent,     //实际数据
-			DisconnectTimes: 5,               //测试数据
-			LostTimes:       2,               //测试数据
-			LastMessageTime: lastMessageTime, //实际数据
-		},
-	}
+	response.Data = CurrentStatus()
+	response.Data.ReverseWs = registry.ReverseStates()
+	response.Data.Shards = botstats.GatewayShards()
 	response.Message = ""
 	response.RetCode = 0
 	response.Status = "ok"
@@ -77,7 +64,7 @@ func GetStatus(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 
 	mylog.Printf("get_status: %+v\n", outputMap)
 
-	err = client.SendMessage(outputMap)
+	err := client.SendMessage(outputMap)
 	if err != nil {
 		mylog.Printf("Error sending message via client: %v", err)
 	}
@@ -90,3 +77,42 @@ func GetStatus(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI
 	}
 	return string(result), nil
 }
+
+// CurrentStatus 当前的运行状态,get_status和心跳元事件共用
+func CurrentStatus() StatusData {
+	messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
+	if err != nil {
+		mylog.Printf("获取机器人发信状态错误:%v", err)
+	}
+	counters := botstats.GetCounters()
+	return StatusData{
+		AppInitialized: true,
+		AppEnabled:     true,
+		PluginsGood:    true,
+		AppGood:        true,
+		Online:         counters.Online, // 负责的网关分片是否全部在线
+		Good:           counters.Online,
+		Stat: Statistics{
+			PacketReceived:  counters.GatewayEvents, // 收到的网关事件数
+			PacketSent:      counters.APICalls,      // 调用官方api的次数
+			PacketLost:      uint32(counters.APIFailed),
+			MessageReceived: messageReceived,
+			MessageSent:     messageSent,
+			DisconnectTimes: counters.GatewayDisconnects + counters.WsDisconnects, // 网关与反向ws的断开次数
+			LostTimes:       counters.GatewayDisconnects,                          // 网关会话掉线次数
+			LastMessageTime: lastMessageTime,
+		},
+	}
+}
+
+// HeartbeatEvent 构造心跳元事件,interval单位为秒
+func HeartbeatEvent(botID uint64, interval int) map[string]interface{} {
+	return map[string]interface{}{
+		"post_type":       "meta_event",
+		"meta_event_type": "heartbeat",
+		"time":            int(time.Now().Unix()),
+		"self_id":         botID,
+		"status":          structToMap(CurrentStatus()),
+		"interval":        interval * 1000, // 以毫秒为单位
+	}
+}
@@ -4,37 +4,109 @@ import (
 	"strconv"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
 	"github.com/tencent-connect/botgo/openapi"
 )
 
+// 快速操作禁言的默认时长,与go-cqhttp一致
+const defaultQuickBanDuration = 30 * 60
+
 func init() {
 	callapi.RegisterHandler(".handle_quick_operation", Handle_quick_operation)
 }
 
+// Handle_quick_operation 执行快速操作,支持reply at_sender delete ban
+// 各项操作的结果只记录日志,与go-cqhttp一致总是返回成功
 func Handle_quick_operation(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
-	// 使用 CreateSendGroupMsgAction 函数来确定如何处理消息
-	newMsg := CreateSendGroupMsgAction(message)
-	var retmsg string
-	// 根据返回的 ActionMessage 类型调用相应的处理函数
-	if newMsg != nil {
-		switch newMsg.Action {
-		case "send_group_msg":
-			retmsg, _ = HandleSendGroupMsg(client, api, apiv2, *newMsg)
-		case "send_private_msg":
-			retmsg, _ = HandleSendPrivateMsg(client, api, apiv2, *newMsg)
+	operation := message.Params.Operation
+	msgContext := message.Params.Context
+
+	// 回复
+	if hasReply(operation.Reply) {
+		// 使用 CreateSendGroupMsgAction 函数来确定如何处理消息
+		newMsg := CreateSendGroupMsgAction(message)
+		// 根据返回的 ActionMessage 类型调用相应的处理函数
+		if newMsg != nil {
+			var err error
+			switch newMsg.Action {
+			case "send_group_msg":
+				_, err = HandleSendGroupMsg(&callapi.CaptureClient{}, api, apiv2, *newMsg)
+			case "send_private_msg":
+				_, err = HandleSendPrivateMsg(&callapi.CaptureClient{}, api, apiv2, *newMsg)
+			}
+			if err != nil {
+				mylog.Printf("快速操作回复失败: %v", err)
+			}
 		}
 	}
-	return retmsg, nil
+
+	// 撤回
+	if operation.Delete && msgContext.MessageID != 0 {
+		deleteMsg := callapi.ActionMessage{
+			Action: "delete_msg",
+			Params: callapi.ParamsContent{
+				MessageID: strconv.Itoa(msgContext.MessageID),
+			},
+		}
+		switch msgContext.MessageType {
+		case "group":
+			deleteMsg.Params.GroupID = strconv.Itoa(msgContext.GroupID)
+		case "private":
+			deleteMsg.Params.UserID = strconv.Itoa(msgContext.UserID)
+		}
+		if _, err := DeleteMsg(&callapi.CaptureClient{}, api, apiv2, deleteMsg); err != nil {
+			mylog.Printf("快速操作撤回失败: %v", err)
+		}
+	}
+
+	// 禁言
+	if operation.Ban && msgContext.MessageType == "group" {
+		duration := operation.BanDuration
+		if duration <= 0 {
+			duration = defaultQuickBanDuration
+		}
+		banMsg := callapi.ActionMessage{
+			Action: "set_group_ban",
+			Params: callapi.ParamsContent{
+				GroupID:  strconv.Itoa(msgContext.GroupID),
+				UserID:   strconv.Itoa(msgContext.UserID),
+				Duration: duration,
+			},
+		}
+		if _, err := SetGroupBan(&callapi.CaptureClient{}, api, apiv2, banMsg); err != nil {
+			mylog.Printf("快速操作禁言失败: %v", err)
+		}
+	}
+
+	return sendOkResponse(client, ".handle_quick_operation", message.Echo)
+}
+
+// hasReply 判断快速操作是否需要回复
+func hasReply(reply interface{}) bool {
+	switch r := reply.(type) {
+	case nil:
+		return false
+	case string:
+		return r != ""
+	case []interface{}:
+		return len(r) > 0
+	}
+	return true
 }
 
 func CreateSendGroupMsgAction(originalMsg callapi.ActionMessage) *callapi.ActionMessage {
+	reply := originalMsg.Params.Operation.Reply
 	switch originalMsg.Params.Context.MessageType {
 	case "group":
+		// 群聊中at_sender时在回复前at发送者,与go-cqhttp一致未设置时默认at
+		if at := originalMsg.Params.Operation.AtSender; at == nil || *at {
+			reply = atSender(reply, originalMsg.Params.Context.UserID)
+		}
 		return &callapi.ActionMessage{
 			Action: "send_group_msg",
 			Params: callapi.ParamsContent{
 				GroupID: strconv.Itoa(originalMsg.Params.Context.GroupID), // 将int转换为string
-				Message: originalMsg.Params.Operation.Reply,
+				Message: reply,
 			},
 		}
 
@@ -43,7 +115,7 @@ func CreateSendGroupMsgAction(originalMsg callapi.ActionMessage) *callapi.Action
 			Action: "send_private_msg",
 			Params: callapi.ParamsContent{
 				UserID:  strconv.Itoa(originalMsg.Params.Context.UserID), // 将int转换为string
-				Message: originalMsg.Params.Operation.Reply,
+				Message: reply,
 			},
 		}
 
@@ -51,3 +123,19 @@ func CreateSendGroupMsgAction(originalMsg callapi.ActionMessage) *callapi.Action
 		return nil // 或处理其他类型消息的逻辑
 	}
 }
+
+// atSender 在回复内容前加上at发送者
+func atSender(reply interface{}, userID int) interface{} {
+	qq := strconv.Itoa(userID)
+	switch r := reply.(type) {
+	case string:
+		return "[CQ:at,qq=" + qq + "] " + r
+	case []interface{}:
+		at := map[string]interface{}{
+			"type": "at",
+			"data": map[string]interface{}{"qq": qq},
+		}
+		return append([]interface{}{at}, r...)
+	}
+	return reply
+}
@@ -83,6 +83,17 @@ func (c *HttpAPIClient) SendMessage(message map[string]interface{}) error {
 	return nil
 }
 
+// sentStatsTarget 根据参数判断SendResponse发出的信息属于群还是子频道,返回消息类型和真实的群号(子频道号)
+func sentStatsTarget(message *callapi.ActionMessage) (string, string) {
+	if groupID, ok := message.Params.GroupID.(string); ok && groupID != "" {
+		return botstats.MessageTypeGroup, groupID
+	}
+	if channelID, ok := message.Params.ChannelID.(string); ok && channelID != "" {
+		return botstats.MessageTypeGuild, channelID
+	}
+	return botstats.MessageTypePrivate, ""
+}
+
 // 发送成功回执 todo 返回可互转的messageid 实现群撤回api
 func SendResponse(client callapi.Client, err error, message *callapi.ActionMessage, resp *dto.GroupMessageResponse, api openapi.OpenAPI, apiv2 openapi.OpenAPI) (string, error) {
 	var messageID64 int64
@@ -177,7 +188,7 @@ func SendResponse(client callapi.Client, err error, message *callapi.ActionMessa
 
 		response.Data.MessageID = int(messageID64)
 		// 发送成功 增加今日发信息数
-		botstats.RecordMessageSent()
+		botstats.RecordMessageSent(sentStatsTarget(message))
 		//  是否自动撤回
 		if echoStr, ok := message.Echo.(string); ok {
 			msg_on_touch := echo.GetMsgIDv3(config.GetAppIDStr(), echoStr)
@@ -378,7 +389,8 @@ func SendGuildResponse(client callapi.Client, err error, message *callapi.Action
 		}
 		response.Data.MessageID = int(messageID64)
 		// 发送成功 增加今日发信息数
-		botstats.RecordMessageSent()
+		channelID, _ := message.Params.ChannelID.(string)
+		botstats.RecordMessageSent(botstats.MessageTypeGuild, channelID)
 	} else {
 		// Default ID handling
 		response.Data.MessageID = 123
@@ -444,7 +456,7 @@ func SendC2CResponse(client callapi.Client, err error, message *callapi.ActionMe
 		}
 		response.Data.MessageID = int(messageID64)
 		// 发送成功 增加今日发信息数
-		botstats.RecordMessageSent()
+		botstats.RecordMessageSent(botstats.MessageTypePrivate, "")
 	} else {
 		// Default ID handling
 		response.Data.MessageID = 123
@@ -508,6 +520,8 @@ func SendGuildPrivateResponse(client callapi.Client, err error, message *callapi
 			}
 		}
 		response.Data.MessageID = int(messageID64)
+		// 发送成功 增加今日发信息数
+		botstats.RecordMessageSent(botstats.MessageTypeGuildPrivate, "")
 	} else {
 		// Default ID handling
 		response.Data.MessageID = 123
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -31,7 +30,7 @@ func HandlePutInteraction(client callapi.Client, api openapi.OpenAPI, apiv2 open
 	// 解析 ActionMessage 中的 Echo 字段获取 interactionID
 	interactionID, ok := message.Echo.(string)
 	if !ok {
-		return "", fmt.Errorf("echo is not a string")
+		return "", callapi.BadParams("echo必须为字符串形式的interaction id")
 	}
 
 	// 检查字符串是否仅包含数字 将数字形式的interactionID转换为真实的形式
@@ -75,17 +74,17 @@ func HandlePutInteraction(client callapi.Client, api openapi.OpenAPI, apiv2 open
 		code = 5 // 仅管理员操作
 	default:
 		// 如果 PostType 不在预期范围内，可以设置一个默认值或返回错误
-		return "", fmt.Errorf("invalid post type: %s", message.PostType)
+		return "", callapi.BadParams("不合法的post_type: %s", message.PostType)
 	}
 
 	// 构造请求体，包括 code
 	requestBody := fmt.Sprintf(`{"code": %d}`, code)
 
 	// 调用 PutInteraction API
-	ctx := context.Background()
+	ctx := message.Context()
 	err := api.PutInteraction(ctx, interactionID, requestBody)
 	if err != nil {
-		return "", err
+		return "", callapi.UpstreamError("回应按钮回调失败", err)
 	}
 
 	var response InteractionResponse
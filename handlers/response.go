@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+)
+
+// EmptyResponse 不携带数据的成功响应
+type EmptyResponse struct {
+	Data    interface{} `json:"data"`
+	Message string      `json:"message"`
+	RetCode int         `json:"retcode"`
+	Status  string      `json:"status"`
+	Echo    interface{} `json:"echo"`
+}
+
+// sendOkResponse 向应用端发送不携带数据的成功响应
+func sendOkResponse(client callapi.Client, action string, echo interface{}) (string, error) {
+	response := EmptyResponse{
+		Data:    nil,
+		Message: "",
+		RetCode: 0,
+		Status:  "ok",
+		Echo:    echo,
+	}
+	outputMap := structToMap(response)
+
+	mylog.Printf("%s: %+v\n", action, outputMap)
+
+	err := client.SendMessage(outputMap)
+	if err != nil {
+		mylog.Printf("Error sending message via client: %v", err)
+	}
+	result, err := json.Marshal(response)
+	if err != nil {
+		mylog.Printf("Error marshaling data: %v", err)
+		return "", nil
+	}
+	return string(result), nil
+}
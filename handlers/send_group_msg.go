@@ -86,7 +86,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 	if (message.Params.UserID == nil || !checkZeroUserID(message.Params.UserID)) &&
 		(message.Params.GroupID == nil || !checkZeroGroupID(message.Params.GroupID)) {
 		mylog.Printf("send_group_msgs接收到错误action: %v", message)
-		return "", nil
+		return "", callapi.BadParams("group_id和user_id不能同时为空")
 	}
 
 	// 内部逻辑 ProcessGroupAddBot.go 中定义的 通过http和ws无法触发 锁定类型
@@ -183,7 +183,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					originalGroupID, err = idmap.RetrieveRowByIDv2(message.Params.GroupID.(string))
 					if err != nil {
 						mylog.Printf("Error2 retrieving original GroupID: %v", err)
-						return "", nil
+						return "", callapi.BadParams("无法找到group_id[%v]对应的真实id: %v", message.Params.GroupID, err)
 					}
 					mylog.Printf("测试,通过idmaps获取的originalGroupID:%v", originalGroupID)
 				}
@@ -293,7 +293,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 				groupMessage, ok = groupReply.(*dto.MessageToCreate)
 				if !ok {
 					mylog.Printf("Error: Expected RichMediaMessage type for key,value:%v", groupReply)
-					return "", nil
+					return "", fmt.Errorf("生成群消息失败: 未知的消息类型 %T", groupReply)
 				}
 			}
 			var transmd bool
@@ -308,10 +308,10 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 				//如果没有转换成md发送
 				if !transmd {
 					// 上传图片并获取FileInfo
-					fileInfo, err := uploadMedia(context.TODO(), message.Params.GroupID.(string), richMediaMessage, apiv2)
+					fileInfo, err := uploadMedia(message.Context(), message.Params.GroupID.(string), richMediaMessage, apiv2)
 					if err != nil {
 						mylog.Printf("上传图片失败: %v", err)
-						return "", nil // 或其他错误处理
+						return "", callapi.UpstreamError("上传富媒体失败", err)
 					}
 					// 创建包含文本和图像信息的消息
 					msgseq = echo.GetMappingSeq(messageID)
@@ -352,7 +352,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 
 			var resp *dto.GroupMessageResponse
 			// 发送组合消息
-			resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+			resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 			if err != nil {
 				mylog.Printf("发送组合消息失败: %v", err)
 				// 错误保存到本地
@@ -371,7 +371,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 			} else if err != nil && strings.Contains(err.Error(), `"code":40034025`) {
 				// event_id无效的时候
 				groupMessage.EventID = ""
-				resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+				resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 				if err != nil {
 					mylog.Printf("发送组合消息失败: %v", err)
 					// 错误保存到本地
@@ -387,6 +387,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 
 			if !config.GetNoRetMsg() {
 				if config.GetThreadsRetMsg() {
+					callapi.MarkPending(client)
 					if !config.GetStringOb11() {
 						go SendResponse(client, err, &message, resp, api, apiv2)
 					} else {
@@ -418,13 +419,13 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 			groupMessage, ok := groupReply.(*dto.MessageToCreate)
 			if !ok {
 				mylog.Println("Error: Expected MessageToCreate type.")
-				return "", nil // 或其他错误处理
+				return "", fmt.Errorf("生成群消息失败: 未知的消息类型 %T", groupReply)
 			}
 
 			var resp *dto.GroupMessageResponse
 			groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
 			//重新为err赋值
-			resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+			resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 			if err != nil {
 				mylog.Printf("发送文本群组信息失败: %v", err)
 				// 错误保存到本地
@@ -442,7 +443,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 				echo.PushGlobalStack(pair)
 			} else if err != nil && strings.Contains(err.Error(), `"code":40034025`) {
 				groupMessage.EventID = ""
-				resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+				resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 				if err != nil {
 					mylog.Printf("发送文本群组信息失败: %v", err)
 					// 错误保存到本地
@@ -459,6 +460,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 			if !config.GetNoRetMsg() {
 				//发送成功回执
 				if config.GetThreadsRetMsg() {
+					callapi.MarkPending(client)
 					if !config.GetStringOb11() {
 						go SendResponse(client, err, &message, resp, api, apiv2)
 					} else {
@@ -507,10 +509,10 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 						groupMessage, ok := groupReply.(*dto.MessageToCreate)
 						if !ok {
 							mylog.Println("Error: Expected MessageToCreate type.")
-							return "", nil // 或其他错误处理
+							return "", fmt.Errorf("生成群消息失败: 未知的消息类型 %T", groupReply)
 						}
 						//重新为err赋值
-						resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+						resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 						if err != nil {
 							mylog.Printf("发送 MessageToCreate 信息失败: %v", err)
 							// 错误保存到本地
@@ -530,7 +532,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 							//请求参数event_id无效 重试
 							groupMessage.EventID = ""
 							//重新为err赋值
-							resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+							resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 							if err != nil {
 								mylog.Printf("发送 MessageToCreate 信息失败 on code 40034025: %v", err)
 								// 错误保存到本地
@@ -547,6 +549,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 						if !config.GetNoRetMsg() {
 							//发送成功回执
 							if config.GetThreadsRetMsg() {
+								callapi.MarkPending(client)
 								if !config.GetStringOb11() {
 									go SendResponse(client, err, &message, resp, api, apiv2)
 								} else {
@@ -565,7 +568,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					}
 					continue // 跳过这个项，继续下一个
 				}
-				message_return, err := apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), richMediaMessage)
+				message_return, err := apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), richMediaMessage)
 				if err != nil {
 					mylog.Printf("发送 richMediaMessage 信息失败: %v", err)
 					// 错误保存到本地
@@ -595,7 +598,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 					}
 					groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
 					//重新为err赋值
-					resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+					resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 					if err != nil {
 						mylog.Printf("发送图片失败: %v", err)
 						// 错误保存到本地
@@ -613,7 +616,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 						echo.PushGlobalStack(pair)
 					} else if err != nil && strings.Contains(err.Error(), `"code":40034025`) {
 						groupMessage.EventID = ""
-						resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+						resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 						if err != nil {
 							mylog.Printf("发送图片失败: %v", err)
 						}
@@ -625,6 +628,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 				if !config.GetNoRetMsg() {
 					//发送成功回执
 					if config.GetThreadsRetMsg() {
+						callapi.MarkPending(client)
 						if !config.GetStringOb11() {
 							go SendResponse(client, err, &message, resp, api, apiv2)
 						} else {
@@ -670,7 +674,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		Vuserid, ok := message.Params.UserID.(string)
 		if !ok {
 			mylog.Printf("Error illegal UserID")
-			return "", nil
+			return "", callapi.BadParams("user_id[%v]不合法", message.Params.UserID)
 		}
 		if Vuserid != "" && config.GetIdmapPro() {
 			RChannelID, _, err = idmap.RetrieveRowByIDv2Pro(message.Params.ChannelID.(string), Vuserid)
@@ -686,7 +690,7 @@ func HandleSendGroupMsg(client callapi.Client, api openapi.OpenAPI, apiv2 openap
 		value, err := idmap.ReadConfigv2(RChannelID, "guild_id")
 		if err != nil {
 			mylog.Printf("Error reading config: %v", err)
-			return "", nil
+			return "", callapi.BadParams("无法找到group_id[%v]对应的guild_id: %v", message.Params.GroupID, err)
 		}
 		retmsg, _ = HandleSendGuildChannelPrivateMsg(client, api, apiv2, message, &value, &RChannelID)
 	case "group_private":
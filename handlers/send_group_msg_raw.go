@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"context"
+	"fmt"
 	"regexp"
 	"strings"
 	"time"
@@ -75,7 +75,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 	if (message.Params.UserID == nil || !checkZeroUserID(message.Params.UserID)) &&
 		(message.Params.GroupID == nil || !checkZeroGroupID(message.Params.GroupID)) {
 		mylog.Printf("send_group_msgs接收到错误action: %v", message)
-		return "", nil
+		return "", callapi.BadParams("group_id和user_id不能同时为空")
 	}
 
 	mylog.Printf("send_group_msg获取到信息类型:%v", msgType)
@@ -136,7 +136,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 					originalGroupID, err = idmap.RetrieveRowByIDv2(message.Params.GroupID.(string))
 					if err != nil {
 						mylog.Printf("Error2 retrieving original GroupID: %v", err)
-						return "", nil
+						return "", callapi.BadParams("无法找到group_id[%v]对应的真实id: %v", message.Params.GroupID, err)
 					}
 					mylog.Printf("测试,通过idmaps获取的originalGroupID:%v", originalGroupID)
 				}
@@ -236,7 +236,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			richMediaMessage, ok := groupReply.(*dto.RichMediaMessage)
 			if !ok {
 				mylog.Printf("Error: Expected RichMediaMessage type for key ")
-				return "", nil
+				return "", fmt.Errorf("生成群消息失败: 未知的消息类型 %T", groupReply)
 			}
 			var groupMessage *dto.MessageToCreate
 			var transmd bool
@@ -250,10 +250,10 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			//如果没有转换成md发送
 			if !transmd {
 				// 上传图片并获取FileInfo
-				fileInfo, err := uploadMedia(context.TODO(), message.Params.GroupID.(string), richMediaMessage, apiv2)
+				fileInfo, err := uploadMedia(message.Context(), message.Params.GroupID.(string), richMediaMessage, apiv2)
 				if err != nil {
 					mylog.Printf("上传图片失败: %v", err)
-					return "", nil // 或其他错误处理
+					return "", callapi.UpstreamError("上传富媒体失败", err)
 				}
 				// 创建包含文本和图像信息的消息
 				msgseq = echo.GetMappingSeq(messageID)
@@ -285,7 +285,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 
 			}
 			// 发送组合消息
-			resp, err := apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+			resp, err := apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 			if err != nil {
 				mylog.Printf("发送组合消息失败: %v", err)
 			}
@@ -300,6 +300,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			if !config.GetNoRetMsg() {
 				// 发送成功回执
 				if config.GetThreadsRetMsg() {
+					callapi.MarkPending(client)
 					go SendResponse(client, err, &message, resp, api, apiv2)
 				} else {
 					retmsg, _ = SendResponse(client, err, &message, resp, api, apiv2)
@@ -321,12 +322,12 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			groupMessage, ok := groupReply.(*dto.MessageToCreate)
 			if !ok {
 				mylog.Println("Error: Expected MessageToCreate type.")
-				return "", nil // 或其他错误处理
+				return "", fmt.Errorf("生成群消息失败: 未知的消息类型 %T", groupReply)
 			}
 
 			groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
 			//重新为err赋值
-			resp, err := apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+			resp, err := apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 			if err != nil {
 				mylog.Printf("发送文本群组信息失败: %v", err)
 			}
@@ -341,6 +342,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 			if !config.GetNoRetMsg() {
 				//发送成功回执
 				if config.GetThreadsRetMsg() {
+					callapi.MarkPending(client)
 					go SendResponse(client, err, &message, resp, api, apiv2)
 				} else {
 					retmsg, _ = SendResponse(client, err, &message, resp, api, apiv2)
@@ -367,10 +369,10 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 						groupMessage, ok := groupReply.(*dto.MessageToCreate)
 						if !ok {
 							mylog.Println("Error: Expected MessageToCreate type.")
-							return "", nil // 或其他错误处理
+							return "", fmt.Errorf("生成群消息失败: 未知的消息类型 %T", groupReply)
 						}
 						//重新为err赋值
-						resp, err := apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+						resp, err := apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 						if err != nil {
 							mylog.Printf("发送md信息失败: %v", err)
 						}
@@ -385,6 +387,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 						if !config.GetNoRetMsg() {
 							//发送成功回执
 							if config.GetThreadsRetMsg() {
+								callapi.MarkPending(client)
 								go SendResponse(client, err, &message, resp, api, apiv2)
 							} else {
 								//发送成功回执
@@ -395,7 +398,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 					}
 					continue // 跳过这个项，继续下一个
 				}
-				message_return, err := apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), richMediaMessage)
+				message_return, err := apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), richMediaMessage)
 				if err != nil {
 					mylog.Printf("发送 richMediaMessage 信息失败: %v", err)
 					// 错误保存到本地
@@ -424,7 +427,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 					}
 					groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
 					//重新为err赋值
-					resp, err = apiv2.PostGroupMessage(context.TODO(), message.Params.GroupID.(string), groupMessage)
+					resp, err = apiv2.PostGroupMessage(message.Context(), message.Params.GroupID.(string), groupMessage)
 					if err != nil {
 						mylog.Printf("发送图片失败: %v", err)
 					}
@@ -440,6 +443,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 				if !config.GetNoRetMsg() {
 					//发送成功回执
 					if config.GetThreadsRetMsg() {
+						callapi.MarkPending(client)
 						go SendResponse(client, err, &message, resp, api, apiv2)
 					} else {
 						//发送成功回执
@@ -476,7 +480,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 		Vuserid, ok := message.Params.UserID.(string)
 		if !ok {
 			mylog.Printf("Error illegal UserID")
-			return "", nil
+			return "", callapi.BadParams("user_id[%v]不合法", message.Params.UserID)
 		}
 		if Vuserid != "" && config.GetIdmapPro() {
 			RChannelID, _, err = idmap.RetrieveRowByIDv2Pro(message.Params.ChannelID.(string), Vuserid)
@@ -492,7 +496,7 @@ func HandleSendGroupMsgRaw(client callapi.Client, api openapi.OpenAPI, apiv2 ope
 		value, err := idmap.ReadConfigv2(RChannelID, "guild_id")
 		if err != nil {
 			mylog.Printf("Error reading config: %v", err)
-			return "", nil
+			return "", callapi.BadParams("无法找到group_id[%v]对应的guild_id: %v", message.Params.GroupID, err)
 		}
 		retmsg, _ = HandleSendGuildChannelPrivateMsg(client, api, apiv2, message, &value, &RChannelID)
 	case "group_private":
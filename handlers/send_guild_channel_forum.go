@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -74,7 +73,7 @@ func HandleSendGuildChannelForum(client callapi.Client, api openapi.OpenAPI, api
 	if (message.Params.UserID == nil || !checkZeroUserID(message.Params.UserID)) &&
 		(message.Params.GroupID == nil || !checkZeroGroupID(message.Params.GroupID)) {
 		mylog.Printf("send_group_msgs接收到错误action: %v", message)
-		return "", nil
+		return "", callapi.BadParams("group_id和user_id不能同时为空")
 	}
 
 	//当不转换频道信息时(不支持频道私聊)
@@ -96,7 +95,7 @@ func HandleSendGuildChannelForum(client callapi.Client, api openapi.OpenAPI, api
 		if err != nil {
 			mylog.Printf("组合帖子信息失败: %v", err)
 		}
-		if _, err = api.PostFourm(context.TODO(), channelID.(string), Forum); err != nil {
+		if _, err = api.PostFourm(message.Context(), channelID.(string), Forum); err != nil {
 			mylog.Printf("发送帖子信息失败: %v", err)
 		}
 
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/base64"
 	"io"
 	"net/http"
@@ -79,7 +78,7 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 	if (message.Params.UserID == nil || !checkZeroUserID(message.Params.UserID)) &&
 		(message.Params.GroupID == nil || !checkZeroGroupID(message.Params.GroupID)) {
 		mylog.Printf("send_group_msgs接收到错误action: %v", message)
-		return "", nil
+		return "", callapi.BadParams("group_id和user_id不能同时为空")
 	}
 	//当不转换频道信息时(不支持频道私聊)
 	if msgType == "" {
@@ -182,11 +181,11 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 					newMessage.Markdown = md
 					newMessage.Keyboard = kb
 					newMessage.MsgType = 2 //md信息
-					if _, err = api.PostMessage(context.TODO(), channelID.(string), newMessage); err != nil {
+					if _, err = api.PostMessage(message.Context(), channelID.(string), newMessage); err != nil {
 						mylog.Printf("发送图文混合信息失败: %v", err)
 					}
 				} else {
-					if _, err = api.PostMessage(context.TODO(), channelID.(string), newMessage); err != nil {
+					if _, err = api.PostMessage(message.Context(), channelID.(string), newMessage); err != nil {
 						mylog.Printf("发送图文混合信息失败: %v", err)
 					}
 				}
@@ -215,7 +214,7 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 								mylog.Printf("Error compressing image: %v", err)
 							}
 							// 使用 Multipart 方法发送
-							if _, err = api.PostMessageMultipart(context.TODO(), channelID.(string), newMessage, compressedData); err != nil {
+							if _, err = api.PostMessageMultipart(message.Context(), channelID.(string), newMessage, compressedData); err != nil {
 								mylog.Printf("40003重试,使用 multipart 发送图文混合信息失败: %v message_id %v", err, messageID)
 							}
 						}
@@ -243,7 +242,7 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 				}
 				newMessage.Timestamp = time.Now().Unix() // 设置时间戳
 				// 使用Multipart方法发送
-				if resp, err = api.PostMessageMultipart(context.TODO(), channelID.(string), newMessage, compressedData); err != nil {
+				if resp, err = api.PostMessageMultipart(message.Context(), channelID.(string), newMessage, compressedData); err != nil {
 					mylog.Printf("使用multipart发送图文信息失败: %v message_id %v", err, messageID)
 				}
 			}
@@ -259,7 +258,7 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 			msgseq := echo.GetMappingSeq(messageID)
 			echo.AddMappingSeq(messageID, msgseq+1)
 			textMsg, _ := GenerateReplyMessage(messageID, nil, messageText, msgseq+1)
-			if resp, err = api.PostMessage(context.TODO(), channelID.(string), textMsg); err != nil {
+			if resp, err = api.PostMessage(message.Context(), channelID.(string), textMsg); err != nil {
 				mylog.Printf("发送文本信息失败: %v", err)
 			}
 			//发送成功回执
@@ -290,13 +289,13 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 						mylog.Printf("Error compressing image: %v", err)
 					}
 					// 使用Multipart方法发送
-					if resp, err = api.PostMessageMultipart(context.TODO(), channelID.(string), reply, compressedData); err != nil {
+					if resp, err = api.PostMessageMultipart(message.Context(), channelID.(string), reply, compressedData); err != nil {
 						mylog.Printf("使用multipart发送 %s 信息失败: %v message_id %v", key, err, messageID)
 					}
 					//发送成功回执
 					retmsg, _ = SendGuildResponse(client, err, &message, resp)
 				} else {
-					if _, err = api.PostMessage(context.TODO(), channelID.(string), reply); err != nil {
+					if _, err = api.PostMessage(message.Context(), channelID.(string), reply); err != nil {
 						mylog.Printf("发送 %s 信息失败: %v", key, err)
 					}
 					// 检查是否是 40003 错误
@@ -323,7 +322,7 @@ func HandleSendGuildChannelMsg(client callapi.Client, api openapi.OpenAPI, apiv2
 									mylog.Printf("Error compressing image: %v", err)
 								}
 								// 使用 Multipart 方法发送
-								if resp, err = api.PostMessageMultipart(context.TODO(), channelID.(string), reply, compressedData); err != nil {
+								if resp, err = api.PostMessageMultipart(message.Context(), channelID.(string), reply, compressedData); err != nil {
 									mylog.Printf("40003重试,使用 multipart 发送 %s 信息失败: %v message_id %v", key, err, messageID)
 								}
 							}
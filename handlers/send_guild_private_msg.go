@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/base64"
 	"fmt"
 	"time"
@@ -74,7 +73,7 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 				guildID, channelID, err = getGuildIDFromMessagev2(message)
 				if err != nil {
 					mylog.Printf("获取 guild_id 和 channel_id 出错,重试失败: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%s]对应的guild_id和channel_id: %v", RawUserID, err)
 				}
 			}
 			//频道私信 转 私信
@@ -82,14 +81,14 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 				_, UserID, err = idmap.RetrieveRowByIDv2Pro(GroupID, RawUserID)
 				if err != nil {
 					mylog.Printf("Error reading config: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%s]对应的真实id: %v", RawUserID, err)
 				}
 				mylog.Printf("测试,通过Proid获取的UserID:%v", UserID)
 			} else {
 				UserID, err = idmap.RetrieveRowByIDv2(RawUserID)
 				if err != nil {
 					mylog.Printf("Error reading config: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%s]对应的真实id: %v", RawUserID, err)
 				}
 			}
 			// 如果messageID为空，通过函数获取
@@ -103,14 +102,14 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 				_, UserID, err = idmap.RetrieveRowByIDv2Pro(GroupID, RawUserID)
 				if err != nil {
 					mylog.Printf("Error reading config: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%s]对应的真实id: %v", RawUserID, err)
 				}
 				mylog.Printf("测试,通过Proid获取的UserID:%v", UserID)
 			} else {
 				UserID, err = idmap.RetrieveRowByIDv2(RawUserID)
 				if err != nil {
 					mylog.Printf("Error reading config: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%s]对应的真实id: %v", RawUserID, err)
 				}
 			}
 			// 如果messageID为空，通过函数获取
@@ -125,12 +124,12 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 			guildID, err = idmap.ReadConfigv2(GroupID, "guild_id")
 			if err != nil {
 				mylog.Printf("根据GroupID获取guild_id失败: %v", err)
-				return "", nil
+				return "", callapi.BadParams("无法找到group_id[%s]对应的guild_id: %v", GroupID, err)
 			}
 			channelID, err = idmap.RetrieveRowByIDv2(GroupID)
 			if err != nil {
 				mylog.Printf("根据GroupID获取channelID失败: %v", err)
-				return "", nil
+				return "", callapi.BadParams("无法找到group_id[%s]对应的channel_id: %v", GroupID, err)
 			}
 			//频道私信 转 群聊 获取id
 			var originalGroupID string
@@ -138,14 +137,14 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 				_, originalGroupID, err = idmap.RetrieveRowByIDv2Pro(channelID, GroupID)
 				if err != nil {
 					mylog.Printf("Error retrieving original GroupID: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到group_id[%s]对应的真实id: %v", GroupID, err)
 				}
 				mylog.Printf("测试,通过Proid获取的originalGroupID:%v", originalGroupID)
 			} else {
 				originalGroupID, err = idmap.RetrieveRowByIDv2(message.Params.GroupID.(string))
 				if err != nil {
 					mylog.Printf("Error retrieving original GroupID: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到group_id[%s]对应的真实id: %v", GroupID, err)
 				}
 			}
 			mylog.Println("群组(私信虚拟成的)发信息messageText:", messageText)
@@ -202,7 +201,7 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 		msgseq := echo.GetMappingSeq(messageID)
 		echo.AddMappingSeq(messageID, msgseq+1)
 		textMsg, _ := GenerateReplyMessage(messageID, nil, messageText, msgseq+1)
-		if resp, err = apiv2.PostDirectMessage(context.TODO(), dm, textMsg); err != nil {
+		if resp, err = apiv2.PostDirectMessage(message.Context(), dm, textMsg); err != nil {
 			mylog.Printf("发送文本信息失败: %v", err)
 		}
 		//发送成功回执
@@ -232,13 +231,13 @@ func HandleSendGuildChannelPrivateMsg(client callapi.Client, api openapi.OpenAPI
 				if err != nil {
 					mylog.Printf("Error compressing image: %v", err)
 				}
-				if resp, err = api.PostDirectMessageMultipart(context.TODO(), dm, reply, compressedData); err != nil {
+				if resp, err = api.PostDirectMessageMultipart(message.Context(), dm, reply, compressedData); err != nil {
 					mylog.Printf("使用multipart发送 %s 信息失败: %v message_id %v", key, err, messageID)
 				}
 				retmsg, _ = SendGuildResponse(client, err, &message, resp)
 			} else {
 				// 处理非 Base64 图片的逻辑
-				if _, err = api.PostDirectMessage(context.TODO(), dm, reply); err != nil {
+				if _, err = api.PostDirectMessage(message.Context(), dm, reply); err != nil {
 					mylog.Printf("发送 %s 信息失败: %v", key, err)
 				}
 				retmsg, _ = SendGuildPrivateResponse(client, err, &message, resp, guildID)
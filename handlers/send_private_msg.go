@@ -75,7 +75,7 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 	if (message.Params.UserID == nil || !checkZeroUserID(message.Params.UserID)) &&
 		(message.Params.GroupID == nil || !checkZeroGroupID(message.Params.GroupID)) {
 		mylog.Printf("send_group_msgs接收到错误action: %v", message)
-		return "", nil
+		return "", callapi.BadParams("group_id和user_id不能同时为空")
 	}
 
 	var idInt64 int64
@@ -123,7 +123,7 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 				_, UserID, err = idmap.RetrieveRowByIDv2Pro("690426430", message.Params.UserID.(string))
 				if err != nil {
 					mylog.Printf("Error reading config: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 				}
 				mylog.Printf("测试,通过Proid获取的UserID:%v", UserID)
 			} else {
@@ -131,7 +131,7 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 				UserID, err = idmap.RetrieveRowByIDv2(message.Params.UserID.(string))
 				if err != nil {
 					mylog.Printf("Error reading config: %v", err)
-					return "", nil
+					return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 				}
 			}
 		} else {
@@ -209,13 +209,13 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 			richMediaMessage, ok := groupReply.(*dto.RichMediaMessage)
 			if !ok {
 				mylog.Printf("Error: Expected RichMediaMessage type for key ")
-				return "", nil
+				return "", fmt.Errorf("生成私聊消息失败: 未知的消息类型 %T", groupReply)
 			}
 			// 上传图片并获取FileInfo
-			fileInfo, err := uploadMediaPrivate(context.TODO(), UserID, richMediaMessage, apiv2)
+			fileInfo, err := uploadMediaPrivate(message.Context(), UserID, richMediaMessage, apiv2)
 			if err != nil {
 				mylog.Printf("上传图片失败: %v", err)
-				return "", nil // 或其他错误处理
+				return "", callapi.UpstreamError("上传富媒体失败", err)
 			}
 			// 创建包含文本和图像信息的消息
 			msgseq = echo.GetMappingSeq(messageID)
@@ -233,10 +233,10 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 			groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
 
 			// 发送组合消息
-			resp, err = apiv2.PostC2CMessage(context.TODO(), UserID, groupMessage)
+			resp, err = apiv2.PostC2CMessage(message.Context(), UserID, groupMessage)
 			if err != nil {
 				mylog.Printf("发送组合消息失败: %v", err)
-				return "", nil // 或其他错误处理
+				return "", callapi.UpstreamError("发送组合消息失败", err)
 			}
 
 			// 发送成功回执
@@ -256,15 +256,15 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 			groupMessage, ok := groupReply.(*dto.MessageToCreate)
 			if !ok {
 				mylog.Println("Error: Expected MessageToCreate type.")
-				return "", nil
+				return "", fmt.Errorf("生成私聊消息失败: 未知的消息类型 %T", groupReply)
 			}
 
 			groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
-			resp, err := apiv2.PostC2CMessage(context.TODO(), UserID, groupMessage)
+			resp, err := apiv2.PostC2CMessage(message.Context(), UserID, groupMessage)
 			if err != nil {
 				mylog.Printf("发送文本私聊信息失败: %v", err)
 				//如果失败 防止进入递归
-				return "", nil
+				return "", callapi.UpstreamError("发送文本私聊信息失败", err)
 			}
 			//发送成功回执
 			retmsg, _ = SendC2CResponse(client, err, &message, resp)
@@ -300,11 +300,11 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 						groupMessage, ok := groupReply.(*dto.MessageToCreate)
 						if !ok {
 							mylog.Println("Error: Expected MessageToCreate type.")
-							return "", nil // 或其他错误处理
+							return "", fmt.Errorf("生成私聊消息失败: 未知的消息类型 %T", groupReply)
 						}
 
 						// 首次发送私聊 MessageToCreate
-						resp, err = apiv2.PostC2CMessage(context.TODO(), UserID, groupMessage)
+						resp, err = apiv2.PostC2CMessage(message.Context(), UserID, groupMessage)
 						if err != nil {
 							mylog.Printf("发送 MessageToCreate 私聊信息失败: %v", err)
 							// 错误保存到本地
@@ -323,7 +323,7 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 							// 请求参数 event_id 无效，清空后重试一次
 							groupMessage.EventID = ""
 							//重新为err赋值
-							resp, err = apiv2.PostC2CMessage(context.TODO(), UserID, groupMessage)
+							resp, err = apiv2.PostC2CMessage(message.Context(), UserID, groupMessage)
 							if err != nil {
 								mylog.Printf("发送 MessageToCreate 私聊信息失败 on code 40034025: %v", err)
 								// 错误保存到本地
@@ -346,7 +346,7 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 				}
 
 				// 发媒体
-				message_return, err := apiv2.PostC2CMessage(context.TODO(), UserID, richMediaMessage)
+				message_return, err := apiv2.PostC2CMessage(message.Context(), UserID, richMediaMessage)
 				if err != nil {
 					mylog.Printf("发送 %s 信息失败_send_private_msg: %v", key, err)
 
@@ -379,7 +379,7 @@ func HandleSendPrivateMsg(client callapi.Client, api openapi.OpenAPI, apiv2 open
 					}
 					groupMessage.Timestamp = time.Now().Unix() // 设置时间戳
 					//重新为err赋值
-					resp, err = apiv2.PostC2CMessage(context.TODO(), UserID, groupMessage)
+					resp, err = apiv2.PostC2CMessage(message.Context(), UserID, groupMessage)
 					if err != nil {
 						mylog.Printf("发送 %s 私聊信息失败: %v", key, err)
 					}
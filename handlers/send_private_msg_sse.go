@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -64,7 +63,7 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 	// New checks for UserID and GroupID being nil or 0
 	if message.Params.UserID == nil || !checkZeroUserID(message.Params.UserID) {
 		mylog.Printf("send_group_msg_sse接收到错误action: %v", message)
-		return "", nil
+		return "", callapi.BadParams("user_id不能为空")
 	}
 
 	var err error
@@ -81,7 +80,7 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 			_, UserID, err = idmap.RetrieveRowByIDv2Pro("690426430", message.Params.UserID.(string))
 			if err != nil {
 				mylog.Printf("Error reading config: %v", err)
-				return "", nil
+				return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 			}
 			mylog.Printf("测试,通过Proid获取的UserID:%v", UserID)
 		} else {
@@ -89,7 +88,7 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 			UserID, err = idmap.RetrieveRowByIDv2(message.Params.UserID.(string))
 			if err != nil {
 				mylog.Printf("Error reading config: %v", err)
-				return "", nil
+				return "", callapi.BadParams("无法找到user_id[%v]对应的真实id: %v", message.Params.UserID, err)
 			}
 		}
 	} else {
@@ -100,7 +99,7 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 	messageJSON, err := json.Marshal(message.Params.Message)
 	if err != nil {
 		fmt.Printf("Error marshalling message: %v\n", err)
-		return "", nil
+		return "", callapi.BadParams("message格式错误: %v", err)
 	}
 
 	// 然后，将这个JSON字符串反序列化到InterfaceBody类型的对象中
@@ -108,7 +107,7 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 	err = json.Unmarshal(messageJSON, &messageBody)
 	if err != nil {
 		fmt.Printf("Error unmarshalling to InterfaceBody: %v\n", err)
-		return "", nil
+		return "", callapi.BadParams("message格式错误: %v", err)
 	}
 
 	// 输出反序列化后的对象，确认是否成功转换
@@ -134,11 +133,11 @@ func HandleSendPrivateMsgSSE(client callapi.Client, api openapi.OpenAPI, apiv2 o
 
 	dtoSSE := generateMessageSSE(messageBody, messageID, relatedID)
 
-	resp, err = apiv2.PostC2CMessageSSE(context.TODO(), UserID, dtoSSE)
+	resp, err = apiv2.PostC2CMessageSSE(message.Context(), UserID, dtoSSE)
 	if err != nil {
 		mylog.Errorf("发送文本私聊信息失败: %v", err)
 		//如果失败 防止进入递归
-		return "", nil
+		return "", callapi.UpstreamError("发送流式私聊信息失败", err)
 	}
 
 	// 更新或刷新映射关系
@@ -40,7 +40,7 @@ func HandleSendPrivateMsgWakeup(client callapi.Client, api openapi.OpenAPI, apiv
 	userID, ok := message.Params.UserID.(string)
 	if !ok || len(userID) != 32 {
 		mylog.Printf("send_private_msg_wakeup 错误: UserID 必须是 32 位字符串")
-		return "", nil
+		return "", callapi.BadParams("user_id必须是32位的openid")
 	}
 
 	// 此时 selfID 最好从配置或 message 中获取，这里演示用 0 或 message.SelfID (如果你的ActionMessage里有)
@@ -94,15 +94,15 @@ func HandleSendPrivateMsgWakeup(client callapi.Client, api openapi.OpenAPI, apiv
 		richMediaMessage, ok := groupReply.(*dto.RichMediaMessage)
 		if !ok {
 			mylog.Printf("Error: Expected RichMediaMessage type for key")
-			return "", nil
+			return "", fmt.Errorf("生成私聊消息失败: 未知的消息类型 %T", groupReply)
 		}
 
 		// 上传图片 (不需要 IsWakeup，只是为了拿 FileInfo)
-		fileInfo, err := uploadMediaPrivate(context.TODO(), userID, richMediaMessage, apiv2)
+		fileInfo, err := uploadMediaPrivate(message.Context(), userID, richMediaMessage, apiv2)
 		if err != nil {
 			mylog.Printf("上传图片失败: %v", err)
 			sendWakeupNotice(client, userID, nil, err, selfID)
-			return "", nil
+			return "", callapi.UpstreamError("上传富媒体失败", err)
 		}
 
 		// 构造 MessageToCreate
@@ -192,7 +192,7 @@ func HandleSendPrivateMsgWakeup(client callapi.Client, api openapi.OpenAPI, apiv
 
 			// 2. 如果是 RichMediaMessage，执行上传 + 发送流程
 			// 上传媒体 (这里不需要 IsWakeup)
-			messageReturn, err := apiv2.PostC2CMessage(context.TODO(), userID, richMediaMessage)
+			messageReturn, err := apiv2.PostC2CMessage(message.Context(), userID, richMediaMessage)
 			if err != nil {
 				mylog.Printf("发送 %s 信息失败_upload: %v", key, err)
 				if config.GetSaveError() {
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"strconv"
 
 	"github.com/hoshinonyaruko/gensokyo/callapi"
@@ -18,46 +17,51 @@ func init() {
 func SetGroupBan(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
 
 	// 从message中获取group_id和UserID
-	groupID := message.Params.GroupID.(string)
-	receivedUserID := message.Params.UserID.(string)
+	groupID, _ := message.Params.GroupID.(string)
+	receivedUserID, _ := message.Params.UserID.(string)
+	if groupID == "" || receivedUserID == "" {
+		return "", callapi.BadParams("group_id和user_id不能为空")
+	}
 	//读取ini 通过ChannelID取回之前储存的guild_id
 	guildID, err := idmap.ReadConfigv2(groupID, "guild_id")
 	if err != nil {
 		mylog.Printf("Error reading config: %v", err)
-		return "", nil
+		return "", callapi.BadParams("无法找到group_id[%s]对应的guild_id: %v", groupID, err)
 	}
 	// 根据UserID读取真实的userid
 	realUserID, err := idmap.RetrieveRowByIDv2(receivedUserID)
 	if err != nil {
 		mylog.Printf("Error reading real userID: %v", err)
-		return "", nil
+		return "", callapi.BadParams("无法找到user_id[%s]对应的真实id: %v", receivedUserID, err)
 	}
 
 	// 读取消息类型
 	msgType, err := idmap.ReadConfigv2(groupID, "type")
 	if err != nil {
 		mylog.Printf("Error reading config for message type: %v", err)
-		return "", nil
+		return "", callapi.BadParams("无法找到group_id[%s]的类型: %v", groupID, err)
 	}
 
 	// 根据消息类型进行操作
 	switch msgType {
 	case "group":
 		mylog.Printf("setGroupBan(频道): 目前暂未开放该能力")
-		return "", nil
+		return "", callapi.Unsupported("群场景目前暂未开放禁言能力")
 	case "private":
 		mylog.Printf("setGroupBan(频道): 目前暂未适配私聊虚拟群场景的禁言能力")
-		return "", nil
+		return "", callapi.Unsupported("目前暂未适配私聊虚拟群场景的禁言能力")
 	case "guild":
 		duration := strconv.Itoa(message.Params.Duration)
 		mute := &dto.UpdateGuildMute{
 			MuteSeconds: duration,
 			UserIDs:     []string{realUserID},
 		}
-		err := api.MemberMute(context.TODO(), guildID, realUserID, mute)
+		err := api.MemberMute(message.Context(), guildID, realUserID, mute)
 		if err != nil {
 			mylog.Printf("Error muting member: %v", err)
+			return "", callapi.UpstreamError("禁言频道成员失败", err)
 		}
+		return sendOkResponse(client, "set_group_ban", message.Echo)
 	}
-	return "", nil
+	return "", callapi.BadParams("未知的group_id类型: %s", msgType)
 }
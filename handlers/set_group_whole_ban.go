@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"context"
-
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
@@ -16,28 +14,31 @@ func init() {
 
 func SetGroupWholeBan(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.OpenAPI, message callapi.ActionMessage) (string, error) {
 	// 从message中获取group_id
-	groupID := message.Params.GroupID.(string)
+	groupID, _ := message.Params.GroupID.(string)
+	if groupID == "" {
+		return "", callapi.BadParams("group_id不能为空")
+	}
 	//读取ini 通过ChannelID取回之前储存的guild_id
 	guildID, err := idmap.ReadConfigv2(groupID, "guild_id")
 	if err != nil {
 		mylog.Printf("Error reading config: %v", err)
-		return "", nil
+		return "", callapi.BadParams("无法找到group_id[%s]对应的guild_id: %v", groupID, err)
 	}
 	// 读取消息类型
 	msgType, err := idmap.ReadConfigv2(groupID, "type")
 	if err != nil {
 		mylog.Printf("Error reading config for message type: %v", err)
-		return "", nil
+		return "", callapi.BadParams("无法找到group_id[%s]的类型: %v", groupID, err)
 	}
 
 	// 根据消息类型进行操作
 	switch msgType {
 	case "group":
 		mylog.Printf("setGroupWholeBan(频道): 目前暂未开放该能力")
-		return "", nil
+		return "", callapi.Unsupported("群场景目前暂未开放全体禁言能力")
 	case "private":
 		mylog.Printf("setGroupWholeBan(频道): 目前暂未适配私聊虚拟群场景的禁言能力")
-		return "", nil
+		return "", callapi.Unsupported("目前暂未适配私聊虚拟群场景的禁言能力")
 	case "guild":
 		var duration string
 		if message.Params.Enable {
@@ -49,11 +50,12 @@ func SetGroupWholeBan(client callapi.Client, api openapi.OpenAPI, apiv2 openapi.
 		mute := &dto.UpdateGuildMute{
 			MuteSeconds: duration,
 		}
-		err := api.GuildMute(context.TODO(), guildID, mute)
+		err := api.GuildMute(message.Context(), guildID, mute)
 		if err != nil {
 			mylog.Printf("Error setting whole guild mute: %v", err)
+			return "", callapi.UpstreamError("频道全体禁言失败", err)
 		}
-		return "", nil
+		return sendOkResponse(client, "set_group_whole_ban", message.Echo)
 	}
-	return "", nil
+	return "", callapi.BadParams("未知的group_id类型: %s", msgType)
 }
@@ -0,0 +1,185 @@
+// Package health 提供/healthz存活检查和/readyz就绪检查
+package health
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/botstats"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/registry"
+	"github.com/hoshinonyaruko/gensokyo/url"
+	"github.com/tencent-connect/botgo/token"
+)
+
+// 组件名,用于healthz_components和readyz_components配置
+const (
+	ComponentGateway  = "gateway"
+	ComponentToken    = "token"
+	ComponentIdmap    = "idmap"
+	ComponentGensokyo = "gensokyo_db"
+	ComponentBotstats = "botstats"
+	ComponentBackends = "backends"
+)
+
+// token剩余有效期少于该秒数时标记为即将过期,仍然健康
+const tokenRefreshMargin = 60
+
+// Component 一个组件的检查结果
+type Component struct {
+	Healthy  bool        `json:"healthy"`
+	Required bool        `json:"required"` // 是否在配置中要求健康,不健康时返回503
+	Detail   interface{} `json:"detail,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Report 检查结果
+type Report struct {
+	Status     string               `json:"status"` // ok 或 unhealthy
+	Time       int64                `json:"time"`
+	Components map[string]Component `json:"components"`
+}
+
+var (
+	tokenMu  sync.RWMutex
+	botToken *token.Token
+)
+
+// SetToken 设置用于检查AccessToken的token对象,未配置机器人时不调用
+func SetToken(t *token.Token) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	botToken = t
+}
+
+// HealthzHandler /healthz的handler,healthz_components中的组件都健康时返回200
+func HealthzHandler() gin.HandlerFunc {
+	return handler(config.GetHealthzComponents)
+}
+
+// ReadyzHandler /readyz的handler,readyz_components中的组件都健康时返回200
+func ReadyzHandler() gin.HandlerFunc {
+	return handler(config.GetReadyzComponents)
+}
+
+func handler(required func() []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := Check(required())
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
+
+// Check 检查所有组件,required中的组件有一个不健康时Status为unhealthy
+func Check(required []string) Report {
+	report := Report{
+		Status: "ok",
+		Time:   time.Now().Unix(),
+		Components: map[string]Component{
+			ComponentGateway:  checkGateway(),
+			ComponentToken:    checkToken(),
+			ComponentIdmap:    checkDB(idmap.Ping),
+			ComponentGensokyo: checkDB(url.Ping),
+			ComponentBotstats: checkDB(botstats.Ping),
+			ComponentBackends: checkBackends(),
+		},
+	}
+	for _, name := range required {
+		component, ok := report.Components[name]
+		if !ok {
+			// 未知的组件名视为不健康,避免配置拼写错误时检查被静默跳过
+			component = Component{Error: "unknown component"}
+		}
+		component.Required = true
+		report.Components[name] = component
+		if !component.Healthy {
+			report.Status = "unhealthy"
+		}
+	}
+	return report
+}
+
+// checkGateway 当前实例负责的分片都已identified或resumed,或者为备用实例时健康
+func checkGateway() Component {
+	counters := botstats.GetCounters()
+	shards := botstats.GatewayShards()
+	// 分片租约模式下的备用实例不持有分片,其他实例失联后接管,视为健康
+	healthy := len(shards) > 0 || counters.GatewayState == botstats.GatewayStandby
+	for _, shard := range shards {
+		if shard.State != botstats.GatewayIdentified && shard.State != botstats.GatewayResumed {
+			healthy = false
+		}
+	}
+	return Component{
+		Healthy: healthy,
+		Detail: gin.H{
+			"state":       counters.GatewayState,
+			"changed_at":  counters.OnlineChangedAt,
+			"disconnects": counters.GatewayDisconnects,
+			"shards":      shards,
+		},
+	}
+}
+
+func checkToken() Component {
+	tokenMu.RLock()
+	t := botToken
+	tokenMu.RUnlock()
+	if t == nil {
+		return Component{Error: "bot is not configured"}
+	}
+
+	info := t.AccessTokenInfo()
+	if info.Token == "" {
+		return Component{Error: "access token has not been fetched"}
+	}
+	expiresAt := info.ExpiresAt()
+	remaining := int64(time.Until(expiresAt).Seconds())
+	component := Component{
+		Healthy: remaining > 0,
+		Detail: gin.H{
+			"updated_at":    info.UpTime.Unix(),
+			"expires_at":    expiresAt.Unix(),
+			"expires_in":    remaining,
+			"expiring_soon": remaining > 0 && remaining < tokenRefreshMargin,
+		},
+	}
+	if !component.Healthy {
+		component.Error = "access token expired"
+	}
+	return component
+}
+
+func checkDB(ping func() error) Component {
+	if err := ping(); err != nil {
+		return Component{Error: err.Error()}
+	}
+	return Component{Healthy: true}
+}
+
+// checkBackends 统计已连接的onebot应用端,至少有一个时健康
+func checkBackends() Component {
+	forward := registry.Default.Len()
+	reverse := 0
+	reverseTotal := 0
+	for _, state := range registry.ReverseStates() {
+		reverseTotal++
+		if state.State == registry.StateConnected {
+			reverse++
+		}
+	}
+	return Component{
+		Healthy: forward+reverse > 0,
+		Detail: gin.H{
+			"forward":       forward,
+			"reverse":       reverse,
+			"reverse_total": reverseTotal,
+		},
+	}
+}
@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// go-cqhttp的action后缀
+const (
+	asyncSuffix       = "_async"
+	rateLimitedSuffix = "_rate_limited"
+)
+
+// _rate_limited的action排队执行的间隔
+const rateLimitInterval = time.Second
+
+// 排队中的限速action
+type rateLimitedCall struct {
+	api     openapi.OpenAPI
+	apiV2   openapi.OpenAPI
+	message callapi.ActionMessage
+}
+
+var rateLimitedQueue = make(chan rateLimitedCall, 1000)
+
+func init() {
+	go func() {
+		for call := range rateLimitedQueue {
+			callapi.CallAPIFromDict(&callapi.CaptureClient{}, call.api, call.apiV2, call.message)
+			time.Sleep(rateLimitInterval)
+		}
+	}()
+}
+
+// ParamsContent中非字符串类型的字段,GET和表单参数需要转换类型后才能解析
+var typedParams = func() map[string]reflect.Kind {
+	kinds := make(map[string]reflect.Kind)
+	t := reflect.TypeOf(callapi.ParamsContent{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int64, reflect.Bool:
+			kinds[name] = field.Type.Kind()
+		}
+	}
+	return kinds
+}()
+
+// resolveAction 根据请求路径解析action和调用方式,支持_async和_rate_limited后缀
+func resolveAction(path string) (action string, mode string, ok bool) {
+	action = strings.Trim(path, "/")
+	// 已注册的action优先,如send_msg_async本身就是一个action
+	if callapi.HasHandler(action) {
+		return action, "", true
+	}
+	for _, suffix := range []string{asyncSuffix, rateLimitedSuffix} {
+		if strings.HasSuffix(action, suffix) {
+			base := strings.TrimSuffix(action, suffix)
+			if callapi.HasHandler(base) {
+				return base, suffix, true
+			}
+		}
+	}
+	return action, "", false
+}
+
+// parseParams 从GET查询参数、表单或JSON中解析action的参数
+func parseParams(c *gin.Context) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	for key, values := range c.Request.URL.Query() {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+
+	if c.Request.Method != http.MethodGet {
+		if strings.HasPrefix(c.ContentType(), "application/json") {
+			if c.Request.ContentLength != 0 {
+				body := make(map[string]interface{})
+				if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+					return nil, err
+				}
+				for key, value := range body {
+					params[key] = value
+				}
+			}
+		} else if err := c.Request.ParseForm(); err == nil {
+			for key, values := range c.Request.PostForm {
+				if len(values) > 0 {
+					params[key] = values[0]
+				}
+			}
+		}
+	}
+	delete(params, "access_token")
+
+	// 查询参数和表单参数都是字符串,按ParamsContent的字段类型转换
+	for key, value := range params {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		switch typedParams[key] {
+		case reflect.Int, reflect.Int64:
+			if n, err := strconv.Atoi(str); err == nil {
+				params[key] = n
+			}
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(str); err == nil {
+				params[key] = b
+			}
+		}
+	}
+	return params, nil
+}
+
+// handleAction 通用的action分发,处理所有已注册的action,未注册的action返回1404
+func handleAction(c *gin.Context, api openapi.OpenAPI, apiV2 openapi.OpenAPI) {
+	action, mode, ok := resolveAction(c.Request.URL.Path)
+	if !ok {
+		c.JSON(http.StatusNotFound, callapi.FailedResponse(callapi.RetCodeUnsupported, "不支持的action: "+action, "API不存在", nil))
+		return
+	}
+
+	params, err := parseParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, callapi.FailedResponse(callapi.RetCodeBadParams, err.Error(), "参数错误", nil))
+		return
+	}
+	echo := params["echo"]
+	delete(params, "echo")
+
+	raw, err := json.Marshal(map[string]interface{}{
+		"action": action,
+		"params": params,
+		"echo":   echo,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, callapi.FailedResponse(callapi.RetCodeBadParams, err.Error(), "参数错误", nil))
+		return
+	}
+	var message callapi.ActionMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		c.JSON(http.StatusBadRequest, callapi.FailedResponse(callapi.RetCodeBadParams, err.Error(), "参数错误", nil))
+		return
+	}
+
+	switch mode {
+	case asyncSuffix:
+		go callapi.CallAPIFromDict(&callapi.CaptureClient{}, api, apiV2, message)
+		c.JSON(http.StatusOK, gin.H{"status": "async", "retcode": 1, "data": nil, "echo": echo})
+		return
+	case rateLimitedSuffix:
+		select {
+		case rateLimitedQueue <- rateLimitedCall{api: api, apiV2: apiV2, message: message}:
+			c.JSON(http.StatusOK, gin.H{"status": "async", "retcode": 1, "data": nil, "echo": echo})
+		default:
+			c.JSON(http.StatusOK, callapi.FailedResponse(callapi.RetCodeFailed, "rate limited queue is full", "限速队列已满", echo))
+		}
+		return
+	}
+
+	// CallAPIFromDict保证handler总会返回一个响应
+	client := &callapi.CaptureClient{}
+	callapi.CallAPIFromDict(client, api, apiV2, message)
+	response := client.Response()
+	if response == nil {
+		mylog.Printf("http api调用%s没有返回结果", action)
+		response = callapi.FailedResponse(callapi.RetCodeNoResponse, action+" 没有返回结果", "没有返回结果", echo)
+	}
+	c.JSON(http.StatusOK, envelope(response, echo))
+}
+
+// envelope 将handler的响应整理为标准的{status, retcode, data}格式
+func envelope(response map[string]interface{}, echo interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(response)+3)
+	for key, value := range response {
+		out[key] = value
+	}
+	if _, ok := out["status"]; !ok {
+		out["status"] = "ok"
+	}
+	if _, ok := out["retcode"]; !ok {
+		out["retcode"] = 0
+	}
+	if _, ok := out["data"]; !ok {
+		out["data"] = nil
+	}
+	if echo != nil {
+		out["echo"] = echo
+	}
+	return out
+}
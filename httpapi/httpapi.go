@@ -88,8 +88,8 @@ func CombinedMiddleware(api openapi.OpenAPI, apiV2 openapi.OpenAPI) gin.HandlerF
 			return
 		}
 
-		// 调用c.Next()以继续处理请求链
-		c.Next()
+		// 其余已注册的action由通用分发处理
+		handleAction(c, api, apiV2)
 	}
 }
 
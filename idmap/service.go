@@ -216,6 +216,47 @@ func CloseDB() {
 	db.Close()
 }
 
+// bucketSizesTTL BucketSizes结果的缓存时间,统计条目数需要遍历整个Bucket,不在每次抓取指标时都执行
+const bucketSizesTTL = 30 * time.Second
+
+var (
+	bucketSizesMu sync.Mutex
+	bucketSizes   map[string]int
+	bucketSizesAt time.Time
+)
+
+// BucketSizes 返回idmap各Bucket中的条目数,用于监控,结果缓存bucketSizesTTL
+func BucketSizes() map[string]int {
+	bucketSizesMu.Lock()
+	defer bucketSizesMu.Unlock()
+	if bucketSizes != nil && time.Since(bucketSizesAt) < bucketSizesTTL {
+		return copySizes(bucketSizes)
+	}
+	sizes := make(map[string]int)
+	if db == nil {
+		return sizes
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		for _, name := range []string{BucketName, CacheBucketName, UserInfoBucket} {
+			if b := tx.Bucket([]byte(name)); b != nil {
+				sizes[name] = b.Stats().KeyN
+			}
+		}
+		return nil
+	})
+	bucketSizes = sizes
+	bucketSizesAt = time.Now()
+	return copySizes(sizes)
+}
+
+func copySizes(sizes map[string]int) map[string]int {
+	out := make(map[string]int, len(sizes))
+	for name, n := range sizes {
+		out[name] = n
+	}
+	return out
+}
+
 func GenerateRowID(id string, length int) (int64, error) {
 	// 计算MD5哈希值
 	hasher := md5.New()
@@ -861,6 +902,69 @@ func RetrieveRowByIDv2(rowid string) (string, error) {
 	return RetrieveRowByID(rowid)
 }
 
+// RetrieveRowOfID 根据真实id读取已分配的行号,与StoreID不同,不存在时返回ErrKeyNotFound而不分配新的行号
+func RetrieveRowOfID(id string) (int64, error) {
+	var row int64
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+
+		rowBytes := b.Get([]byte(id))
+		if rowBytes == nil {
+			return ErrKeyNotFound
+		}
+		row = int64(binary.BigEndian.Uint64(rowBytes))
+
+		return nil
+	})
+
+	return row, err
+}
+
+// RetrieveRowOfIDv2 根据真实id读取已分配的行号,只读不写,lotus模式下向主程序查询
+func RetrieveRowOfIDv2(id string) (int64, error) {
+	if config.GetLotusGrpc() && config.GetLotusValue() {
+		return 0, fmt.Errorf("lotus grpc does not support row lookup")
+	} else if config.GetLotusValue() && !config.GetLotusWithoutIdmaps() {
+		// 使用网络请求方式
+		serverDir := config.GetServer_dir()
+		portValue := config.GetPortValue()
+
+		// 根据portValue确定协议
+		protocol := "http"
+		if portValue == "443" || config.GetForceSsl() {
+			protocol = "https"
+		}
+
+		// 构建请求URL
+		url := fmt.Sprintf("%s://%s:%s/getid?type=18&id=%s", protocol, serverDir, portValue, id)
+		resp, err := http.Get(url)
+		if err != nil {
+			return 0, fmt.Errorf("failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return 0, ErrKeyNotFound
+		}
+
+		// 解析响应
+		var response map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return 0, fmt.Errorf("failed to decode response: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("error response from server: %s", response["error"])
+		}
+
+		rowValue, ok := response["row"].(float64)
+		if !ok {
+			return 0, fmt.Errorf("invalid response format")
+		}
+		return int64(rowValue), nil
+	}
+
+	return RetrieveRowOfID(id)
+}
+
 // RetrieveRowByCachev2 根据b得到a
 func RetrieveRowByCachev2(rowid string) (string, error) {
 	// 根据portValue确定协议
@@ -1844,3 +1948,13 @@ func ListAllUsers() ([]structs.FriendData, error) {
 	}
 	return users, nil
 }
+
+// Ping 检查idmap.db是否可以读取,用于健康检查
+func Ping() error {
+	if db == nil {
+		return errors.New("database is not initialized")
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
@@ -26,22 +26,32 @@ import (
 	"github.com/hoshinonyaruko/gensokyo/Processor"
 	"github.com/hoshinonyaruko/gensokyo/acnode"
 	"github.com/hoshinonyaruko/gensokyo/botstats"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/dedup"
 	"github.com/hoshinonyaruko/gensokyo/echo"
 	"github.com/hoshinonyaruko/gensokyo/handlers"
+	"github.com/hoshinonyaruko/gensokyo/health"
 	"github.com/hoshinonyaruko/gensokyo/httpapi"
 	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/metrics"
+	"github.com/hoshinonyaruko/gensokyo/msgstore"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/outbox"
+	"github.com/hoshinonyaruko/gensokyo/satori"
 	"github.com/hoshinonyaruko/gensokyo/server"
+	"github.com/hoshinonyaruko/gensokyo/sessionstore"
 	"github.com/hoshinonyaruko/gensokyo/sys"
 	"github.com/hoshinonyaruko/gensokyo/template"
 	"github.com/hoshinonyaruko/gensokyo/url"
 	"github.com/hoshinonyaruko/gensokyo/webui"
 	"github.com/hoshinonyaruko/gensokyo/wsclient"
 	"github.com/tencent-connect/botgo/sessions/multi"
+	"github.com/tencent-connect/botgo/sessions/remote"
 	"google.golang.org/grpc"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	proto "github.com/hoshinonyaruko/gensokyo/proto"
 	"github.com/tencent-connect/botgo"
 	"github.com/tencent-connect/botgo/dto"
@@ -54,6 +64,9 @@ import (
 // 消息处理器，持有 openapi 对象
 var p *Processor.Processors
 
+// 启用shard_coordinator时自动分配分片的session manager
+var leaseManager *remote.LeaseManager
+
 func main() {
 	// 定义faststart命令行标志。默认为false。
 	fastStart := flag.Bool("faststart", false, "start without initialization if set")
@@ -130,6 +143,7 @@ func main() {
 	logLevel := mylog.GetLogLevelFromConfig(config.GetLogLevel())
 	loggerAdapter := mylog.NewMyLogAdapter(logLevel, config.GetSaveLogs())
 	mylog.SetLogLevel(logLevel)
+	mylog.SetLogFormat(config.GetLogFormat())
 	botgo.SetLogger(loggerAdapter)
 
 	if *m {
@@ -156,6 +170,7 @@ func main() {
 		if err := token.InitToken(ctx); err != nil {
 			log.Fatalln(err)
 		}
+		health.SetToken(token)
 
 		//读取intent
 		if len(conf.Settings.TextIntent) == 0 {
@@ -214,10 +229,21 @@ func main() {
 			idmap.InitializeDB()
 			//创建botstats数据库
 			botstats.InitializeDB()
+			// 统计官方api的调用次数
+			botstats.RegisterAPIFilters()
+			metrics.RegisterAPIHooks()
+			// 记录带有链路追踪ID的官方api请求
+			callapi.RegisterTraceFilter()
+			//创建信息储存数据库
+			msgstore.InitializeDB()
+			//创建反向ws补发队列数据库
+			outbox.InitializeDB()
 
 			//关闭时候释放数据库
 			defer idmap.CloseDB()
 			defer botstats.CloseDB()
+			defer msgstore.CloseDB()
+			defer outbox.CloseDB()
 
 			if *delids {
 				mylog.Printf("开始删除ids\n")
@@ -282,16 +308,43 @@ func main() {
 				intent |= websocket.RegisterHandlers(handler)
 			}
 
+			// 连接状态与事件统计的handler总是注册,不占用intent
+			websocket.RegisterHandlers(ReadyHandler(), ErrorNotifyHandler(), ReceivedHandler())
+			// webhook与网关事件投递给handler之前丢弃重复的事件
+			dedup.Register()
+
 			log.Printf("注册 intents: %v\n", intent)
 
 			// 确保p包含conf
 			p = Processor.NewProcessorV2(api, apiV2, &conf.Settings)
 
+			// 读取上次运行保存的网关session,启动时先尝试resume
+			sessionstore.Init()
+
 			// 启动session manager以管理websocket连接
 			// 指定需要启动的分片数为 2 的话可以手动修改 wsInfo
-			if conf.Settings.ShardCount == 1 {
-				go func() {
+			if coordinator := config.GetShardCoordinator(); coordinator != "" {
+				// 通过协调后端自动分配分片,实例失联后其他实例接管它的分片
+				leaseManager, err = newLeaseManager(coordinator, conf.Settings.AppID)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				wsInfo.Shards = uint32(conf.Settings.ShardCount)
+				if wsInfo.Shards <= 1 {
 					wsInfo.Shards = uint32(conf.Settings.ShardNum)
+				}
+				botstats.SetOwnedShards(leaseManager.Shards)
+				botstats.SetStandby(leaseManager.Standby)
+				go func() {
+					if err := leaseManager.Start(wsInfo, token, &intent); err != nil {
+						log.Fatalln(err)
+					}
+				}()
+				log.Printf("使用%s自动分配%d个分片,当前实例为%s,与其他gensokyo平分分片\n", coordinator, wsInfo.Shards, leaseManager.Owner())
+			} else if conf.Settings.ShardCount == 1 {
+				wsInfo.Shards = uint32(conf.Settings.ShardNum)
+				botstats.SetOwnedShards(shardRange(0, wsInfo.Shards))
+				go func() {
 					if wsInfo.Shards == 1 {
 						if err = botgo.NewSessionManager().Start(wsInfo, token, &intent); err != nil {
 							log.Fatalln(err)
@@ -302,6 +355,7 @@ func main() {
 				}()
 				log.Printf("不使用分片,所有信息都由当前gensokyo处理...\n")
 			} else {
+				botstats.SetOwnedShards(shardRange(uint32(conf.Settings.ShardID), 1))
 				go func() {
 					wsInfoSingle := &dto.WebsocketAPSingle{
 						URL:               wsInfo.URL,
@@ -337,7 +391,9 @@ func main() {
 						}
 						wsClient, err := wsclient.NewWebSocketClient(address, BotID, api, apiV2, retry)
 						if err != nil {
-							log.Printf("Error creating WebSocketClient for address(连接到反向ws失败) %s: %v\n", address, err)
+							log.Printf("Error creating WebSocketClient for address(连接到反向ws失败,将在后台继续尝试) %s: %v\n", address, err)
+						}
+						if wsClient == nil {
 							errorChan <- err
 							return
 						}
@@ -449,12 +505,16 @@ func main() {
 		}
 	}
 
-	webhookHandler := server.NewWebhookHandler(5000)
+	webhookHandler := server.NewWebhookHandler(config.GetWebhookWorkers(), config.GetWebhookQueueSize())
 
 	// 启动消息处理协程
 	go webhookHandler.ListenAndProcessMessages()
+	metrics.RegisterWebhookQueue(webhookHandler.QueueDepth, webhookHandler.QueueCapacity, webhookHandler.BusyWorkers)
 
 	r.GET("/updateport", server.HandleIpupdate)
+	r.GET("/metrics", metrics.Handler())
+	r.GET("/healthz", health.HealthzHandler())
+	r.GET("/readyz", health.ReadyzHandler())
 	r.POST("/uploadpic", server.UploadBase64ImageHandler(rateLimiter))
 	r.POST("/uploadpicv2", server.UploadBase64ImageHandlerV2(rateLimiter, apiV2))
 	r.POST("/uploadpicv3", server.UploadBase64ImageHandlerV3(rateLimiter, api))
@@ -503,8 +563,25 @@ func main() {
 				r.GET("/"+wspath, server.WsHandlerWithDependencies(api, apiV2, p))
 				mylog.Println("正向ws启动成功,监听0.0.0.0:" + serverPort + "/" + wspath + "请注意设置ws_server_token(可空),并对外放通端口...")
 			}
+			// 分离的api和event连接,与go-cqhttp的/api和/event一致
+			wsBase := ""
+			if wspath != "nil" && wspath != "" {
+				wsBase = "/" + wspath
+			}
+			r.GET(wsBase+"/api", server.WsRoleHandlerWithDependencies(api, apiV2, p, wsclient.RoleAPI))
+			r.GET(wsBase+"/event", server.WsRoleHandlerWithDependencies(api, apiV2, p, wsclient.RoleEvent))
+			mylog.Println("正向ws的api和event连接路径: " + wsBase + "/api " + wsBase + "/event")
+			// onebotv12正向ws
+			if wspathV12 := config.GetWsServerPathV12(); wspathV12 != "" && wspathV12 != wspath {
+				r.GET("/"+wspathV12, server.WsHandlerV12WithDependencies(api, apiV2, p))
+				mylog.Println("onebotv12正向ws启动成功,监听0.0.0.0:" + serverPort + "/" + wspathV12)
+			}
 		}
 	}
+	//satori
+	if conf.Settings.AppID != 12345 && config.GetEnableSatori() {
+		satori.Register(r, api, apiV2, p)
+	}
 	r.POST("/url", url.CreateShortURLHandler)
 	r.GET("/url/:shortURL", url.RedirectFromShortURLHandler)
 	if config.GetIdentifyFile() {
@@ -623,6 +700,14 @@ func main() {
 	// 阻塞主线程，直到接收到信号
 	<-sigCh
 
+	// 释放分片租约,其他gensokyo可以立即接管
+	if leaseManager != nil {
+		leaseManager.Close()
+	}
+
+	// 保存网关session,下次启动时resume
+	sessionstore.Close()
+
 	// 关闭 WebSocket 连接
 	// wsClients 是一个 *wsclient.WebSocketClient 的切片
 	for _, client := range wsClients {
@@ -642,10 +727,8 @@ func main() {
 	idmap.CloseDB()
 
 	// 在关闭WebSocket客户端之前
-	for _, wsClient := range p.WsServerClients {
-		if err := wsClient.Close(); err != nil {
-			log.Printf("Error closing WebSocket server client: %v\n", err)
-		}
+	for _, err := range p.WsServerClients.CloseAll() {
+		log.Printf("Error closing WebSocket server client: %v\n", err)
 	}
 
 	// 使用一个5秒的超时优雅地关闭Gin服务器
@@ -660,6 +743,11 @@ func main() {
 func ReadyHandler() event.ReadyHandler {
 	return func(event *dto.WSPayload, data *dto.WSReadyData) {
 		log.Println("连接成功,ready event receive: ", data)
+		var shard uint32
+		if len(data.Shard) > 0 {
+			shard = data.Shard[0]
+		}
+		botstats.SetGatewayState(shard, botstats.GatewayIdentified)
 	}
 }
 
@@ -667,13 +755,32 @@ func ReadyHandler() event.ReadyHandler {
 func ErrorNotifyHandler() event.ErrorNotifyHandler {
 	return func(err error) {
 		log.Println("error notify receive: ", err)
+		var shard uint32
+		var shardErr *event.ShardError
+		if errors.As(err, &shardErr) {
+			shard = shardErr.ShardID
+		}
+		botstats.RecordGatewayDisconnect(shard)
+	}
+}
+
+// ReceivedHandler 统计收到的网关事件,断线后resume成功时恢复在线状态,并为事件生成链路追踪ID
+func ReceivedHandler() event.ReceivedHandler {
+	return func(event *dto.WSPayload) {
+		event.TraceID = mylog.NewTraceID()
+		mylog.WithTrace(event.TraceID).Printf("收到网关事件 %s s:%d", event.Type, event.S)
+		botstats.RecordGatewayEvent()
+		metrics.EventReceived(string(event.Type))
+		if event.Type == "RESUMED" {
+			botstats.SetGatewayState(event.Shard, botstats.GatewayResumed)
+		}
 	}
 }
 
 // ATMessageEventHandler 实现处理 频道at 消息的回调
 func ATMessageEventHandler() event.ATMessageEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSATMessageData) error {
-		botstats.RecordMessageReceived()
+		botstats.RecordMessageReceived(botstats.MessageTypeGuild, data.ChannelID)
 		if config.GetEnableChangeWord() {
 			data.Content = acnode.CheckWordIN(data.Content)
 			if data.Author.Username != "" {
@@ -681,7 +788,8 @@ func ATMessageEventHandler() event.ATMessageEventHandler {
 			}
 		}
 
-		go p.ProcessGuildATMessage(data)
+		mylog.BindTrace(data.ID, event.TraceID)
+		dispatch(event, func() { p.ProcessGuildATMessage(data) })
 		return nil
 	}
 }
@@ -713,14 +821,15 @@ func MemberEventHandler() event.GuildMemberEventHandler {
 // DirectMessageHandler 处理私信事件
 func DirectMessageHandler() event.DirectMessageEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSDirectMessageData) error {
-		botstats.RecordMessageReceived()
+		botstats.RecordMessageReceived(botstats.MessageTypeGuildPrivate, "")
 		if config.GetEnableChangeWord() {
 			data.Content = acnode.CheckWordIN(data.Content)
 			if data.Author.Username != "" {
 				data.Author.Username = acnode.CheckWordIN(data.Author.Username)
 			}
 		}
-		go p.ProcessChannelDirectMessage(data)
+		mylog.BindTrace(data.ID, event.TraceID)
+		dispatch(event, func() { p.ProcessChannelDirectMessage(data) })
 		return nil
 	}
 }
@@ -728,14 +837,15 @@ func DirectMessageHandler() event.DirectMessageEventHandler {
 // CreateMessageHandler 处理消息事件 私域的事件 不at信息
 func CreateMessageHandler() event.MessageEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSMessageData) error {
-		botstats.RecordMessageReceived()
+		botstats.RecordMessageReceived(botstats.MessageTypeGuild, data.ChannelID)
 		if config.GetEnableChangeWord() {
 			data.Content = acnode.CheckWordIN(data.Content)
 			if data.Author.Username != "" {
 				data.Author.Username = acnode.CheckWordIN(data.Author.Username)
 			}
 		}
-		go p.ProcessGuildNormalMessage(data)
+		mylog.BindTrace(data.ID, event.TraceID)
+		dispatch(event, func() { p.ProcessGuildNormalMessage(data) })
 		return nil
 	}
 }
@@ -744,7 +854,7 @@ func CreateMessageHandler() event.MessageEventHandler {
 func InteractionHandler() event.InteractionEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSInteractionData) error {
 		mylog.Printf("收到按钮回调:%v", data)
-		go p.ProcessInlineSearch(data)
+		dispatch(event, func() { p.ProcessInlineSearch(data) })
 		return nil
 	}
 }
@@ -753,7 +863,7 @@ func InteractionHandler() event.InteractionEventHandler {
 func ThreadEventHandler() event.ThreadEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSThreadData) error {
 		mylog.Printf("收到帖子事件:%v", data)
-		go p.ProcessThreadMessage(data)
+		dispatch(event, func() { p.ProcessThreadMessage(data) })
 		return nil
 	}
 }
@@ -761,10 +871,9 @@ func ThreadEventHandler() event.ThreadEventHandler {
 // GroupATMessageEventHandler 实现处理 群at 消息的回调
 func GroupATMessageEventHandler() event.GroupATMessageEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSGroupATMessageData) error {
-		go p.ProcessGroupMessage(data)
-
+		mylog.BindTrace(data.ID, event.TraceID)
 		if !config.GetDisableErrorChan() {
-			botstats.RecordMessageReceived()
+			botstats.RecordMessageReceived(botstats.MessageTypeGroup, data.GroupID)
 		}
 
 		if config.GetEnableChangeWord() {
@@ -774,6 +883,7 @@ func GroupATMessageEventHandler() event.GroupATMessageEventHandler {
 			}
 		}
 
+		dispatch(event, func() { p.ProcessGroupMessage(data) })
 		return nil
 	}
 }
@@ -781,10 +891,9 @@ func GroupATMessageEventHandler() event.GroupATMessageEventHandler {
 // C2CMessageEventHandler 实现处理 群私聊 消息的回调
 func C2CMessageEventHandler() event.C2CMessageEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSC2CMessageData) error {
-		go p.ProcessC2CMessage(data)
-
+		mylog.BindTrace(data.ID, event.TraceID)
 		if !config.GetDisableErrorChan() {
-			botstats.RecordMessageReceived()
+			botstats.RecordMessageReceived(botstats.MessageTypePrivate, "")
 		}
 
 		if config.GetEnableChangeWord() {
@@ -794,6 +903,7 @@ func C2CMessageEventHandler() event.C2CMessageEventHandler {
 			}
 		}
 
+		dispatch(event, func() { p.ProcessC2CMessage(data) })
 		return nil
 	}
 }
@@ -801,7 +911,7 @@ func C2CMessageEventHandler() event.C2CMessageEventHandler {
 // GroupAddRobotEventHandler 实现处理 群机器人新增 事件的回调
 func GroupAddRobotEventHandler() event.GroupAddRobotEventHandler {
 	return func(event *dto.WSPayload, data *dto.GroupAddBotEvent) error {
-		go p.ProcessGroupAddBot(data)
+		dispatch(event, func() { p.ProcessGroupAddBot(data) })
 		return nil
 	}
 }
@@ -809,7 +919,7 @@ func GroupAddRobotEventHandler() event.GroupAddRobotEventHandler {
 // GroupDelRobotEventHandler 实现处理 群机器人删除 事件的回调
 func GroupDelRobotEventHandler() event.GroupDelRobotEventHandler {
 	return func(event *dto.WSPayload, data *dto.GroupAddBotEvent) error {
-		go p.ProcessGroupDelBot(data)
+		dispatch(event, func() { p.ProcessGroupDelBot(data) })
 		return nil
 	}
 }
@@ -817,7 +927,7 @@ func GroupDelRobotEventHandler() event.GroupDelRobotEventHandler {
 // GroupMsgRejectHandler 实现处理 群请求关闭机器人主动推送 事件的回调
 func GroupMsgRejectHandler() event.GroupMsgRejectHandler {
 	return func(event *dto.WSPayload, data *dto.GroupMsgRejectEvent) error {
-		go p.ProcessGroupMsgReject(data)
+		dispatch(event, func() { p.ProcessGroupMsgReject(data) })
 		return nil
 	}
 }
@@ -825,7 +935,7 @@ func GroupMsgRejectHandler() event.GroupMsgRejectHandler {
 // GroupMsgReceiveHandler 实现处理 群请求开启机器人主动推送 事件的回调
 func GroupMsgReceiveHandler() event.GroupMsgReceiveHandler {
 	return func(event *dto.WSPayload, data *dto.GroupMsgReceiveEvent) error {
-		go p.ProcessGroupMsgRecive(data)
+		dispatch(event, func() { p.ProcessGroupMsgRecive(data) })
 		return nil
 	}
 }
@@ -834,7 +944,7 @@ func GroupMsgReceiveHandler() event.GroupMsgReceiveHandler {
 func FriendAddEventHandler() event.FriendAddEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSFriendAddData) error {
 		// data.SceneParam 即为 generate_url_link 中的 callbackData
-		go p.ProcessFriendAdd(data)
+		dispatch(event, func() { p.ProcessFriendAdd(data) })
 		return nil
 	}
 }
@@ -842,7 +952,7 @@ func FriendAddEventHandler() event.FriendAddEventHandler {
 // FriendDelEventHandler 实现处理 用户删除机器人 事件的回调
 func FriendDelEventHandler() event.FriendDelEventHandler {
 	return func(event *dto.WSPayload, data *dto.WSFriendDelData) error {
-		go p.ProcessFriendDel(data)
+		dispatch(event, func() { p.ProcessFriendDel(data) })
 		return nil
 	}
 }
@@ -850,7 +960,7 @@ func FriendDelEventHandler() event.FriendDelEventHandler {
 // C2CMsgRejectHandler 实现处理 用户关闭机器人C2C消息推送 事件的回调
 func C2CMsgRejectHandler() event.C2CMsgRejectHandler {
 	return func(event *dto.WSPayload, data *dto.WSC2CMsgRejectData) error {
-		go p.ProcessC2CMsgReject(data)
+		dispatch(event, func() { p.ProcessC2CMsgReject(data) })
 		return nil
 	}
 }
@@ -858,11 +968,21 @@ func C2CMsgRejectHandler() event.C2CMsgRejectHandler {
 // C2CMsgReceiveHandler 实现处理 用户开启机器人C2C消息推送 事件的回调
 func C2CMsgReceiveHandler() event.C2CMsgReceiveHandler {
 	return func(event *dto.WSPayload, data *dto.WSC2CMsgReceiveData) error {
-		go p.ProcessC2CMsgReceive(data)
+		dispatch(event, func() { p.ProcessC2CMsgReceive(data) })
 		return nil
 	}
 }
 
+// dispatch 执行事件的处理函数,webhook worker按会话顺序投递的事件同步处理,保证同一会话的事件依次上报
+// 网关事件仍在新协程中处理,不阻塞读取
+func dispatch(payload *dto.WSPayload, process func()) {
+	if payload.Ordered {
+		process()
+		return
+	}
+	go process()
+}
+
 func getHandlerByName(handlerName string) (interface{}, bool) {
 	switch handlerName {
 	case "ReadyHandler": //连接成功
@@ -1002,3 +1122,43 @@ func UnionFanout(base gin.HandlerFunc) gin.HandlerFunc {
 		base(c)
 	}
 }
+
+// newLeaseManager 根据shard_coordinator创建自动分配分片的session manager
+func newLeaseManager(coordinator string, appID uint64) (*remote.LeaseManager, error) {
+	var backend remote.Backend
+	switch coordinator {
+	case "bolt":
+		path := config.GetShardCoordinatorPath()
+		if path == "" {
+			path = "shards.db"
+		}
+		backend = remote.NewBoltBackend(path)
+	case "redis":
+		backend = remote.NewRedisBackend(redis.NewClient(&redis.Options{
+			Addr:         config.GetShardRedisAddr(),
+			Password:     config.GetShardRedisPassword(),
+			DB:           config.GetShardRedisDB(),
+			DialTimeout:  3 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+		}))
+	default:
+		return nil, fmt.Errorf("unknown shard_coordinator: %s, should be bolt or redis", coordinator)
+	}
+	// 不同机器人的分片互不影响
+	return remote.NewLeaseManager(backend,
+		remote.WithLeaseClusterKey(fmt.Sprintf("gensokyo_%d", appID)),
+		remote.WithLeaseTTL(time.Duration(config.GetShardLeaseTTL())*time.Second),
+	), nil
+}
+
+// shardRange 返回从first开始的n个分片,用于统计当前实例负责的分片的会话状态
+func shardRange(first, n uint32) func() []uint32 {
+	ids := make([]uint32, 0, n)
+	for i := uint32(0); i < n; i++ {
+		ids = append(ids, first+i)
+	}
+	return func() []uint32 {
+		return ids
+	}
+}
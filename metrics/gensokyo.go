@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/echo"
+	"github.com/hoshinonyaruko/gensokyo/idmap"
+	"github.com/hoshinonyaruko/gensokyo/registry"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+var (
+	eventsReceived = NewCounterVec("gensokyo_events_received_total",
+		"收到的网关与webhook事件数", "type")
+	eventsDuplicate = NewCounterVec("gensokyo_events_duplicate_total",
+		"在去重时间窗口内重复收到而被丢弃的事件数", "type")
+	messagesSent = NewCounterVec("gensokyo_messages_sent_total",
+		"调用官方api发送信息的次数,code为官方返回的错误码,成功为0", "target", "code")
+	webhookDropped = NewCounterVec("gensokyo_webhook_events_dropped_total",
+		"webhook队列已满时被拒绝或丢弃的事件数,reason为reject或drop_oldest", "reason")
+	webhookQueueWait = NewHistogramVec("gensokyo_webhook_queue_wait_seconds",
+		"webhook事件从进入队列到开始处理的等待时间", DefaultBuckets)
+	apiDuration = NewHistogramVec("gensokyo_openapi_request_duration_seconds",
+		"调用官方api的耗时", DefaultBuckets, "method", "endpoint")
+)
+
+func init() {
+	NewGaugeFunc("gensokyo_echo_cache_entries", "echo内存映射的条目数", "cache", func() map[string]float64 {
+		return toFloat(echo.CacheSizes())
+	})
+	NewGaugeFunc("gensokyo_idmap_entries", "idmap数据库各Bucket的条目数", "bucket", func() map[string]float64 {
+		return toFloat(idmap.BucketSizes())
+	})
+	NewGaugeFunc("gensokyo_onebot_clients", "已连接的onebot应用端数,按传输方式区分", "transport", onebotClients)
+}
+
+// EventReceived 记录收到一个网关或webhook事件
+func EventReceived(eventType string) {
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	eventsReceived.Inc(eventType)
+}
+
+// EventDuplicate 记录丢弃一个重复收到的事件
+func EventDuplicate(eventType string) {
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	eventsDuplicate.Inc(eventType)
+}
+
+// WebhookDropped 记录一个因队列已满被拒绝或丢弃的webhook事件
+func WebhookDropped(reason string) {
+	webhookDropped.Inc(reason)
+}
+
+// WebhookQueueWait 记录webhook事件在队列中的等待时间
+func WebhookQueueWait(d time.Duration) {
+	webhookQueueWait.Observe(d.Seconds())
+}
+
+// RegisterWebhookQueue 注册webhook队列深度、容量和忙碌worker数的仪表
+func RegisterWebhookQueue(depth, capacity, busy func() int) {
+	NewGaugeFunc("gensokyo_webhook_queue_depth", "webhook事件队列中等待处理的事件数", "", func() map[string]float64 {
+		return map[string]float64{"": float64(depth())}
+	})
+	NewGaugeFunc("gensokyo_webhook_queue_capacity", "webhook事件队列的总长度", "", func() map[string]float64 {
+		return map[string]float64{"": float64(capacity())}
+	})
+	NewGaugeFunc("gensokyo_webhook_busy_workers", "正在处理webhook事件的worker数", "", func() map[string]float64 {
+		return map[string]float64{"": float64(busy())}
+	})
+}
+
+// RegisterAPIHooks 注册botgo的请求结束回调,统计官方api的耗时和发信结果
+func RegisterAPIHooks() {
+	openapi.RegisterResultHook(func(req *http.Request, statusCode int, body []byte, latency time.Duration) {
+		if req == nil || req.URL == nil {
+			return
+		}
+		endpoint := normalizePath(req.URL.Path)
+		apiDuration.Observe(latency.Seconds(), req.Method, endpoint)
+		if target := sendTarget(req.Method, endpoint); target != "" {
+			messagesSent.Inc(target, resultCode(statusCode, body))
+		}
+	})
+}
+
+// Handler /metrics的handler,配置了metrics_token时需要携带Bearer token或access_token参数
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := config.GetMetricsToken(); token != "" {
+			provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if provided == "" {
+				provided = c.Query("access_token")
+			}
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect token"})
+				return
+			}
+		}
+		var buf bytes.Buffer
+		WriteTo(&buf)
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	}
+}
+
+// normalizePath 将路径中的id替换为{id},避免每个群、频道产生单独的指标
+func normalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isID(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isID 包含数字且较长的路径段视为id,如频道号、openid、消息id
+func isID(segment string) bool {
+	if len(segment) >= 20 {
+		return true
+	}
+	if len(segment) < 5 {
+		return false
+	}
+	return strings.IndexFunc(segment, unicode.IsDigit) >= 0
+}
+
+// sendTarget 按发信接口的路径区分目标类型,非发信接口返回空字符串
+func sendTarget(method, endpoint string) string {
+	if method != http.MethodPost {
+		return ""
+	}
+	switch endpoint {
+	case "/v2/groups/{id}/messages":
+		return "group"
+	case "/v2/users/{id}/messages":
+		return "private"
+	case "/channels/{id}/messages":
+		return "guild"
+	case "/dms/{id}/messages":
+		return "direct"
+	}
+	return ""
+}
+
+// resultCode 成功为0,失败时取返回体中的官方错误码,没有得到响应时为network
+func resultCode(statusCode int, body []byte) string {
+	if statusCode == 0 {
+		return "network"
+	}
+	if openapi.IsSuccessStatus(statusCode) {
+		return "0"
+	}
+	var result struct {
+		Code json.Number `json:"code"`
+	}
+	if json.Unmarshal(body, &result) == nil && result.Code != "" {
+		return result.Code.String()
+	}
+	return "http_" + strconv.Itoa(statusCode)
+}
+
+func onebotClients() map[string]float64 {
+	clients := map[string]float64{
+		"onebotv11": 0,
+		"onebotv12": 0,
+		"satori":    0,
+		"reverse":   0,
+	}
+	for _, info := range registry.Default.List() {
+		clients[info.Protocol]++
+	}
+	for _, state := range registry.ReverseStates() {
+		if state.State == registry.StateConnected {
+			clients["reverse"]++
+		}
+	}
+	return clients
+}
+
+func toFloat(m map[string]int) map[string]float64 {
+	result := make(map[string]float64, len(m))
+	for key, value := range m {
+		result[key] = float64(value)
+	}
+	return result
+}
@@ -0,0 +1,220 @@
+// 运行指标,以prometheus文本格式在/metrics上暴露,供多实例部署时统一监控
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 默认的耗时分桶,单位秒
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector 一个指标,按prometheus文本格式输出
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	collectorsMu sync.Mutex
+	collectors   []collector
+)
+
+func register(c collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	collectors = append(collectors, c)
+}
+
+// WriteTo 输出所有指标
+func WriteTo(w io.Writer) {
+	collectorsMu.Lock()
+	list := append([]collector(nil), collectors...)
+	collectorsMu.Unlock()
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc 标签值对应的计数加一,标签值按创建时的顺序传入
+func (c *CounterVec) Inc(values ...string) {
+	key := labelKey(values)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, splitKey(key), "", ""), formatValue(c.values[key]))
+	}
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // 每个分桶的累计数
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec 创建并注册直方图,buckets须从小到大排列
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+	register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := labelKey(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	item, ok := h.values[key]
+	if !ok {
+		item = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = item
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			item.counts[i]++
+		}
+	}
+	item.sum += v
+	item.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		item := h.values[key]
+		values := splitKey(key)
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", formatValue(bound)), item.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), item.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values, "", ""), formatValue(item.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values, "", ""), item.count)
+	}
+}
+
+// GaugeFunc 在输出时才取值的仪表,fn返回标签值到数值的映射,无标签时键为空字符串
+type GaugeFunc struct {
+	name  string
+	help  string
+	label string
+	fn    func() map[string]float64
+}
+
+// NewGaugeFunc 创建并注册仪表,label为空时fn只需返回键为空字符串的值
+func NewGaugeFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, label: label, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := g.fn()
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, key := range sortedKeys(values) {
+		if g.label == "" {
+			fmt.Fprintf(w, "%s %s\n", g.name, formatValue(values[key]))
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels([]string{g.label}, []string{key}, "", ""), formatValue(values[key]))
+	}
+}
+
+// 标签值用不可见字符连接作为map的键
+const keySep = "\xff"
+
+func labelKey(values []string) string {
+	return strings.Join(values, keySep)
+}
+
+func splitKey(key string) []string {
+	return strings.Split(key, keySep)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// formatLabels 输出{a="1",b="2"},extraName不为空时追加一个标签(如直方图的le)
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var parts []string
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		parts = append(parts, name+`="`+escape(value)+`"`)
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+`="`+escape(extraValue)+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,200 @@
+// 持久化储存收到的信息事件,供get_msg等api取回
+package msgstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	DBName          = "messages.db"
+	MessageBucket   = "messages"
+	TimeIndexBucket = "time_index"
+)
+
+var db *bbolt.DB
+
+var ErrMessageNotFound = errors.New("message not found")
+
+var pruneTicker *time.Ticker
+
+// StoredMessage 储存的信息,Event为上报给应用端的原始事件
+type StoredMessage struct {
+	MessageID string                 `json:"message_id"`
+	StoredAt  int64                  `json:"stored_at"`
+	Event     map[string]interface{} `json:"event"`
+}
+
+func InitializeDB() {
+	var err error
+	db, err = bbolt.Open(DBName, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		log.Fatalf("Error opening msgstore DB: %v", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		// 储存信息本体的Bucket
+		if _, err := tx.CreateBucketIfNotExists([]byte(MessageBucket)); err != nil {
+			return err
+		}
+		// 按储存时间排序的索引,用于清理过期信息
+		if _, err := tx.CreateBucketIfNotExists([]byte(TimeIndexBucket)); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Error setting up msgstore buckets: %v", err)
+	}
+
+	// 启动时先清理一次,之后每10分钟清理一次
+	Prune()
+	pruneTicker = time.NewTicker(10 * time.Minute)
+	go func() {
+		for range pruneTicker.C {
+			Prune()
+		}
+	}()
+}
+
+func CloseDB() {
+	if pruneTicker != nil {
+		pruneTicker.Stop()
+	}
+	if db != nil {
+		db.Close()
+	}
+}
+
+// FormatMessageID 将事件中的message_id统一为字符串,兼容int和string_ob11
+func FormatMessageID(v interface{}) string {
+	switch id := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	case float64: // 经过structToMap后数字为float64
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(id)
+	case int64:
+		return strconv.FormatInt(id, 10)
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+// timeIndexKey 时间索引的键 8字节大端时间戳+message_id 保证按时间有序
+func timeIndexKey(t int64, messageID string) []byte {
+	key := make([]byte, 8+len(messageID))
+	binary.BigEndian.PutUint64(key[:8], uint64(t))
+	copy(key[8:], messageID)
+	return key
+}
+
+// StoreEvent 储存一个message类型的事件,以虚拟message_id为键
+func StoreEvent(event map[string]interface{}) error {
+	if db == nil || !config.GetEnableMsgStore() {
+		return nil
+	}
+	if postType, _ := event["post_type"].(string); postType != "message" {
+		return nil
+	}
+	messageID := FormatMessageID(event["message_id"])
+	if messageID == "" || messageID == "0" {
+		return nil
+	}
+
+	now := time.Now()
+	record := StoredMessage{
+		MessageID: messageID,
+		StoredAt:  now.Unix(),
+		Event:     event,
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MessageBucket))
+		idx := tx.Bucket([]byte(TimeIndexBucket))
+		if err := b.Put([]byte(messageID), value); err != nil {
+			return err
+		}
+		return idx.Put(timeIndexKey(now.UnixNano(), messageID), []byte(messageID))
+	})
+}
+
+// GetMessage 根据message_id取回储存的信息
+func GetMessage(messageID string) (*StoredMessage, error) {
+	if db == nil {
+		return nil, errors.New("msgstore database is not initialized")
+	}
+	var record StoredMessage
+	err := db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket([]byte(MessageBucket)).Get([]byte(messageID))
+		if value == nil {
+			return ErrMessageNotFound
+		}
+		return json.Unmarshal(value, &record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Prune 删除超过保留时间的信息
+func Prune() {
+	if db == nil {
+		return
+	}
+	retention := config.GetMsgStoreRetention()
+	if retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(retention) * time.Hour).UnixNano()
+
+	var deleteCount int
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MessageBucket))
+		idx := tx.Bucket([]byte(TimeIndexBucket))
+		c := idx.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			if len(k) < 8 || int64(binary.BigEndian.Uint64(k[:8])) > cutoff {
+				break
+			}
+			// 同一message_id可能被重新储存,只删除不比索引更新的记录
+			if value := b.Get(v); value != nil {
+				var record StoredMessage
+				if json.Unmarshal(value, &record) != nil || record.StoredAt*int64(time.Second) <= int64(binary.BigEndian.Uint64(k[:8])) {
+					if err := b.Delete(v); err != nil {
+						return err
+					}
+				}
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			deleteCount++
+		}
+		return nil
+	})
+	if err != nil {
+		mylog.Printf("清理过期信息失败: %v", err)
+		return
+	}
+	if deleteCount > 0 {
+		mylog.Printf("已清理%d条过期信息", deleteCount)
+	}
+}
@@ -0,0 +1,337 @@
+package mylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 环形缓冲区保留的最近日志条数
+	logBufferSize = 2000
+	// 新连接默认补发的匹配日志条数
+	defaultBacklog = 200
+)
+
+// 日志级别的顺序,用于最低级别过滤
+var levelOrder = map[string]int{
+	"DEBUG": 0,
+	"INFO":  1,
+	"WARN":  2,
+	"ERROR": 3,
+	"FATAL": 4,
+}
+
+// LogFilter webui订阅日志的过滤条件,为空的条件不过滤
+type LogFilter struct {
+	Level   string `json:"level"`    // 最低级别 DEBUG INFO WARN ERROR
+	Keyword string `json:"keyword"`  // 包含的关键词
+	Regex   string `json:"regex"`    // 匹配的正则表达式
+	GroupID string `json:"group_id"` // 包含的群号,同一链路追踪ID的后续日志一并显示
+	UserID  string `json:"user_id"`  // 包含的用户id,同一链路追踪ID的后续日志一并显示
+	Backlog int    `json:"backlog"`  // 连接或更新过滤条件时补发的最近匹配日志条数
+}
+
+// compiledFilter 编译后的过滤条件
+type compiledFilter struct {
+	LogFilter
+	minLevel int
+	re       *regexp.Regexp
+	groupRe  *regexp.Regexp // 没有链路追踪记录时,在日志中按完整的id匹配群号
+	userRe   *regexp.Regexp
+}
+
+func compileFilter(f LogFilter) (*compiledFilter, error) {
+	cf := &compiledFilter{LogFilter: f}
+	if f.Level != "" {
+		level, ok := levelOrder[strings.ToUpper(f.Level)]
+		if !ok {
+			return nil, fmt.Errorf("unknown log level: %s", f.Level)
+		}
+		cf.minLevel = level
+	}
+	if f.Regex != "" {
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			return nil, err
+		}
+		cf.re = re
+	}
+	cf.groupRe = idPattern(f.GroupID)
+	cf.userRe = idPattern(f.UserID)
+	if cf.Backlog <= 0 {
+		cf.Backlog = defaultBacklog
+	}
+	if cf.Backlog > logBufferSize {
+		cf.Backlog = logBufferSize
+	}
+	return cf, nil
+}
+
+func (f *compiledFilter) match(entry EnhancedLogEntry) bool {
+	if levelOrder[entry.Level] < f.minLevel {
+		return false
+	}
+	if f.Keyword != "" && !strings.Contains(entry.Message, f.Keyword) {
+		return false
+	}
+	if f.re != nil && !f.re.MatchString(entry.Message) {
+		return false
+	}
+	if f.GroupID == "" && f.UserID == "" {
+		return true
+	}
+	// 按链路追踪ID所属事件的群号和用户id匹配,同一个链路追踪ID的action和官方api日志一并显示
+	if groupID, userID, ok := ConversationOf(entry.TraceID); ok {
+		return (f.GroupID == "" || f.GroupID == groupID) && (f.UserID == "" || f.UserID == userID)
+	}
+	if f.groupRe != nil && !f.groupRe.MatchString(entry.Message) {
+		return false
+	}
+	if f.userRe != nil && !f.userRe.MatchString(entry.Message) {
+		return false
+	}
+	return true
+}
+
+// idPattern 匹配完整的id,前后不能紧接字母或数字,避免123匹配到11234
+func idPattern(id string) *regexp.Regexp {
+	if id == "" {
+		return nil
+	}
+	return regexp.MustCompile(`(^|[^0-9A-Za-z_])` + regexp.QuoteMeta(id) + `($|[^0-9A-Za-z_])`)
+}
+
+// logRing 最近日志的环形缓冲区
+type logRing struct {
+	entries []EnhancedLogEntry
+	next    int
+	full    bool
+}
+
+func (r *logRing) add(entry EnhancedLogEntry) {
+	if r.entries == nil {
+		r.entries = make([]EnhancedLogEntry, logBufferSize)
+	}
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % logBufferSize
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot 按时间顺序返回缓冲区中的日志
+func (r *logRing) snapshot() []EnhancedLogEntry {
+	if !r.full {
+		return append([]EnhancedLogEntry(nil), r.entries[:r.next]...)
+	}
+	result := make([]EnhancedLogEntry, 0, logBufferSize)
+	result = append(result, r.entries[r.next:]...)
+	return append(result, r.entries[:r.next]...)
+}
+
+type Client struct {
+	conn   *websocket.Conn
+	send   chan EnhancedLogEntry
+	mu     sync.Mutex
+	filter *compiledFilter
+}
+
+// 全局 WebSocket 客户端集合与最近日志,由同一把锁保护
+var (
+	wsClients = make(map[*Client]bool)
+	lock      = sync.RWMutex{}
+	ring      = &logRing{}
+)
+
+func init() {
+	go broadcastLogs()
+}
+
+// broadcastLogs 从日志通道读取日志,写入环形缓冲区并发送给过滤条件匹配的webui连接
+func broadcastLogs() {
+	for logEntry := range LogChannel() {
+		lock.Lock()
+		ring.add(logEntry)
+		for client := range wsClients {
+			if !client.matches(logEntry) {
+				continue
+			}
+			select {
+			case client.send <- logEntry:
+				// 成功发送日志到客户端
+			default:
+				// 客户端的send通道满了,丢弃这条日志,浏览器跟不上时不阻塞其他连接
+			}
+		}
+		lock.Unlock()
+	}
+}
+
+func (c *Client) matches(entry EnhancedLogEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.filter.match(entry)
+}
+
+// subscribe 更新过滤条件,并补发缓冲区中匹配新条件的最近日志
+func (c *Client) subscribe(filter *compiledFilter) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	c.mu.Lock()
+	c.filter = filter
+	var backlog []EnhancedLogEntry
+	for _, entry := range ring.snapshot() {
+		if filter.match(entry) {
+			backlog = append(backlog, entry)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(backlog) > filter.Backlog {
+		backlog = backlog[len(backlog)-filter.Backlog:]
+	}
+	for _, entry := range backlog {
+		select {
+		case c.send <- entry:
+		default:
+		}
+	}
+	wsClients[c] = true
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// filterFromQuery 从连接的查询参数读取过滤条件,如 ?level=WARN&keyword=xx&regex=xx&group_id=xx&user_id=xx&backlog=100
+func filterFromQuery(c *gin.Context) LogFilter {
+	backlog, _ := strconv.Atoi(c.Query("backlog"))
+	return LogFilter{
+		Level:   c.Query("level"),
+		Keyword: c.Query("keyword"),
+		Regex:   c.Query("regex"),
+		GroupID: c.Query("group_id"),
+		UserID:  c.Query("user_id"),
+		Backlog: backlog,
+	}
+}
+
+func WsHandlerWithDependencies(c *gin.Context) {
+	filter, err := compileFilter(filterFromQuery(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		fmt.Println("无法升级为websocket:", err)
+		return
+	}
+
+	client := &Client{conn: ws, send: make(chan EnhancedLogEntry, logBufferSize)}
+	client.subscribe(filter)
+
+	// 输出新的 WebSocket 客户端连接信息
+	fmt.Println("新的webui用户已连接!")
+
+	go client.writePump()
+	client.readPump()
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		lock.Lock()
+		delete(wsClients, c) // 从客户端集合中移除当前客户端
+		lock.Unlock()
+		c.conn.Close() // 关闭WebSocket连接
+	}()
+
+	// 设置读取超时时间
+	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				fmt.Printf("websocket closed unexpectedly: %v", err)
+			} else {
+				fmt.Println("读取websocket出错:", err)
+			}
+			break
+		}
+
+		// 检查收到的消息是否为心跳
+		if string(message) == "heartbeat" {
+			//fmt.Println("收到心跳，客户端活跃")
+			c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			// 更新客户端的活跃时间，或执行其它心跳相关逻辑
+			continue
+		}
+
+		// 其他消息为新的过滤条件,格式与LogFilter相同
+		var f LogFilter
+		if err := json.Unmarshal(message, &f); err != nil {
+			continue
+		}
+		filter, err := compileFilter(f)
+		if err != nil {
+			fmt.Println("webui日志过滤条件错误:", err)
+			continue
+		}
+		c.subscribe(filter)
+	}
+}
+
+func (c *Client) writePump() {
+	defer func() {
+		lock.Lock()
+		delete(wsClients, c) // 从客户端集合中移除当前客户端
+		lock.Unlock()
+		c.conn.Close() // 关闭WebSocket连接
+	}()
+
+	// 设置心跳发送间隔
+	heartbeatTicker := time.NewTicker(10 * time.Second)
+	defer heartbeatTicker.Stop()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				// 如果send通道已经关闭，那么直接退出
+				return
+			}
+			// 更新写入超时时间
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err := c.conn.WriteJSON(message)
+			if err != nil {
+				// 如果写入websocket出错，输出错误并退出
+				fmt.Println("发送到websocket出错:", err)
+				return
+			}
+		case <-heartbeatTicker.C:
+			// 发送心跳消息
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				// 如果写入心跳失败，输出错误并退出
+				fmt.Println("发送心跳失败:", err)
+				return
+			}
+			//fmt.Println("发送心跳，维持连接活跃")
+		}
+	}
+}
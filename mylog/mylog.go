@@ -1,16 +1,14 @@
 package mylog
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"github.com/hoshinonyaruko/gensokyo/config"
 )
 
@@ -25,10 +23,13 @@ const (
 
 var currentLevel = LogLevelInfo // 默认日志级别为 INFO
 
-type Client struct {
-	conn *websocket.Conn
-	send chan EnhancedLogEntry
-}
+// 日志格式
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var jsonFormat bool // 是否以json格式输出日志
 
 type MyLogAdapter struct {
 	Level         LogLevel
@@ -66,6 +67,55 @@ func init() {
 // 全局变量，用于存储日志启用状态
 var enableFileLogGlobal bool
 
+// SetLogFormat 设置日志格式,json为每行一个json对象,其他值为文本
+func SetLogFormat(format string) {
+	jsonFormat = format == LogFormatJSON
+}
+
+// jsonLogLine json格式日志的一行
+type jsonLogLine struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Msg     string `json:"msg"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// formatLogLine 按日志格式生成写入文件的一行日志
+func formatLogLine(level, traceID, message string) string {
+	now := time.Now()
+	if jsonFormat {
+		line, err := json.Marshal(jsonLogLine{
+			Time:    now.Format(time.RFC3339Nano),
+			Level:   level,
+			Msg:     strings.TrimRight(message, "\n"),
+			TraceID: traceID,
+		})
+		if err == nil {
+			return string(line) + "\n"
+		}
+	}
+	return fmt.Sprintf("[%s] %s: %s\n", now.Format("2006-01-02T15:04:05"), level, withTracePrefix(traceID, message))
+}
+
+// withTracePrefix 文本格式的日志在信息前加上链路追踪ID
+func withTracePrefix(traceID, message string) string {
+	if traceID == "" {
+		return message
+	}
+	return "[trace:" + traceID + "] " + message
+}
+
+// writeLog 输出一行日志到控制台、日志文件和webui
+func writeLog(level, traceID, message string) {
+	if jsonFormat {
+		log.Writer().Write([]byte(formatLogLine(level, traceID, message)))
+	} else {
+		log.Print(withTracePrefix(traceID, message))
+	}
+	emitLog(level, traceID, message)
+	logToFile(level, traceID, message)
+}
+
 // SetEnableFileLog 设置 enableFileLogGlobal 的值
 func SetEnableFileLog(value bool) {
 	enableFileLogGlobal = value
@@ -113,41 +163,20 @@ func (adapter *MyLogAdapter) logToFile(level, message string) {
 	if !adapter.EnableFileLog {
 		return
 	}
-	filename := getCurrentLogFilename()
-	filepath := adapter.FileLogPath + "/" + filename
-
-	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Println("Error opening log file:", err)
-		return
-	}
-	defer file.Close()
-
-	logEntry := fmt.Sprintf("[%s] %s: %s\n", time.Now().Format("2006-01-02T15:04:05"), level, message)
-	if _, err := file.WriteString(logEntry); err != nil {
-		fmt.Println("Error writing to log file:", err)
-	}
+	fileLog.WriteString(formatLogLine(level, "", message))
 }
 
 // 独立的文件日志记录函数
 func LogToFile(level, message string) {
-	if !enableFileLogGlobal {
-		return
-	}
-	filename := getCurrentLogFilename()
-	filepath := logPath + "/" + filename
+	logToFile(level, "", message)
+}
 
-	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Println("Error opening log file:", err)
+// 带链路追踪ID的文件日志记录函数
+func logToFile(level, traceID, message string) {
+	if !enableFileLogGlobal {
 		return
 	}
-	defer file.Close()
-
-	logEntry := fmt.Sprintf("[%s] %s: %s\n", time.Now().Format("2006-01-02T15:04:05"), level, message)
-	if _, err := file.WriteString(logEntry); err != nil {
-		fmt.Println("Error writing to log file:", err)
-	}
+	fileLog.WriteString(formatLogLine(level, traceID, message))
 }
 
 // Debug logs a message at the debug level.
@@ -156,7 +185,7 @@ func (adapter *MyLogAdapter) Debug(v ...interface{}) {
 		message := fmt.Sprint(v...)
 		Println(v...)
 		adapter.logToFile("DEBUG", message)
-		emitLog("DEBUG", message)
+		emitLog("DEBUG", "", message)
 	}
 }
 
@@ -166,7 +195,7 @@ func (adapter *MyLogAdapter) Info(v ...interface{}) {
 		message := fmt.Sprint(v...)
 		Println(v...)
 		adapter.logToFile("INFO", message)
-		emitLog("INFO", message)
+		emitLog("INFO", "", message)
 	}
 }
 
@@ -176,7 +205,7 @@ func (adapter *MyLogAdapter) Warn(v ...interface{}) {
 		message := fmt.Sprint(v...)
 		Printf("WARN: %v\n", v...)
 		adapter.logToFile("WARN", message)
-		emitLog("WARN", message)
+		emitLog("WARN", "", message)
 	}
 }
 
@@ -186,7 +215,7 @@ func (adapter *MyLogAdapter) Error(v ...interface{}) {
 		message := fmt.Sprint(v...)
 		Printf("ERROR: %v\n", v...)
 		adapter.logToFile("ERROR", message)
-		emitLog("ERROR", message)
+		emitLog("ERROR", "", message)
 	}
 }
 
@@ -196,7 +225,7 @@ func (adapter *MyLogAdapter) Debugf(format string, v ...interface{}) {
 		message := fmt.Sprintf(format, v...)
 		Printf("DEBUG: "+format, v...)
 		adapter.logToFile("DEBUG", message)
-		emitLog("DEBUG", message)
+		emitLog("DEBUG", "", message)
 	}
 }
 
@@ -206,7 +235,7 @@ func (adapter *MyLogAdapter) Infof(format string, v ...interface{}) {
 		message := fmt.Sprintf(format, v...)
 		Printf("INFO: "+format, v...)
 		adapter.logToFile("INFO", message)
-		emitLog("INFO", message)
+		emitLog("INFO", "", message)
 	}
 }
 
@@ -216,7 +245,7 @@ func (adapter *MyLogAdapter) Warnf(format string, v ...interface{}) {
 		message := fmt.Sprintf(format, v...)
 		Printf("WARN: "+format, v...)
 		adapter.logToFile("WARN", message)
-		emitLog("WARN", message)
+		emitLog("WARN", "", message)
 	}
 }
 
@@ -226,7 +255,7 @@ func (adapter *MyLogAdapter) Errorf(format string, v ...interface{}) {
 		message := fmt.Sprintf(format, v...)
 		Printf("ERROR: "+format, v...)
 		adapter.logToFile("ERROR", message)
-		emitLog("ERROR", message)
+		emitLog("ERROR", "", message)
 	}
 }
 
@@ -238,14 +267,11 @@ func (adapter *MyLogAdapter) Sync() error {
 	return nil
 }
 
-// 全局 WebSocket 客户端集合
-var wsClients = make(map[*Client]bool)
-var lock = sync.RWMutex{}
-
 type EnhancedLogEntry struct {
 	Time    string `json:"time"`
 	Level   string `json:"level"`
 	Message string `json:"message"`
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // 日志频道，所有的 WebSocket 客户端都会在此监听日志事件
@@ -261,53 +287,39 @@ func SetLogLevel(level LogLevel) {
 
 func Println(v ...interface{}) {
 	if currentLevel <= LogLevelInfo {
-		log.Println(v...)
-		message := fmt.Sprint(v...)
-		emitLog("INFO", message)
-		LogToFile("INFO", message)
+		writeLog("INFO", "", strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 	}
 }
 
 func Printf(format string, v ...interface{}) {
 	if currentLevel <= LogLevelInfo {
-		log.Printf(format, v...)
-		message := fmt.Sprintf(format, v...)
-		emitLog("INFO", message)
-		LogToFile("INFO", message)
+		writeLog("INFO", "", fmt.Sprintf(format, v...))
 	}
 }
 
 func Warnf(format string, v ...interface{}) {
 	if currentLevel <= LogLevelWarn {
-		log.Printf(format, v...)
-		message := fmt.Sprintf(format, v...)
-		emitLog("WARN", message)
-		LogToFile("WARN", message)
+		writeLog("WARN", "", fmt.Sprintf(format, v...))
 	}
 }
 
 func Errorf(format string, v ...interface{}) {
 	if currentLevel <= LogLevelError {
-		log.Printf(format, v...)
-		message := fmt.Sprintf(format, v...)
-		emitLog("ERROR", message)
-		LogToFile("ERROR", message)
+		writeLog("ERROR", "", fmt.Sprintf(format, v...))
 	}
 }
 
 func Fatalf(format string, v ...interface{}) {
-	log.Printf(format, v...)
-	message := fmt.Sprintf(format, v...)
-	emitLog("FATAL", message)
-	LogToFile("FATAL", message)
+	writeLog("FATAL", "", fmt.Sprintf(format, v...))
 	os.Exit(1) // Fatal logs usually terminate the program
 }
 
-func emitLog(level, message string) {
+func emitLog(level, traceID, message string) {
 	entry := EnhancedLogEntry{
 		Time:    time.Now().Format("2006-01-02T15:04:05"),
 		Level:   level,
 		Message: message,
+		TraceID: traceID,
 	}
 	// 非阻塞发送，如果通道满了就尝试备份日志。
 	select {
@@ -323,115 +335,3 @@ func emitLog(level, message string) {
 func LogChannel() chan EnhancedLogEntry {
 	return logChannel
 }
-
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-func WsHandlerWithDependencies(c *gin.Context) {
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		fmt.Println("无法升级为websocket:", err)
-		return
-	}
-
-	client := &Client{conn: ws, send: make(chan EnhancedLogEntry)}
-
-	lock.Lock()
-	wsClients[client] = true
-	lock.Unlock()
-
-	// 输出新的 WebSocket 客户端连接信息
-	fmt.Println("新的webui用户已连接!")
-
-	go client.writePump()
-	go client.readPump()
-
-	for logEntry := range LogChannel() {
-		lock.RLock()
-		// 去掉对wsClients长度的检查，已经在emitLog里面做了防阻塞处理
-		for client := range wsClients {
-			select {
-			case client.send <- logEntry:
-				// 成功发送日志到客户端
-			default:
-				// 客户端的send通道满了，可以选择断开客户端连接或者其他处理
-			}
-		}
-		lock.RUnlock()
-	}
-}
-
-func (c *Client) readPump() {
-	defer func() {
-		lock.Lock()
-		delete(wsClients, c) // 从客户端集合中移除当前客户端
-		lock.Unlock()
-		c.conn.Close() // 关闭WebSocket连接
-	}()
-
-	// 设置读取超时时间
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
-
-	for {
-		_, message, err := c.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				fmt.Printf("websocket closed unexpectedly: %v", err)
-			} else {
-				fmt.Println("读取websocket出错:", err)
-			}
-			break
-		}
-
-		// 检查收到的消息是否为心跳
-		if string(message) == "heartbeat" {
-			//fmt.Println("收到心跳，客户端活跃")
-			c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-			// 更新客户端的活跃时间，或执行其它心跳相关逻辑
-		}
-	}
-}
-
-func (c *Client) writePump() {
-	defer func() {
-		lock.Lock()
-		delete(wsClients, c) // 从客户端集合中移除当前客户端
-		lock.Unlock()
-		c.conn.Close() // 关闭WebSocket连接
-	}()
-
-	// 设置心跳发送间隔
-	heartbeatTicker := time.NewTicker(10 * time.Second)
-	defer heartbeatTicker.Stop()
-
-	for {
-		select {
-		case message, ok := <-c.send:
-			if !ok {
-				// 如果send通道已经关闭，那么直接退出
-				return
-			}
-			// 更新写入超时时间
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			err := c.conn.WriteJSON(message)
-			if err != nil {
-				// 如果写入websocket出错，输出错误并退出
-				fmt.Println("发送到websocket出错:", err)
-				return
-			}
-		case <-heartbeatTicker.C:
-			// 发送心跳消息
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				// 如果写入心跳失败，输出错误并退出
-				fmt.Println("发送心跳失败:", err)
-				return
-			}
-			//fmt.Println("发送心跳，维持连接活跃")
-		}
-	}
-}
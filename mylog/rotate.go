@@ -0,0 +1,230 @@
+package mylog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+)
+
+// rotatingFile 按时间窗口和大小切分的日志文件,切分后的文件可gzip压缩,并按数量和天数清理
+// 大小、数量、天数和是否压缩每次写入时从配置读取,支持热重载
+type rotatingFile struct {
+	mu      sync.Mutex
+	archMu  sync.Mutex             // 压缩与清理依次执行,避免清理掉正在压缩的文件
+	name    func() string          // 当前时间窗口的文件名
+	owns    func(name string) bool // 文件是否属于这个日志(包括已切分的)
+	file    *os.File
+	current string
+	size    int64
+}
+
+// 普通日志,文件名为 2006-01-02.log 或 2006-01-02-15-04.log
+var fileLog = &rotatingFile{
+	name: getCurrentLogFilename,
+	owns: func(name string) bool {
+		return isLogFile(name) && !strings.Contains(name, "-error")
+	},
+}
+
+// 错误日志,文件名为 2006-01-02-error.log
+var errFileLog = &rotatingFile{
+	name: func() string {
+		return time.Now().Format("2006-01-02") + "-error.log"
+	},
+	owns: func(name string) bool {
+		return isLogFile(name) && strings.Contains(name, "-error")
+	},
+}
+
+func isLogFile(name string) bool {
+	return strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz")
+}
+
+// WriteString 写入一行日志,必要时先切分文件
+func (r *rotatingFile) WriteString(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := logPath
+	name := r.name()
+	if r.file != nil && name != r.current {
+		// 进入新的时间窗口,归档上一个窗口的文件
+		r.closeFile()
+		r.archive(dir, r.current, r.current)
+	}
+
+	maxSize := int64(config.GetLogMaxSizeMB()) * 1024 * 1024
+	if r.file == nil {
+		first := r.current == ""
+		if err := r.open(dir, name); err != nil {
+			fmt.Println("Error opening log file:", err)
+			return
+		}
+		if first {
+			// 启动后第一次写入时清理上次运行留下的过期文件
+			go func() {
+				r.archMu.Lock()
+				defer r.archMu.Unlock()
+				r.cleanup(dir)
+			}()
+		}
+	}
+	if maxSize > 0 && r.size > 0 && r.size+int64(len(line)) > maxSize {
+		// 超过大小限制,切分当前文件后写入新文件
+		r.closeFile()
+		r.archive(dir, name, rotatedName(dir, name))
+		if err := r.open(dir, name); err != nil {
+			fmt.Println("Error opening log file:", err)
+			return
+		}
+	}
+
+	n, err := r.file.WriteString(line)
+	r.size += int64(n)
+	if err != nil {
+		fmt.Println("Error writing to log file:", err)
+	}
+}
+
+func (r *rotatingFile) open(dir, name string) error {
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.current = name
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// archive 将已关闭的日志文件改名为target,按配置压缩,然后清理过期的文件
+func (r *rotatingFile) archive(dir, name, target string) {
+	if target != name {
+		if err := os.Rename(filepath.Join(dir, name), filepath.Join(dir, target)); err != nil {
+			fmt.Println("Error rotating log file:", err)
+			return
+		}
+	}
+	compress := config.GetLogCompress()
+	go func() {
+		r.archMu.Lock()
+		defer r.archMu.Unlock()
+		if compress {
+			if err := compressFile(filepath.Join(dir, target)); err != nil {
+				fmt.Println("Error compressing log file:", err)
+			}
+		}
+		r.cleanup(dir)
+	}()
+}
+
+// rotatedName 切分后的文件名,如 2006-01-02-150405.log
+func rotatedName(dir, name string) string {
+	base := strings.TrimSuffix(name, ".log") + "-" + time.Now().Format("150405")
+	target := base + ".log"
+	for i := 1; ; i++ {
+		_, err := os.Stat(filepath.Join(dir, target))
+		_, errGz := os.Stat(filepath.Join(dir, target+".gz"))
+		if os.IsNotExist(err) && os.IsNotExist(errGz) {
+			return target
+		}
+		target = fmt.Sprintf("%s.%d.log", base, i)
+	}
+}
+
+// compressFile 将文件压缩为 .gz 并删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// cleanup 删除超过保留天数的文件,以及超过保留数量的最旧的文件,不包括正在写入的文件
+func (r *rotatingFile) cleanup(dir string) {
+	maxFiles := config.GetLogMaxFiles()
+	maxAge := config.GetLogMaxAgeDays()
+	if maxFiles <= 0 && maxAge <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	current := r.current
+	r.mu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type archived struct {
+		name    string
+		modTime time.Time
+	}
+	var files []archived
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == current || !r.owns(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, archived{name: entry.Name(), modTime: info.ModTime()})
+	}
+	// 最新的在前
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	expire := time.Now().AddDate(0, 0, -maxAge)
+	for i, f := range files {
+		if (maxFiles > 0 && i >= maxFiles) || (maxAge > 0 && f.modTime.Before(expire)) {
+			if err := os.Remove(filepath.Join(dir, f.name)); err != nil && !os.IsNotExist(err) {
+				fmt.Println("Error removing log file:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package mylog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 链路追踪ID的保留时间,超过后应用端再调用action将生成新的追踪ID
+const traceTTL = 10 * time.Minute
+
+type traceEntry struct {
+	traceID string
+	at      time.Time
+}
+
+// traceConversation 链路追踪ID所属事件的群号和用户id
+type traceConversation struct {
+	groupID string
+	userID  string
+	at      time.Time
+}
+
+var (
+	traceMapping       sync.Map // 事件id、信息id、echo => traceEntry
+	traceConversations sync.Map // 链路追踪ID => traceConversation
+	traceCleanOnce     sync.Once
+)
+
+// NewTraceID 生成一个新的链路追踪ID
+func NewTraceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// BindTrace 将key(信息id、echo等)关联到链路追踪ID,之后可通过TraceOf找回
+func BindTrace(key string, traceID string) {
+	if key == "" || traceID == "" {
+		return
+	}
+	traceCleanOnce.Do(func() {
+		go cleanupTraces()
+	})
+	traceMapping.Store(key, traceEntry{traceID: traceID, at: time.Now()})
+}
+
+// ConversationKey 会话(群或私聊对象)关联链路追踪ID时使用的key,kind为group或user
+func ConversationKey(kind string, id string) string {
+	if id == "" || id == "0" {
+		return ""
+	}
+	return "conversation:" + kind + ":" + id
+}
+
+// BindConversation 记录链路追踪ID所属事件的群号和用户id,webui按群号或用户订阅日志时使用
+func BindConversation(traceID string, groupID string, userID string) {
+	if traceID == "" || (groupID == "" && userID == "") {
+		return
+	}
+	traceCleanOnce.Do(func() {
+		go cleanupTraces()
+	})
+	traceConversations.Store(traceID, traceConversation{groupID: groupID, userID: userID, at: time.Now()})
+}
+
+// ConversationOf 获取链路追踪ID所属事件的群号和用户id,没有记录时ok为false
+func ConversationOf(traceID string) (groupID string, userID string, ok bool) {
+	if traceID == "" {
+		return "", "", false
+	}
+	value, ok := traceConversations.Load(traceID)
+	if !ok {
+		return "", "", false
+	}
+	c := value.(traceConversation)
+	return c.groupID, c.userID, true
+}
+
+// TraceOf 获取key关联的链路追踪ID,不存在时返回空
+func TraceOf(key string) string {
+	if key == "" {
+		return ""
+	}
+	value, ok := traceMapping.Load(key)
+	if !ok {
+		return ""
+	}
+	return value.(traceEntry).traceID
+}
+
+func cleanupTraces() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		expire := time.Now().Add(-traceTTL)
+		traceMapping.Range(func(key, value interface{}) bool {
+			if value.(traceEntry).at.Before(expire) {
+				traceMapping.Delete(key)
+			}
+			return true
+		})
+		traceConversations.Range(func(key, value interface{}) bool {
+			if value.(traceConversation).at.Before(expire) {
+				traceConversations.Delete(key)
+			}
+			return true
+		})
+	}
+}
+
+// TraceLogger 输出的每行日志都带有同一个链路追踪ID
+type TraceLogger struct {
+	traceID string
+}
+
+// WithTrace 返回带有链路追踪ID的日志记录器,traceID为空时与普通日志相同
+func WithTrace(traceID string) *TraceLogger {
+	return &TraceLogger{traceID: traceID}
+}
+
+// TraceID 返回链路追踪ID
+func (t *TraceLogger) TraceID() string {
+	return t.traceID
+}
+
+func (t *TraceLogger) Printf(format string, v ...interface{}) {
+	if currentLevel <= LogLevelInfo {
+		writeLog("INFO", t.traceID, fmt.Sprintf(format, v...))
+	}
+}
+
+func (t *TraceLogger) Warnf(format string, v ...interface{}) {
+	if currentLevel <= LogLevelWarn {
+		writeLog("WARN", t.traceID, fmt.Sprintf(format, v...))
+	}
+}
+
+func (t *TraceLogger) Errorf(format string, v ...interface{}) {
+	if currentLevel <= LogLevelError {
+		writeLog("ERROR", t.traceID, fmt.Sprintf(format, v...))
+	}
+}
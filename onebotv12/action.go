@@ -0,0 +1,219 @@
+package onebotv12
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+)
+
+// v12 action 到 v11 action 的映射,未列出的action直接使用原名(去掉qq.前缀)
+var actionMapping = map[string]string{
+	"get_self_info":           "get_login_info",
+	"get_version":             "get_version_info",
+	"delete_message":          "delete_msg",
+	"get_group_member_info":   "get_group_member_info",
+	"get_group_member_list":   "get_group_member_list",
+	"get_channel_list":        "get_channel_list",
+	"get_guild_list":          "get_guild_list",
+	"get_friend_list":         "get_friend_list",
+	"get_group_list":          "get_group_list",
+	"get_group_info":          "get_group_info",
+	"set_group_name":          "set_group_name",
+	"leave_group":             "set_group_leave",
+	"get_status":              "get_status",
+	"get_message":             "get_msg",
+	"send_message":            "send_msg",
+	"get_supported_actions":   "get_supported_actions",
+	"get_guild_member_info":   "get_guild_member_info",
+	"get_guild_member_list":   "get_guild_member_list",
+	"get_channel_member_info": "get_channel_member_info",
+}
+
+// 由适配器自身回答,不需要转发给v11 handler的action
+const ActionGetSupportedActions = "get_supported_actions"
+
+// v12Action onebotv12的action请求
+type v12Action struct {
+	Action string                 `json:"action"`
+	Params map[string]interface{} `json:"params"`
+	Echo   interface{}            `json:"echo,omitempty"`
+	Self   map[string]interface{} `json:"self,omitempty"`
+}
+
+// ParseAction 将v12的action请求解析为v11的ActionMessage,返回值中的string为原始v12 action名称
+func ParseAction(data []byte) (callapi.ActionMessage, string, error) {
+	var action v12Action
+	if err := json.Unmarshal(data, &action); err != nil {
+		return callapi.ActionMessage{}, "", err
+	}
+	if action.Params == nil {
+		action.Params = map[string]interface{}{}
+	}
+
+	v11Action := action.Action
+	if mapped, ok := actionMapping[action.Action]; ok {
+		v11Action = mapped
+	} else if len(action.Action) > len(Platform)+1 && action.Action[:len(Platform)+1] == Platform+"." {
+		v11Action = action.Action[len(Platform)+1:]
+	}
+
+	params := convertParamsToV11(action.Action, action.Params)
+
+	v11 := map[string]interface{}{
+		"action": v11Action,
+		"params": params,
+	}
+	if action.Echo != nil {
+		v11["echo"] = action.Echo
+	}
+
+	raw, err := json.Marshal(v11)
+	if err != nil {
+		return callapi.ActionMessage{}, action.Action, err
+	}
+	var message callapi.ActionMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return callapi.ActionMessage{}, action.Action, err
+	}
+	return message, action.Action, nil
+}
+
+func convertParamsToV11(action string, params map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		out[key] = value
+	}
+
+	if action == "send_message" {
+		detailType, _ := params["detail_type"].(string)
+		switch detailType {
+		case "private":
+			out["message_type"] = "private"
+		case "group":
+			out["message_type"] = "group"
+		case "channel":
+			out["message_type"] = "guild"
+		}
+		delete(out, "detail_type")
+		if message, ok := params["message"]; ok {
+			out["message"] = ConvertMessageToV11(message)
+		}
+	}
+
+	return out
+}
+
+// ConvertMessageToV11 将v12的segment数组转换为v11的segment数组
+func ConvertMessageToV11(message interface{}) interface{} {
+	items, ok := message.([]interface{})
+	if !ok {
+		// 字符串等其他格式直接交给v11处理
+		return message
+	}
+	segments := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		seg, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		segType, _ := seg["type"].(string)
+		data, _ := seg["data"].(map[string]interface{})
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		switch segType {
+		case "text":
+			segments = append(segments, segmentV11("text", map[string]interface{}{"text": data["text"]}))
+		case "mention":
+			segments = append(segments, segmentV11("at", map[string]interface{}{"qq": IDToString(data["user_id"])}))
+		case "mention_all":
+			segments = append(segments, segmentV11("at", map[string]interface{}{"qq": "all"}))
+		case "image":
+			segments = append(segments, segmentV11("image", map[string]interface{}{"file": fileOf(data)}))
+		case "voice", "audio":
+			segments = append(segments, segmentV11("record", map[string]interface{}{"file": fileOf(data)}))
+		case "video":
+			segments = append(segments, segmentV11("video", map[string]interface{}{"file": fileOf(data)}))
+		case "reply":
+			segments = append(segments, segmentV11("reply", map[string]interface{}{"id": IDToString(data["message_id"])}))
+		default:
+			if len(segType) > len(Platform)+1 && segType[:len(Platform)+1] == Platform+"." {
+				segType = segType[len(Platform)+1:]
+			}
+			segments = append(segments, segmentV11(segType, data))
+		}
+	}
+	return segments
+}
+
+// fileOf v12的文件以file_id表示,gensokyo的file_id即为url或base64,保留qq.url优先
+func fileOf(data map[string]interface{}) string {
+	if url, ok := data[Platform+".url"].(string); ok && url != "" {
+		return url
+	}
+	if url, ok := data["url"].(string); ok && url != "" {
+		return url
+	}
+	return IDToString(data["file_id"])
+}
+
+func segmentV11(segType string, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": segType,
+		"data": data,
+	}
+}
+
+// SupportedActionsResponse get_supported_actions的响应
+func SupportedActionsResponse(echo interface{}) map[string]interface{} {
+	actions := make([]string, 0)
+	registered := make(map[string]bool)
+	for _, action := range callapi.RegisteredActions() {
+		registered[action] = true
+	}
+	for v12Name, v11Name := range actionMapping {
+		if registered[v11Name] || v12Name == ActionGetSupportedActions {
+			actions = append(actions, v12Name)
+		}
+	}
+	for action := range registered {
+		actions = append(actions, Platform+"."+action)
+	}
+	sort.Strings(actions)
+	return OkResponse(actions, echo)
+}
+
+// OkResponse 构造v12的成功响应
+func OkResponse(data interface{}, echo interface{}) map[string]interface{} {
+	response := map[string]interface{}{
+		"status":  "ok",
+		"retcode": 0,
+		"data":    data,
+		"message": "",
+	}
+	if echo != nil {
+		response["echo"] = echo
+	}
+	return response
+}
+
+// FailedResponse 构造v12的失败响应
+func FailedResponse(retcode int, message string, echo interface{}) map[string]interface{} {
+	response := map[string]interface{}{
+		"status":  "failed",
+		"retcode": retcode,
+		"data":    nil,
+		"message": message,
+	}
+	if echo != nil {
+		response["echo"] = echo
+	}
+	return response
+}
+
+// UnsupportedActionResponse v12标准的不支持的动作响应
+func UnsupportedActionResponse(action string, echo interface{}) map[string]interface{} {
+	return FailedResponse(10002, fmt.Sprintf("unsupported action: %s", action), echo)
+}
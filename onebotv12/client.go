@@ -0,0 +1,129 @@
+package onebotv12
+
+import (
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+)
+
+// 响应中需要转换为字符串的id字段
+var idFields = map[string]bool{
+	"user_id":    true,
+	"group_id":   true,
+	"guild_id":   true,
+	"channel_id": true,
+	"message_id": true,
+	"real_id":    true,
+	"self_id":    true,
+}
+
+// Client 包装v11的client,把handler产生的v11响应转换为v12响应后再发送
+type Client struct {
+	client callapi.Client
+	action string
+}
+
+// NewClient 创建一个将响应转换为v12格式的client,action为原始v12 action名称
+func NewClient(client callapi.Client, action string) *Client {
+	return &Client{
+		client: client,
+		action: action,
+	}
+}
+
+func (c *Client) SendMessage(message map[string]interface{}) error {
+	return c.client.SendMessage(ConvertResponse(c.action, message))
+}
+
+// ConvertResponse 将v11的action响应转换为v12的action响应
+func ConvertResponse(action string, response map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(response))
+	for key, value := range response {
+		out[key] = value
+	}
+	if _, ok := out["message"]; !ok {
+		out["message"] = ""
+	}
+	if out["data"] == nil {
+		return out
+	}
+
+	data := convertIDs(out["data"])
+	switch action {
+	case "get_self_info":
+		if m, ok := data.(map[string]interface{}); ok {
+			data = map[string]interface{}{
+				"user_id":          m["user_id"],
+				"user_name":        m["nickname"],
+				"user_displayname": "",
+			}
+		}
+	case "get_version":
+		if m, ok := data.(map[string]interface{}); ok {
+			version, _ := m["app_version"].(string)
+			if version == "" {
+				version = Version
+			}
+			data = map[string]interface{}{
+				"impl":           Impl,
+				"version":        version,
+				"onebot_version": "12",
+			}
+		}
+	case "send_message":
+		if m, ok := data.(map[string]interface{}); ok {
+			if _, ok := m["time"]; !ok {
+				m["time"] = eventTime(nil)
+			}
+		}
+	case "get_friend_list", "get_group_member_list", "get_guild_member_list":
+		data = renameEach(data, "nickname", "user_name")
+	case "get_group_member_info", "get_guild_member_info":
+		if m, ok := data.(map[string]interface{}); ok {
+			rename(m, "nickname", "user_name")
+		}
+	}
+	out["data"] = data
+	return out
+}
+
+// convertIDs 递归将id字段转换为字符串
+func convertIDs(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if idFields[key] {
+				if s := IDToString(item); s != "" {
+					value[key] = s
+					continue
+				}
+			}
+			value[key] = convertIDs(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = convertIDs(item)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+func renameEach(v interface{}, from, to string) interface{} {
+	if list, ok := v.([]interface{}); ok {
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				rename(m, from, to)
+			}
+		}
+	}
+	return v
+}
+
+func rename(m map[string]interface{}, from, to string) {
+	if value, ok := m[from]; ok {
+		if _, exists := m[to]; !exists {
+			m[to] = value
+		}
+	}
+}
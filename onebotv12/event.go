@@ -0,0 +1,299 @@
+// onebotv12适配器,将v11的事件和action转换为onebotv12格式,复用现有的handler
+package onebotv12
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Platform = "qq"
+	Impl     = "gensokyo"
+	Version  = "v1.0.0"
+)
+
+// v11 notice_type 到 v12 detail_type 的映射,未列出的类型使用qq.前缀扩展
+var noticeTypeMapping = map[string]string{
+	"group_increase":  "group_member_increase",
+	"group_decrease":  "group_member_decrease",
+	"group_recall":    "group_message_delete",
+	"friend_add":      "friend_increase",
+	"friend_decrease": "friend_decrease",
+	"friend_recall":   "private_message_delete",
+}
+
+// v11事件中会被转换为v12标准字段的键,其余字段以qq.前缀保留
+var knownEventFields = map[string]bool{
+	"post_type":       true,
+	"message_type":    true,
+	"notice_type":     true,
+	"request_type":    true,
+	"meta_event_type": true,
+	"sub_type":        true,
+	"time":            true,
+	"self_id":         true,
+	"message_id":      true,
+	"message":         true,
+	"raw_message":     true,
+	"user_id":         true,
+	"group_id":        true,
+	"guild_id":        true,
+	"channel_id":      true,
+	"operator_id":     true,
+	"interval":        true,
+	"status":          true,
+	"echo":            true,
+	"font":            true,
+	"message_seq":     true,
+	"self_tiny_id":    true,
+}
+
+var cqCodePattern = regexp.MustCompile(`\[CQ:(\w+)((?:,[^\]]*)?)\]`)
+
+// IDToString 将v11中的int或string类型id统一为v12要求的字符串
+func IDToString(v interface{}) string {
+	switch id := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(id)
+	case int64:
+		return strconv.FormatInt(id, 10)
+	case uint64:
+		return strconv.FormatUint(id, 10)
+	default:
+		return ""
+	}
+}
+
+// IsEvent 判断一个v11的map是否为事件(而不是action的响应)
+func IsEvent(message map[string]interface{}) bool {
+	_, ok := message["post_type"]
+	return ok
+}
+
+// ConvertEvent 将v11事件转换为v12事件
+func ConvertEvent(event map[string]interface{}) map[string]interface{} {
+	postType, _ := event["post_type"].(string)
+	subType, _ := event["sub_type"].(string)
+
+	out := map[string]interface{}{
+		"id":       uuid.New().String(),
+		"time":     eventTime(event["time"]),
+		"sub_type": subType,
+		"self": map[string]interface{}{
+			"platform": Platform,
+			"user_id":  IDToString(event["self_id"]),
+		},
+	}
+
+	switch postType {
+	case "message":
+		out["type"] = "message"
+		messageType, _ := event["message_type"].(string)
+		switch messageType {
+		case "guild":
+			out["detail_type"] = "channel"
+		case "group", "private":
+			out["detail_type"] = messageType
+		default:
+			out["detail_type"] = Platform + "." + messageType
+		}
+		// v12的sub_type只用于扩展,normal/friend等v11子类型不再需要
+		if subType == "normal" || subType == "friend" || subType == "group" {
+			out["sub_type"] = ""
+		}
+		out["message_id"] = IDToString(event["message_id"])
+		out["message"] = ConvertMessageToV12(event["message"])
+		rawMessage, _ := event["raw_message"].(string)
+		out["alt_message"] = rawMessage
+	case "notice":
+		out["type"] = "notice"
+		noticeType, _ := event["notice_type"].(string)
+		if detailType, ok := noticeTypeMapping[noticeType]; ok {
+			out["detail_type"] = detailType
+		} else {
+			out["detail_type"] = Platform + "." + noticeType
+		}
+		if _, ok := event["operator_id"]; ok {
+			out["operator_id"] = IDToString(event["operator_id"])
+		}
+		if _, ok := event["message_id"]; ok {
+			out["message_id"] = IDToString(event["message_id"])
+		}
+	case "request":
+		out["type"] = "request"
+		requestType, _ := event["request_type"].(string)
+		out["detail_type"] = Platform + "." + requestType
+	case "meta_event":
+		out["type"] = "meta"
+		metaType, _ := event["meta_event_type"].(string)
+		switch metaType {
+		case "lifecycle":
+			out["detail_type"] = "connect"
+			out["sub_type"] = ""
+			out["version"] = map[string]interface{}{
+				"impl":           Impl,
+				"version":        Version,
+				"onebot_version": "12",
+			}
+			// v12的meta事件不包含self
+			delete(out, "self")
+		case "heartbeat":
+			out["detail_type"] = "heartbeat"
+			out["interval"] = event["interval"]
+			delete(out, "self")
+		default:
+			out["detail_type"] = Platform + "." + metaType
+		}
+	default:
+		out["type"] = postType
+	}
+
+	if _, ok := event["user_id"]; ok {
+		out["user_id"] = IDToString(event["user_id"])
+	}
+	if _, ok := event["group_id"]; ok {
+		out["group_id"] = IDToString(event["group_id"])
+	}
+	if _, ok := event["guild_id"]; ok {
+		out["guild_id"] = IDToString(event["guild_id"])
+	}
+	if _, ok := event["channel_id"]; ok {
+		out["channel_id"] = IDToString(event["channel_id"])
+	}
+
+	// gensokyo的增强字段(real_user_id等)以平台前缀保留
+	for key, value := range event {
+		if !knownEventFields[key] {
+			out[Platform+"."+key] = value
+		}
+	}
+
+	return out
+}
+
+func eventTime(v interface{}) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case int64:
+		return float64(t)
+	case int:
+		return float64(t)
+	default:
+		return float64(time.Now().UnixNano()) / 1e9
+	}
+}
+
+// ConvertMessageToV12 将v11的CQ码字符串或segment数组转换为v12的segment数组
+func ConvertMessageToV12(message interface{}) []map[string]interface{} {
+	segments := make([]map[string]interface{}, 0)
+	switch m := message.(type) {
+	case string:
+		return parseCQCode(m)
+	case []interface{}:
+		for _, item := range m {
+			if seg, ok := item.(map[string]interface{}); ok {
+				segments = append(segments, convertSegmentToV12(seg))
+			}
+		}
+	case []map[string]interface{}:
+		for _, seg := range m {
+			segments = append(segments, convertSegmentToV12(seg))
+		}
+	case map[string]interface{}:
+		segments = append(segments, convertSegmentToV12(m))
+	}
+	return segments
+}
+
+func convertSegmentToV12(seg map[string]interface{}) map[string]interface{} {
+	segType, _ := seg["type"].(string)
+	data, _ := seg["data"].(map[string]interface{})
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return convertCQToV12(segType, data)
+}
+
+func convertCQToV12(segType string, data map[string]interface{}) map[string]interface{} {
+	switch segType {
+	case "text":
+		return segment("text", map[string]interface{}{"text": data["text"]})
+	case "at":
+		qq := IDToString(data["qq"])
+		if qq == "all" {
+			return segment("mention_all", map[string]interface{}{})
+		}
+		return segment("mention", map[string]interface{}{"user_id": qq})
+	case "image":
+		file := IDToString(data["file"])
+		out := map[string]interface{}{"file_id": file}
+		if url, ok := data["url"]; ok {
+			out[Platform+".url"] = url
+		} else if strings.HasPrefix(file, "http") {
+			out[Platform+".url"] = file
+		}
+		return segment("image", out)
+	case "record":
+		return segment("voice", map[string]interface{}{"file_id": IDToString(data["file"])})
+	case "video":
+		return segment("video", map[string]interface{}{"file_id": IDToString(data["file"])})
+	case "reply":
+		return segment("reply", map[string]interface{}{"message_id": IDToString(data["id"])})
+	default:
+		return segment(Platform+"."+segType, data)
+	}
+}
+
+// parseCQCode 解析CQ码字符串为v12 segment数组
+func parseCQCode(text string) []map[string]interface{} {
+	segments := make([]map[string]interface{}, 0)
+	last := 0
+	for _, loc := range cqCodePattern.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] > last {
+			segments = append(segments, segment("text", map[string]interface{}{"text": unescapeCQText(text[last:loc[0]])}))
+		}
+		segType := text[loc[2]:loc[3]]
+		data := map[string]interface{}{}
+		for _, kv := range strings.Split(strings.TrimPrefix(text[loc[4]:loc[5]], ","), ",") {
+			if kv == "" {
+				continue
+			}
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 {
+				data[parts[0]] = unescapeCQText(parts[1])
+			}
+		}
+		segments = append(segments, convertCQToV12(segType, data))
+		last = loc[1]
+	}
+	if last < len(text) {
+		segments = append(segments, segment("text", map[string]interface{}{"text": unescapeCQText(text[last:])}))
+	}
+	return segments
+}
+
+func unescapeCQText(s string) string {
+	s = strings.ReplaceAll(s, "&#91;", "[")
+	s = strings.ReplaceAll(s, "&#93;", "]")
+	s = strings.ReplaceAll(s, "&#44;", ",")
+	return html.UnescapeString(s)
+}
+
+func segment(segType string, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": segType,
+		"data": data,
+	}
+}
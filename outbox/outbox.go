@@ -0,0 +1,268 @@
+// 反向ws的补发队列,应用端断开期间的事件储存在磁盘上,重连后按顺序补发
+package outbox
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"go.etcd.io/bbolt"
+)
+
+const DBName = "outbox.db"
+
+var ErrNotOpen = errors.New("outbox db is not open")
+
+var db *bbolt.DB
+
+var pruneTicker *time.Ticker
+
+// 每个地址待补发的事件数,避免每个事件都读取数据库
+var (
+	pendingMu sync.Mutex
+	pending   = make(map[string]int)
+)
+
+// Record 一条待补发的事件,Data为已经序列化好的ws帧
+type Record struct {
+	StoredAt int64  `json:"stored_at"`
+	PostType string `json:"post_type"`
+	Data     []byte `json:"data"`
+}
+
+func InitializeDB() {
+	var err error
+	db, err = bbolt.Open(DBName, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		log.Fatalf("Error opening outbox DB: %v", err)
+	}
+
+	// 每个反向ws地址一个Bucket,统计重启前未补发的事件
+	err = db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			pending[string(name)] = b.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		log.Fatalf("Error reading outbox buckets: %v", err)
+	}
+
+	// 启动时先清理一次,之后每分钟清理一次
+	Prune()
+	pruneTicker = time.NewTicker(time.Minute)
+	go func() {
+		for range pruneTicker.C {
+			Prune()
+		}
+	}()
+}
+
+func CloseDB() {
+	if pruneTicker != nil {
+		pruneTicker.Stop()
+	}
+	if db != nil {
+		db.Close()
+	}
+}
+
+// Pending 返回地址待补发的事件数
+func Pending(address string) int {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	return pending[address]
+}
+
+func addPending(address string, n int) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	pending[address] += n
+	if pending[address] <= 0 {
+		delete(pending, address)
+	}
+}
+
+// Push 将事件加入地址的补发队列,超过outbox_max_size时丢弃最旧的事件
+func Push(address string, postType string, data []byte) error {
+	if db == nil {
+		return ErrNotOpen
+	}
+	value, err := json.Marshal(Record{
+		StoredAt: time.Now().Unix(),
+		PostType: postType,
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+
+	maxSize := config.GetOutboxMaxSize()
+	dropped := 0
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(address))
+		if err != nil {
+			return err
+		}
+		// 超出的数量在写事务中按Put前的条目数计算,写事务中未提交的数据不会体现在Bucket.Stats中
+		// 写事务互斥,同时进行的补发和清理已经提交
+		overflow := 0
+		if maxSize > 0 {
+			overflow = b.Stats().KeyN + 1 - maxSize
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(sequenceKey(seq), value); err != nil {
+			return err
+		}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && dropped < overflow; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			dropped++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	addPending(address, 1-dropped)
+	if dropped > 0 {
+		mylog.Printf("反向ws[%s]补发队列已满,丢弃%d条最旧的事件", address, dropped)
+	}
+	return nil
+}
+
+// Replay 按顺序补发地址的事件,send返回错误时停止,未补发的事件保留到下次
+// 超过outbox_max_age的事件,以及超过被动回复时间窗口的message事件会被丢弃
+func Replay(address string, send func(data []byte) error) (int, error) {
+	if db == nil {
+		return 0, ErrNotOpen
+	}
+	sent := 0
+	for {
+		key, record, err := first(address)
+		if err != nil || key == nil {
+			return sent, err
+		}
+
+		var sendErr error
+		if !expired(record, time.Now().Unix()) {
+			sendErr = send(record.Data)
+		}
+		if sendErr != nil {
+			return sent, sendErr
+		}
+
+		if err := remove(address, key); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+}
+
+// first 取出地址队列中最早的事件
+func first(address string) ([]byte, *Record, error) {
+	var key []byte
+	var record Record
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(address))
+		if b == nil {
+			return nil
+		}
+		k, v := b.Cursor().First()
+		if k == nil {
+			return nil
+		}
+		key = append([]byte(nil), k...)
+		return json.Unmarshal(v, &record)
+	})
+	if err != nil || key == nil {
+		return nil, nil, err
+	}
+	return key, &record, nil
+}
+
+// remove 删除已补发的事件,事件已被Prune删除时不重复减少计数
+func remove(address string, key []byte) error {
+	deleted := false
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(address))
+		if b == nil || b.Get(key) == nil {
+			return nil
+		}
+		deleted = true
+		return b.Delete(key)
+	})
+	if err == nil && deleted {
+		addPending(address, -1)
+	}
+	return err
+}
+
+// expired 判断事件是否已经没有补发的意义
+func expired(record *Record, now int64) bool {
+	age := now - record.StoredAt
+	if maxAge := config.GetOutboxMaxAge(); maxAge > 0 && age > int64(maxAge) {
+		return true
+	}
+	// message事件的msg_id超过被动回复时间窗口后无法再用于回复
+	if window := config.GetOutboxReplyWindow(); window > 0 && record.PostType == "message" && age > int64(window) {
+		return true
+	}
+	return false
+}
+
+// Prune 清理所有地址中过期的事件
+func Prune() {
+	if db == nil {
+		return
+	}
+	now := time.Now().Unix()
+	removed := make(map[string]int)
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			// 遍历时删除会跳过元素,先收集再删除
+			var keys [][]byte
+			b.ForEach(func(k, v []byte) error {
+				var record Record
+				if err := json.Unmarshal(v, &record); err != nil || expired(&record, now) {
+					keys = append(keys, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			removed[string(name)] += len(keys)
+			return nil
+		})
+	})
+	if err != nil {
+		mylog.Printf("清理过期的补发事件失败: %v", err)
+		return
+	}
+	for address, n := range removed {
+		if n == 0 {
+			continue
+		}
+		addPending(address, -n)
+		mylog.Printf("反向ws[%s]已清理%d条过期的补发事件", address, n)
+	}
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,213 @@
+// 正向ws连接的注册表,记录每个连接的编号、连接时间、地址、协议版本和收发计数,
+// 供Processor广播事件、get_online_clients以及webui断开连接等管理接口使用,
+// 同时记录反向ws各地址的连接状态
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+)
+
+// Default 正向ws与satori连接共用的注册表
+var Default = New()
+
+// Conn 注册表中的一个连接
+type Conn struct {
+	ID          uint64
+	Client      callapi.WebSocketServerClienter
+	ConnectedAt time.Time
+	RemoteAddr  string
+	Protocol    string // onebotv11 onebotv12 satori
+	Role        string // Universal API Event
+	received    uint64
+	sent        uint64
+	sendFailed  uint64
+	lastActive  int64
+}
+
+// Info 连接信息的快照,用于管理接口返回
+type Info struct {
+	ID          uint64 `json:"client_id"`
+	RemoteAddr  string `json:"remote_addr"`
+	Protocol    string `json:"protocol"`
+	Role        string `json:"role"`
+	ConnectedAt int64  `json:"connected_at"`
+	LastActive  int64  `json:"last_active"`
+	Received    uint64 `json:"received"`
+	Sent        uint64 `json:"sent"`
+	SendFailed  uint64 `json:"send_failed"`
+}
+
+// AddReceived 记录收到应用端的一帧
+func (c *Conn) AddReceived() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.received, 1)
+	atomic.StoreInt64(&c.lastActive, time.Now().Unix())
+}
+
+// AddSent 记录一次发送,err不为nil时计为发送失败
+func (c *Conn) AddSent(err error) {
+	if c == nil {
+		return
+	}
+	if err != nil {
+		atomic.AddUint64(&c.sendFailed, 1)
+		return
+	}
+	atomic.AddUint64(&c.sent, 1)
+	atomic.StoreInt64(&c.lastActive, time.Now().Unix())
+}
+
+// idle 合并条目当前没有实际连接
+func (c *Conn) idle() bool {
+	idler, ok := c.Client.(Idler)
+	return ok && idler.Idle()
+}
+
+// Info 返回连接当前的信息
+func (c *Conn) Info() Info {
+	return Info{
+		ID:          c.ID,
+		RemoteAddr:  c.RemoteAddr,
+		Protocol:    c.Protocol,
+		Role:        c.Role,
+		ConnectedAt: c.ConnectedAt.Unix(),
+		LastActive:  atomic.LoadInt64(&c.lastActive),
+		Received:    atomic.LoadUint64(&c.received),
+		Sent:        atomic.LoadUint64(&c.sent),
+		SendFailed:  atomic.LoadUint64(&c.sendFailed),
+	}
+}
+
+// Registry 并发安全的连接注册表,按连接的先后顺序保存
+type Registry struct {
+	mu     sync.RWMutex
+	nextID uint64
+	conns  []*Conn
+}
+
+func New() *Registry {
+	return &Registry{}
+}
+
+// EntryBinder 需要在发送时记录计数的连接实现该接口,Add在连接对广播可见之前调用BindEntry,
+// 避免广播的SendMessage读取Conn与注册后赋值之间的数据竞争
+type EntryBinder interface {
+	BindEntry(conn *Conn)
+}
+
+// Idler 合并多个连接的条目(如satori)实现该接口,没有实际连接时不计入Len和List,但仍接收广播
+type Idler interface {
+	Idle() bool
+}
+
+// Add 注册一个连接,返回的Conn用于记录收发计数
+func (r *Registry) Add(client callapi.WebSocketServerClienter, remoteAddr, protocol, role string) *Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	conn := &Conn{
+		ID:          r.nextID,
+		Client:      client,
+		ConnectedAt: time.Now(),
+		RemoteAddr:  remoteAddr,
+		Protocol:    protocol,
+		Role:        role,
+		lastActive:  time.Now().Unix(),
+	}
+	if binder, ok := client.(EntryBinder); ok {
+		binder.BindEntry(conn)
+	}
+	r.conns = append(r.conns, conn)
+	return conn
+}
+
+// Remove 移除连接,连接不存在时不做任何事
+func (r *Registry) Remove(conn *Conn) {
+	if conn == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range r.conns {
+		if c == conn {
+			// 复制一份新的切片,避免影响正在遍历旧快照的goroutine
+			conns := make([]*Conn, 0, len(r.conns)-1)
+			conns = append(conns, r.conns[:i]...)
+			r.conns = append(conns, r.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clients 返回当前所有连接的快照
+func (r *Registry) Clients() []callapi.WebSocketServerClienter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clients := make([]callapi.WebSocketServerClienter, 0, len(r.conns))
+	for _, c := range r.conns {
+		clients = append(clients, c.Client)
+	}
+	return clients
+}
+
+// Len 返回当前的连接数,没有实际连接的合并条目不计入
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, c := range r.conns {
+		if !c.idle() {
+			n++
+		}
+	}
+	return n
+}
+
+// List 返回所有连接的信息
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]Info, 0, len(r.conns))
+	for _, c := range r.conns {
+		if c.idle() {
+			continue
+		}
+		infos = append(infos, c.Info())
+	}
+	return infos
+}
+
+// Kick 断开指定编号的连接,连接的读取循环退出后会将其从注册表移除
+func (r *Registry) Kick(id uint64) error {
+	r.mu.RLock()
+	var target *Conn
+	for _, c := range r.conns {
+		if c.ID == id {
+			target = c
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if target == nil {
+		return fmt.Errorf("client %d not found", id)
+	}
+	return target.Client.Close()
+}
+
+// CloseAll 关闭所有连接,用于程序退出
+func (r *Registry) CloseAll() []error {
+	var errs []error
+	for _, client := range r.Clients() {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/hoshinonyaruko/gensokyo/outbox"
+)
+
+// 反向ws连接的状态
+const (
+	StateConnecting   = "connecting"   // 首次连接中
+	StateConnected    = "connected"    // 已连接
+	StateReconnecting = "reconnecting" // 断线重连中
+	StateGaveUp       = "gave_up"      // 超过重试次数,等待后台定时重新连接
+	StateClosed       = "closed"       // 已关闭
+)
+
+// ReverseState 一个反向ws地址的连接状态,用于get_status和webui展示
+type ReverseState struct {
+	Address        string `json:"address"`
+	State          string `json:"state"`
+	Attempts       int    `json:"attempts"`        // 本轮重连已尝试的次数
+	LastError      string `json:"last_error"`      // 最近一次连接失败的原因
+	NextRetry      int64  `json:"next_retry"`      // 下一次尝试连接的时间
+	ConnectedAt    int64  `json:"connected_at"`    // 最近一次连接成功的时间
+	DisconnectedAt int64  `json:"disconnected_at"` // 最近一次断开的时间
+	Pending        int    `json:"pending"`         // 等待补发的事件数
+}
+
+var (
+	reverseMu sync.RWMutex
+	reverse   = make(map[string]ReverseState)
+)
+
+// SetReverse 更新反向ws地址的连接状态
+func SetReverse(state ReverseState) {
+	reverseMu.Lock()
+	defer reverseMu.Unlock()
+	reverse[state.Address] = state
+}
+
+// ReverseStates 返回所有反向ws地址的连接状态,按地址排序
+func ReverseStates() []ReverseState {
+	reverseMu.RLock()
+	defer reverseMu.RUnlock()
+	states := make([]ReverseState, 0, len(reverse))
+	for _, state := range reverse {
+		state.Pending = outbox.Pending(state.Address)
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Address < states[j].Address })
+	return states
+}
@@ -0,0 +1,240 @@
+package router
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+)
+
+// 负载均衡池的选择策略
+const (
+	StrategyRoundRobin    = "round_robin"
+	StrategyLeastInflight = "least_inflight"
+	StrategyHashGroup     = "hash_group"
+)
+
+// 一致性哈希中每个成员的虚拟节点数
+const virtualNodes = 100
+
+// Target 一个接收事件的连接
+type Target struct {
+	Name   string
+	Client callapi.WebSocketServerClienter
+}
+
+var (
+	// 每个池的轮询计数
+	roundRobin sync.Map // pool name -> *uint64
+	// 每个连接正在发送中的事件数
+	inflight sync.Map // client -> *int64
+	// 每个池的一致性哈希环,成员变化时重建
+	rings sync.Map // pool name -> *hashRing
+)
+
+// ringNode 哈希环上的一个虚拟节点,index为成员在members中的位置
+type ringNode struct {
+	hash  uint32
+	index int
+}
+
+// hashRing 按成员列表生成的哈希环,signature为成员名称按顺序拼接
+type hashRing struct {
+	signature string
+	nodes     []ringNode
+}
+
+// PoolOf 返回应用端所属的负载均衡池,不属于任何池时返回空字符串
+func PoolOf(backend string) string {
+	for _, pool := range config.GetBackendPools() {
+		for _, member := range pool.Members {
+			if member == backend {
+				return pool.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Balance 将连接按负载均衡池分组,返回不属于任何池的连接,以及每个池按策略排好顺序的成员
+// 池中的成员按顺序尝试,前一个发送失败时转移到下一个
+func Balance(targets []Target, event map[string]interface{}) (singles []Target, pools [][]Target) {
+	configs := config.GetBackendPools()
+	if len(configs) == 0 {
+		return targets, nil
+	}
+
+	poolOf := make(map[string]int)
+	for i, pool := range configs {
+		for _, member := range pool.Members {
+			if _, ok := poolOf[member]; !ok {
+				poolOf[member] = i
+			}
+		}
+	}
+
+	grouped := make(map[int][]Target)
+	for _, target := range targets {
+		i, ok := poolOf[target.Name]
+		if !ok {
+			singles = append(singles, target)
+			continue
+		}
+		grouped[i] = append(grouped[i], target)
+	}
+
+	for i, pool := range configs {
+		members := grouped[i]
+		if len(members) == 0 {
+			continue
+		}
+		pools = append(pools, order(pool.Name, pool.Strategy, members, event))
+	}
+	return singles, pools
+}
+
+// order 按策略排列池成员,第一个为首选
+func order(name, strategy string, members []Target, event map[string]interface{}) []Target {
+	if len(members) == 1 {
+		return members
+	}
+	switch strategy {
+	case StrategyLeastInflight:
+		loads := make(map[callapi.WebSocketServerClienter]int64, len(members))
+		for _, member := range members {
+			loads[member.Client] = inflightOf(member.Client)
+		}
+		ordered := append([]Target(nil), members...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return loads[ordered[i].Client] < loads[ordered[j].Client]
+		})
+		return ordered
+	case StrategyHashGroup:
+		if key := conversationKey(event); key != "" {
+			return hashOrder(name, members, key)
+		}
+	}
+
+	// 默认轮询
+	v, _ := roundRobin.LoadOrStore(name, new(uint64))
+	start := int((atomic.AddUint64(v.(*uint64), 1) - 1) % uint64(len(members)))
+	ordered := make([]Target, 0, len(members))
+	ordered = append(ordered, members[start:]...)
+	ordered = append(ordered, members[:start]...)
+	return ordered
+}
+
+// conversationKey 同一个群(或私聊)的事件总是落到同一个成员上
+func conversationKey(event map[string]interface{}) string {
+	for _, key := range []string{"group_id", "channel_id", "user_id"} {
+		if id := onebotv12.IDToString(event[key]); id != "" && id != "0" {
+			return key + ":" + id
+		}
+	}
+	return ""
+}
+
+// hashOrder 使用一致性哈希环排列成员,成员变化时只影响少部分群的分配
+func hashOrder(name string, members []Target, key string) []Target {
+	ring := ringOf(name, members)
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+
+	ordered := make([]Target, 0, len(members))
+	used := make(map[int]bool, len(members))
+	for i := 0; i < len(ring) && len(ordered) < len(members); i++ {
+		n := ring[(start+i)%len(ring)]
+		if !used[n.index] {
+			used[n.index] = true
+			ordered = append(ordered, members[n.index])
+		}
+	}
+	return ordered
+}
+
+// ringOf 返回池的哈希环,成员与上次相同时复用缓存
+func ringOf(name string, members []Target) []ringNode {
+	// 同名的成员(如同一正向ws路径上的多个连接)按出现顺序区分
+	seen := make(map[string]int)
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = member.Name
+		if n := seen[member.Name]; n > 0 {
+			ids[i] = member.Name + "#" + strconv.Itoa(n)
+		}
+		seen[member.Name]++
+	}
+	signature := strings.Join(ids, "\n")
+	if v, ok := rings.Load(name); ok && v.(*hashRing).signature == signature {
+		return v.(*hashRing).nodes
+	}
+
+	nodes := make([]ringNode, 0, len(members)*virtualNodes)
+	for i, id := range ids {
+		for v := 0; v < virtualNodes; v++ {
+			nodes = append(nodes, ringNode{hash: crc32.ChecksumIEEE([]byte(id + "-" + strconv.Itoa(v))), index: i})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].hash < nodes[j].hash })
+	rings.Store(name, &hashRing{signature: signature, nodes: nodes})
+	return nodes
+}
+
+// inflightOf 连接正在发送的事件数,带发送队列的连接(反向ws)加上队列中尚未发出的消息数
+func inflightOf(client callapi.WebSocketServerClienter) int64 {
+	var n int64
+	if v, ok := inflight.Load(client); ok {
+		n = atomic.LoadInt64(v.(*int64))
+	}
+	if q, ok := client.(queueDepther); ok {
+		n += int64(q.QueueDepth())
+	}
+	return n
+}
+
+// queueDepther 可选接口,反向ws的SendMessage只写入发送队列就返回,以队列长度衡量负载
+type queueDepther interface {
+	QueueDepth() int
+}
+
+// connectionChecker 可选接口,反向ws的SendMessage只是写入发送队列,需要单独判断连接是否可用
+type connectionChecker interface {
+	Connected() bool
+}
+
+// SendToPool 依次向池中的成员发送事件,直到有一个成功,全部失败时返回错误
+func SendToPool(members []Target, message map[string]interface{}) error {
+	var lastErr error
+	for _, member := range members {
+		if c, ok := member.Client.(connectionChecker); ok && !c.Connected() {
+			lastErr = fmt.Errorf("%s is disconnected", member.Name)
+			mylog.Printf("负载均衡池成员[%s]未连接,尝试下一个成员", member.Name)
+			continue
+		}
+		v, _ := inflight.LoadOrStore(member.Client, new(int64))
+		counter := v.(*int64)
+		atomic.AddInt64(counter, 1)
+		err := member.Client.SendMessage(message)
+		atomic.AddInt64(counter, -1)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		mylog.Printf("向负载均衡池成员[%s]发送事件失败,尝试下一个成员: %v", member.Name, err)
+	}
+	return fmt.Errorf("all members of pool failed: %v", lastErr)
+}
+
+// Forget 连接断开时清理其计数
+func Forget(client callapi.WebSocketServerClienter) {
+	inflight.Delete(client)
+}
@@ -0,0 +1,113 @@
+// 事件路由,按前缀、群号、事件类型将事件分发到指定的onebot应用端
+package router
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+	"github.com/hoshinonyaruko/gensokyo/structs"
+)
+
+// 正向ws和satori作为应用端时的名称,反向ws和http上报使用其地址作为名称
+const (
+	BackendWsServer    = "ws_server"
+	BackendWsServerV12 = "ws_server_v12"
+	BackendSatori      = "satori"
+)
+
+// 匹配信息开头的at,判断前缀时忽略
+var leadingAt = regexp.MustCompile(`^(\s*\[CQ:at,[^\]]*\])*\s*`)
+
+// Decision 一个事件的路由结果,nil Decision 表示发送到所有应用端
+type Decision struct {
+	backends map[string]struct{}
+}
+
+// Route 按event_routes计算事件应发送到的应用端
+// 依次匹配路由规则,命中exclusive规则时只发送到该规则的应用端,
+// 否则发送到所有命中规则的应用端以及默认应用端,没有命中任何规则时发送到默认应用端
+func Route(event map[string]interface{}) *Decision {
+	routes := config.GetEventRoutes()
+	if len(routes) == 0 {
+		return nil
+	}
+
+	var matched []string
+	for _, route := range routes {
+		if !match(route, event) {
+			continue
+		}
+		if route.Exclusive {
+			return newDecision(route.Backends)
+		}
+		matched = append(matched, route.Backends...)
+	}
+
+	defaults := config.GetEventRouteDefault()
+	if len(defaults) == 0 {
+		// 没有设置默认应用端时,未命中规则的事件发送到所有应用端
+		return nil
+	}
+	return newDecision(append(matched, defaults...))
+}
+
+func newDecision(backends []string) *Decision {
+	d := &Decision{backends: make(map[string]struct{}, len(backends))}
+	for _, backend := range backends {
+		d.backends[backend] = struct{}{}
+	}
+	return d
+}
+
+// Allows 判断事件是否应发送到该应用端,路由规则中也可以填写应用端所属负载均衡池的名称
+func (d *Decision) Allows(backend string) bool {
+	if d == nil {
+		return true
+	}
+	if _, ok := d.backends[backend]; ok {
+		return true
+	}
+	if pool := PoolOf(backend); pool != "" {
+		_, ok := d.backends[pool]
+		return ok
+	}
+	return false
+}
+
+// match 判断事件是否满足路由规则,规则中未填写的条件视为满足
+func match(route structs.EventRouteConfig, event map[string]interface{}) bool {
+	if len(route.PostType) > 0 && !contains(route.PostType, onebotv12.IDToString(event["post_type"])) {
+		return false
+	}
+	if len(route.MessageType) > 0 && !contains(route.MessageType, onebotv12.IDToString(event["message_type"])) {
+		return false
+	}
+	if len(route.GroupID) > 0 && !contains(route.GroupID, onebotv12.IDToString(event["group_id"])) {
+		return false
+	}
+	if len(route.UserID) > 0 && !contains(route.UserID, onebotv12.IDToString(event["user_id"])) {
+		return false
+	}
+	if route.Prefix != "" {
+		rawMessage, ok := event["raw_message"].(string)
+		if !ok {
+			return false
+		}
+		rawMessage = leadingAt.ReplaceAllString(rawMessage, "")
+		if !strings.HasPrefix(rawMessage, route.Prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,397 @@
+package satori
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// apiError satori http api的错误,status为http状态码
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func badRequest(message string) *apiError {
+	return &apiError{status: http.StatusBadRequest, message: message}
+}
+
+type apiContext struct {
+	api   openapi.OpenAPI
+	apiV2 openapi.OpenAPI
+	body  map[string]interface{}
+}
+
+type apiMethod func(ctx *apiContext) (interface{}, error)
+
+// satori的资源方法
+var methods = map[string]apiMethod{
+	"login.get":         loginGet,
+	"message.create":    messageCreate,
+	"message.delete":    messageDelete,
+	"message.get":       messageGet,
+	"user.get":          userGet,
+	"friend.list":       friendList,
+	"guild.get":         guildGet,
+	"guild.list":        guildList,
+	"guild.member.get":  guildMemberGet,
+	"guild.member.list": guildMemberList,
+	"channel.get":       channelGet,
+	"channel.list":      channelList,
+}
+
+func apiHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkToken(c.GetHeader("Authorization")) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect token"})
+			return
+		}
+		name := c.Param("method")
+		method, ok := methods[name]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unsupported method: " + name})
+			return
+		}
+
+		body := make(map[string]interface{})
+		if c.Request.ContentLength != 0 {
+			if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+				return
+			}
+		}
+
+		result, err := method(&apiContext{api: api, apiV2: apiV2, body: body})
+		if err != nil {
+			status := http.StatusInternalServerError
+			if e, ok := err.(*apiError); ok {
+				status = e.status
+			}
+			mylog.Printf("satori api %s 调用失败: %v", name, err)
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// param 获取请求体中的字符串参数
+func (ctx *apiContext) param(key string) string {
+	return onebotv12.IDToString(ctx.body[key])
+}
+
+// call 调用已注册的v11 handler,返回响应中的data
+func (ctx *apiContext) call(action string, params map[string]interface{}) (interface{}, error) {
+	raw, err := json.Marshal(map[string]interface{}{
+		"action": action,
+		"params": params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var message callapi.ActionMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	client := &callapi.CaptureClient{}
+	callapi.CallAPIFromDict(client, ctx.api, ctx.apiV2, message)
+	response := client.Response()
+	if response == nil {
+		return nil, &apiError{status: http.StatusInternalServerError, message: action + " returned no response"}
+	}
+	if status, _ := response["status"].(string); status == "failed" {
+		errMessage, _ := response["message"].(string)
+		switch onebotv12.IDToString(response["retcode"]) {
+		case strconv.Itoa(callapi.RetCodeUnsupported), strconv.Itoa(callapi.RetCodeNotFound):
+			return nil, &apiError{status: http.StatusNotFound, message: errMessage}
+		}
+		return nil, &apiError{status: http.StatusInternalServerError, message: errMessage}
+	}
+	return response["data"], nil
+}
+
+// list 将结果包装为satori的分页列表,gensokyo一次返回全部数据
+func list(data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"data": data,
+		"next": nil,
+	}
+}
+
+func loginGet(ctx *apiContext) (interface{}, error) {
+	return currentLogin(), nil
+}
+
+func messageCreate(ctx *apiContext) (interface{}, error) {
+	channelID := ctx.param("channel_id")
+	content, _ := ctx.body["content"].(string)
+	if channelID == "" || content == "" {
+		return nil, badRequest("channel_id and content are required")
+	}
+
+	segments := ParseElements(content)
+	var action string
+	params := map[string]interface{}{"message": segments}
+	if strings.HasPrefix(channelID, privateChannelPrefix) {
+		action = "send_private_msg"
+		params["user_id"] = strings.TrimPrefix(channelID, privateChannelPrefix)
+	} else if guildID, ok := guildChannels.Load(channelID); ok {
+		action = "send_guild_channel_msg"
+		params["guild_id"] = guildID
+		params["channel_id"] = channelID
+	} else {
+		// 群或被虚拟成群的子频道,由send_msg判断真实类型
+		action = "send_msg"
+		params["group_id"] = channelID
+	}
+
+	data, err := ctx.call(action, params)
+	if err != nil {
+		return nil, err
+	}
+	var messageID string
+	if m, ok := data.(map[string]interface{}); ok {
+		messageID = onebotv12.IDToString(m["message_id"])
+	}
+	return []*Message{{ID: messageID, Content: content}}, nil
+}
+
+func messageDelete(ctx *apiContext) (interface{}, error) {
+	channelID := ctx.param("channel_id")
+	messageID := ctx.param("message_id")
+	if channelID == "" || messageID == "" {
+		return nil, badRequest("channel_id and message_id are required")
+	}
+	params := map[string]interface{}{"message_id": messageID}
+	if strings.HasPrefix(channelID, privateChannelPrefix) {
+		params["user_id"] = strings.TrimPrefix(channelID, privateChannelPrefix)
+	} else if _, ok := guildChannels.Load(channelID); ok {
+		params["channel_id"] = channelID
+	} else {
+		params["group_id"] = channelID
+	}
+	if _, err := ctx.call("delete_msg", params); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
+
+func messageGet(ctx *apiContext) (interface{}, error) {
+	messageID := ctx.param("message_id")
+	if messageID == "" {
+		return nil, badRequest("message_id is required")
+	}
+	data, err := ctx.call("get_msg", map[string]interface{}{"message_id": messageID})
+	if err != nil {
+		return nil, err
+	}
+	m, _ := data.(map[string]interface{})
+	if m == nil {
+		return nil, &apiError{status: http.StatusNotFound, message: "message not found"}
+	}
+	message := &Message{
+		ID:      messageID,
+		Content: RenderElements(m["message"]),
+	}
+	if t, ok := m["time"].(float64); ok {
+		message.CreatedAt = int64(t) * 1000
+	}
+	if sender, ok := m["sender"].(map[string]interface{}); ok {
+		if userID := onebotv12.IDToString(sender["user_id"]); userID != "" {
+			message.User = userOf(userID, sender, nil)
+		}
+	}
+	if groupID := onebotv12.IDToString(m["group_id"]); groupID != "" {
+		message.Channel = &Channel{ID: groupID, Type: ChannelTypeText}
+		message.Guild = &Guild{ID: groupID}
+	} else if message.User != nil {
+		message.Channel = &Channel{ID: privateChannelPrefix + message.User.ID, Type: ChannelTypeDirect}
+	}
+	return message, nil
+}
+
+func userGet(ctx *apiContext) (interface{}, error) {
+	userID := ctx.param("user_id")
+	if userID == "" {
+		return nil, badRequest("user_id is required")
+	}
+	if cached, ok := users.Load(userID); ok {
+		return cached, nil
+	}
+	return &User{ID: userID}, nil
+}
+
+func friendList(ctx *apiContext) (interface{}, error) {
+	data, err := ctx.call("get_friend_list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	friends := make([]*User, 0)
+	for _, item := range asList(data) {
+		friends = append(friends, &User{
+			ID:   onebotv12.IDToString(item["user_id"]),
+			Name: stringOf(item["nickname"]),
+		})
+	}
+	return list(friends), nil
+}
+
+func guildGet(ctx *apiContext) (interface{}, error) {
+	guildID := ctx.param("guild_id")
+	if guildID == "" {
+		return nil, badRequest("guild_id is required")
+	}
+	if _, ok := qqGuilds.Load(guildID); ok {
+		return &Guild{ID: guildID}, nil
+	}
+	data, err := ctx.call("get_group_info", map[string]interface{}{"group_id": guildID})
+	if err != nil {
+		return nil, err
+	}
+	guild := &Guild{ID: guildID}
+	if m, ok := data.(map[string]interface{}); ok {
+		guild.Name = stringOf(m["group_name"])
+	}
+	return guild, nil
+}
+
+func guildList(ctx *apiContext) (interface{}, error) {
+	guilds := make([]*Guild, 0)
+	groups, err := ctx.call("get_group_list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range asList(groups) {
+		guilds = append(guilds, &Guild{
+			ID:   onebotv12.IDToString(item["group_id"]),
+			Name: stringOf(item["group_name"]),
+		})
+	}
+	// qq频道列表获取失败时仍返回群列表
+	if qqguilds, err := ctx.call("get_guild_list", map[string]interface{}{}); err == nil {
+		for _, item := range asList(qqguilds) {
+			guildID := onebotv12.IDToString(item["guild_id"])
+			qqGuilds.Store(guildID, struct{}{})
+			guilds = append(guilds, &Guild{
+				ID:   guildID,
+				Name: stringOf(item["guild_name"]),
+			})
+		}
+	}
+	return list(guilds), nil
+}
+
+func guildMemberGet(ctx *apiContext) (interface{}, error) {
+	guildID := ctx.param("guild_id")
+	userID := ctx.param("user_id")
+	if guildID == "" || userID == "" {
+		return nil, badRequest("guild_id and user_id are required")
+	}
+	data, err := ctx.call("get_group_member_info", map[string]interface{}{
+		"group_id": guildID,
+		"user_id":  userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m, _ := data.(map[string]interface{})
+	return memberOf(m), nil
+}
+
+func guildMemberList(ctx *apiContext) (interface{}, error) {
+	guildID := ctx.param("guild_id")
+	if guildID == "" {
+		return nil, badRequest("guild_id is required")
+	}
+	data, err := ctx.call("get_group_member_list", map[string]interface{}{"group_id": guildID})
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*GuildMember, 0)
+	for _, item := range asList(data) {
+		members = append(members, memberOf(item))
+	}
+	return list(members), nil
+}
+
+func channelGet(ctx *apiContext) (interface{}, error) {
+	channelID := ctx.param("channel_id")
+	if channelID == "" {
+		return nil, badRequest("channel_id is required")
+	}
+	if strings.HasPrefix(channelID, privateChannelPrefix) {
+		return &Channel{ID: channelID, Type: ChannelTypeDirect}, nil
+	}
+	return &Channel{ID: channelID, Type: ChannelTypeText}, nil
+}
+
+func channelList(ctx *apiContext) (interface{}, error) {
+	guildID := ctx.param("guild_id")
+	if guildID == "" {
+		return nil, badRequest("guild_id is required")
+	}
+	if _, ok := qqGuilds.Load(guildID); !ok {
+		// 群没有子频道,频道即为群本身
+		return list([]*Channel{{ID: guildID, Type: ChannelTypeText}}), nil
+	}
+	data, err := ctx.call("get_guild_channel_list", map[string]interface{}{"guild_id": guildID})
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]*Channel, 0)
+	for _, item := range asList(data) {
+		channelID := onebotv12.IDToString(item["channel_id"])
+		guildChannels.Store(channelID, guildID)
+		channels = append(channels, &Channel{
+			ID:   channelID,
+			Type: ChannelTypeText,
+			Name: stringOf(item["channel_name"]),
+		})
+	}
+	return list(channels), nil
+}
+
+func memberOf(m map[string]interface{}) *GuildMember {
+	if m == nil {
+		return &GuildMember{}
+	}
+	member := &GuildMember{
+		User: &User{
+			ID:   onebotv12.IDToString(m["user_id"]),
+			Name: stringOf(m["nickname"]),
+		},
+		Nick: stringOf(m["card"]),
+	}
+	if joinTime, ok := m["join_time"].(float64); ok && joinTime > 0 {
+		member.JoinedAt = int64(joinTime) * 1000
+	}
+	return member
+}
+
+func asList(data interface{}) []map[string]interface{} {
+	items, _ := data.([]interface{})
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func stringOf(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
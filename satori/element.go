@@ -0,0 +1,143 @@
+package satori
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+)
+
+var elementEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+// escape 转义satori消息元素中的文本和属性
+func escape(s string) string {
+	return elementEscaper.Replace(s)
+}
+
+// RenderElements 将v11的信息(CQ码字符串或segment数组)转换为satori的消息元素字符串
+func RenderElements(message interface{}) string {
+	var builder strings.Builder
+	for _, seg := range onebotv12.ConvertMessageToV12(message) {
+		segType, _ := seg["type"].(string)
+		data, _ := seg["data"].(map[string]interface{})
+		switch segType {
+		case "text":
+			text, _ := data["text"].(string)
+			builder.WriteString(escape(text))
+		case "mention":
+			builder.WriteString(`<at id="` + escape(onebotv12.IDToString(data["user_id"])) + `"/>`)
+		case "mention_all":
+			builder.WriteString(`<at type="all"/>`)
+		case "image":
+			builder.WriteString(`<img src="` + escape(mediaSrc(data)) + `"/>`)
+		case "voice":
+			builder.WriteString(`<audio src="` + escape(mediaSrc(data)) + `"/>`)
+		case "video":
+			builder.WriteString(`<video src="` + escape(mediaSrc(data)) + `"/>`)
+		case "reply":
+			builder.WriteString(`<quote id="` + escape(onebotv12.IDToString(data["message_id"])) + `"/>`)
+		default:
+			// 其他类型以qq:前缀的自定义元素保留
+			name := strings.TrimPrefix(segType, onebotv12.Platform+".")
+			builder.WriteString("<" + onebotv12.Platform + ":" + name)
+			for key, value := range data {
+				builder.WriteString(" " + key + `="` + escape(onebotv12.IDToString(value)) + `"`)
+			}
+			builder.WriteString("/>")
+		}
+	}
+	return builder.String()
+}
+
+func mediaSrc(data map[string]interface{}) string {
+	if url, ok := data[onebotv12.Platform+".url"].(string); ok && url != "" {
+		return url
+	}
+	return onebotv12.IDToString(data["file_id"])
+}
+
+// ParseElements 将satori的消息元素字符串转换为v11的segment数组,交给parseMessageContent处理
+func ParseElements(content string) []map[string]interface{} {
+	segments := make([]map[string]interface{}, 0)
+	appendText := func(text string) {
+		if text == "" {
+			return
+		}
+		// 合并相邻的文本段
+		if n := len(segments); n > 0 && segments[n-1]["type"] == "text" {
+			data := segments[n-1]["data"].(map[string]interface{})
+			data["text"] = data["text"].(string) + text
+			return
+		}
+		segments = append(segments, segmentV11("text", map[string]interface{}{"text": text}))
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader("<root>" + content + "</root>"))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 无法解析的内容按纯文本发送
+			return []map[string]interface{}{segmentV11("text", map[string]interface{}{"text": content})}
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			appendText(string(t))
+		case xml.StartElement:
+			attrs := make(map[string]string, len(t.Attr))
+			for _, attr := range t.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			switch strings.ToLower(t.Name.Local) {
+			case "at":
+				if attrs["type"] == "all" || attrs["type"] == "here" {
+					segments = append(segments, segmentV11("at", map[string]interface{}{"qq": "all"}))
+				} else if attrs["id"] != "" {
+					segments = append(segments, segmentV11("at", map[string]interface{}{"qq": attrs["id"]}))
+				}
+			case "img", "image":
+				segments = append(segments, segmentV11("image", map[string]interface{}{"file": srcOf(attrs)}))
+			case "audio", "record":
+				segments = append(segments, segmentV11("record", map[string]interface{}{"file": srcOf(attrs)}))
+			case "video":
+				segments = append(segments, segmentV11("video", map[string]interface{}{"file": srcOf(attrs)}))
+			case "quote":
+				if attrs["id"] != "" {
+					segments = append(segments, segmentV11("reply", map[string]interface{}{"id": attrs["id"]}))
+				}
+			case "br":
+				appendText("\n")
+			case "a":
+				if attrs["href"] != "" {
+					appendText(attrs["href"] + " ")
+				}
+			}
+		case xml.EndElement:
+			if strings.ToLower(t.Name.Local) == "p" {
+				appendText("\n")
+			}
+		}
+	}
+	return segments
+}
+
+func srcOf(attrs map[string]string) string {
+	if attrs["src"] != "" {
+		return attrs["src"]
+	}
+	return attrs["url"]
+}
+
+func segmentV11(segType string, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": segType,
+		"data": data,
+	}
+}
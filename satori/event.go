@@ -0,0 +1,230 @@
+package satori
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+)
+
+// satori的频道类型
+const (
+	ChannelTypeText   = 0
+	ChannelTypeDirect = 1
+)
+
+// 私聊频道id的前缀,与常见的satori实现保持一致
+const privateChannelPrefix = "private:"
+
+// 从事件中记录的频道信息,用于判断发信时channel_id对应的信息类型
+var (
+	guildChannels sync.Map // channel_id -> guild_id 仅包含qq频道的子频道
+	qqGuilds      sync.Map // guild_id -> struct{} qq频道
+	users         sync.Map // user_id -> User
+)
+
+type User struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Nick   string `json:"nick,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+	IsBot  bool   `json:"is_bot,omitempty"`
+}
+
+type Channel struct {
+	ID       string `json:"id"`
+	Type     int    `json:"type"`
+	Name     string `json:"name,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+type Guild struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type GuildMember struct {
+	User     *User  `json:"user,omitempty"`
+	Nick     string `json:"nick,omitempty"`
+	Avatar   string `json:"avatar,omitempty"`
+	JoinedAt int64  `json:"joined_at,omitempty"`
+}
+
+type Message struct {
+	ID        string       `json:"id"`
+	Content   string       `json:"content"`
+	Channel   *Channel     `json:"channel,omitempty"`
+	Guild     *Guild       `json:"guild,omitempty"`
+	Member    *GuildMember `json:"member,omitempty"`
+	User      *User        `json:"user,omitempty"`
+	CreatedAt int64        `json:"created_at,omitempty"`
+}
+
+type Login struct {
+	User     *User  `json:"user,omitempty"`
+	SelfID   string `json:"self_id"`
+	Platform string `json:"platform"`
+	Status   int    `json:"status"`
+}
+
+type Event struct {
+	ID        int64        `json:"id"`
+	Type      string       `json:"type"`
+	Platform  string       `json:"platform"`
+	SelfID    string       `json:"self_id"`
+	Timestamp int64        `json:"timestamp"`
+	Channel   *Channel     `json:"channel,omitempty"`
+	Guild     *Guild       `json:"guild,omitempty"`
+	Login     *Login       `json:"login,omitempty"`
+	Member    *GuildMember `json:"member,omitempty"`
+	Message   *Message     `json:"message,omitempty"`
+	Operator  *User        `json:"operator,omitempty"`
+	User      *User        `json:"user,omitempty"`
+	// 无法映射的事件以internal事件上报原始v11事件
+	InternalType string                 `json:"_type,omitempty"`
+	InternalData map[string]interface{} `json:"_data,omitempty"`
+}
+
+// v11 notice_type 到 satori 事件类型的映射
+var noticeTypeMapping = map[string]string{
+	"group_increase": "guild-member-added",
+	"group_decrease": "guild-member-removed",
+	"group_recall":   "message-deleted",
+	"friend_recall":  "message-deleted",
+}
+
+// ConvertEvent 将v11事件转换为satori事件,不需要上报的事件(心跳等)返回nil
+func ConvertEvent(event map[string]interface{}) *Event {
+	postType, _ := event["post_type"].(string)
+	if postType == "" || postType == "meta_event" {
+		// satori有自己的心跳和连接事件
+		return nil
+	}
+
+	out := &Event{
+		Platform:  onebotv12.Platform,
+		SelfID:    onebotv12.IDToString(event["self_id"]),
+		Timestamp: eventTimestamp(event["time"]),
+	}
+
+	userID := onebotv12.IDToString(event["user_id"])
+	if userID != "" && userID != "0" {
+		out.User = userOf(userID, event["sender"], event["avatar"])
+	}
+	out.Channel, out.Guild = channelOf(event)
+
+	switch postType {
+	case "message":
+		out.Type = "message-created"
+		rawMessage, _ := event["raw_message"].(string)
+		content := RenderElements(event["message"])
+		if content == "" {
+			content = escape(rawMessage)
+		}
+		out.Message = &Message{
+			ID:        onebotv12.IDToString(event["message_id"]),
+			Content:   content,
+			CreatedAt: out.Timestamp,
+		}
+		if sender, ok := event["sender"].(map[string]interface{}); ok && out.Guild != nil {
+			card, _ := sender["card"].(string)
+			out.Member = &GuildMember{Nick: card}
+		}
+	case "notice":
+		noticeType, _ := event["notice_type"].(string)
+		eventType, ok := noticeTypeMapping[noticeType]
+		if !ok {
+			return internalEvent(out, event)
+		}
+		out.Type = eventType
+		if operatorID := onebotv12.IDToString(event["operator_id"]); operatorID != "" && operatorID != "0" {
+			out.Operator = &User{ID: operatorID}
+		}
+		if eventType == "message-deleted" {
+			out.Message = &Message{ID: onebotv12.IDToString(event["message_id"])}
+		}
+		if eventType == "guild-member-added" || eventType == "guild-member-removed" {
+			out.Member = &GuildMember{User: out.User}
+		}
+	default:
+		return internalEvent(out, event)
+	}
+	return out
+}
+
+func internalEvent(out *Event, event map[string]interface{}) *Event {
+	postType, _ := event["post_type"].(string)
+	subType := ""
+	for _, key := range []string{"notice_type", "request_type", "message_type"} {
+		if v, ok := event[key].(string); ok {
+			subType = v
+			break
+		}
+	}
+	out.Type = "internal"
+	out.InternalType = postType
+	if subType != "" {
+		out.InternalType = postType + "." + subType
+	}
+	out.InternalData = event
+	return out
+}
+
+// channelOf 根据v11事件构造satori的频道和群组,并记录qq频道的子频道
+func channelOf(event map[string]interface{}) (*Channel, *Guild) {
+	messageType, _ := event["message_type"].(string)
+	groupID := onebotv12.IDToString(event["group_id"])
+	guildID := onebotv12.IDToString(event["guild_id"])
+	channelID := onebotv12.IDToString(event["channel_id"])
+	userID := onebotv12.IDToString(event["user_id"])
+
+	switch {
+	case messageType == "guild" && channelID != "":
+		guildChannels.Store(channelID, guildID)
+		if guildID != "" {
+			qqGuilds.Store(guildID, struct{}{})
+		}
+		return &Channel{ID: channelID, Type: ChannelTypeText}, &Guild{ID: guildID}
+	case groupID != "" && groupID != "0":
+		// 群没有子频道,频道id与群号相同
+		return &Channel{ID: groupID, Type: ChannelTypeText}, &Guild{ID: groupID}
+	case userID != "" && userID != "0":
+		return &Channel{ID: privateChannelPrefix + userID, Type: ChannelTypeDirect}, nil
+	}
+	return nil, nil
+}
+
+// userOf 构造并缓存用户信息,供user.get使用
+func userOf(userID string, sender interface{}, avatar interface{}) *User {
+	user := &User{ID: userID}
+	if s, ok := sender.(map[string]interface{}); ok {
+		user.Name, _ = s["nickname"].(string)
+		user.Nick, _ = s["card"].(string)
+	}
+	user.Avatar, _ = avatar.(string)
+	if cached, ok := users.Load(userID); ok {
+		old := cached.(*User)
+		if user.Name == "" {
+			user.Name = old.Name
+		}
+		if user.Avatar == "" {
+			user.Avatar = old.Avatar
+		}
+	}
+	users.Store(userID, user)
+	return user
+}
+
+func eventTimestamp(v interface{}) int64 {
+	switch t := v.(type) {
+	case float64:
+		return int64(t) * 1000
+	case int64:
+		return t * 1000
+	case int:
+		return int64(t) * 1000
+	default:
+		return time.Now().UnixMilli()
+	}
+}
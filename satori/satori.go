@@ -0,0 +1,319 @@
+// satori协议服务端,在gin上提供satori的http api和websocket事件推送,复用现有的handler
+package satori
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/hoshinonyaruko/gensokyo/Processor"
+	"github.com/hoshinonyaruko/gensokyo/callapi"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+	"github.com/hoshinonyaruko/gensokyo/registry"
+	"github.com/hoshinonyaruko/gensokyo/router"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// satori信令的op
+const (
+	OpEvent    = 0
+	OpPing     = 1
+	OpPong     = 2
+	OpIdentify = 3
+	OpReady    = 4
+)
+
+// 登录状态 ONLINE
+const loginStatusOnline = 1
+
+// 保留最近的事件,供客户端IDENTIFY时携带sequence补发
+const eventBufferSize = 1000
+
+// 客户端需要在连接后10秒内发送IDENTIFY
+const identifyTimeout = 10 * time.Second
+
+type Signal struct {
+	Op   int             `json:"op"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+type identifyBody struct {
+	Token    string `json:"token"`
+	Sequence int64  `json:"sequence"`
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+var (
+	eventMu     sync.Mutex
+	eventSeq    int64
+	eventBuffer []*Event
+)
+
+// Client 一个satori的websocket连接
+type Client struct {
+	conn       *websocket.Conn
+	mu         sync.Mutex // 互斥锁保护 conn
+	identified bool
+}
+
+// Hub 所有satori连接的集合,启用satori时始终注册在Processor的WsServerClients中,
+// 保证同一个v11事件只转换一次,所有连接共享事件序号,没有连接时事件同样进入缓冲区供重连后补发
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+	p       *Processor.Processors
+	// 所有satori连接在注册表中合并为一个条目
+	entry *registry.Conn
+}
+
+// 确保Hub实现了callapi.WebSocketServerClienter接口
+var _ callapi.WebSocketServerClienter = &Hub{}
+
+// errNoClient 没有satori连接,事件只进入缓冲区
+var errNoClient = errors.New("no satori client connected")
+
+// Register 在gin上注册satori的路由,base为/satori_path/v1
+func Register(r *gin.Engine, api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processors) {
+	base := "/" + strings.Trim(config.GetSatoriPath(), "/") + "/v1"
+	if base == "//v1" {
+		base = "/v1"
+	}
+	hub := &Hub{
+		clients: make(map[*Client]struct{}),
+		p:       p,
+	}
+	p.WsServerClients.Add(hub, "", "satori", "Event")
+	group := r.Group(base)
+	group.GET("/events", eventsHandler(hub))
+	group.POST("/:method", apiHandler(api, apiV2))
+	mylog.Printf("satori服务端启动成功,http api与websocket地址为0.0.0.0:%s%s", config.GetPortValue(), base)
+}
+
+// checkToken 校验satori的Bearer token
+func checkToken(authorization string) bool {
+	validToken := config.GetSatoriToken()
+	if validToken == "" {
+		return true
+	}
+	provided := strings.TrimPrefix(authorization, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(validToken)) == 1
+}
+
+// selfID 获取机器人的self_id
+func selfID() string {
+	if config.GetUseUin() {
+		return config.GetUinStr()
+	}
+	return config.GetAppIDStr()
+}
+
+// currentLogin 当前机器人的登录信息
+func currentLogin() *Login {
+	id := selfID()
+	return &Login{
+		User: &User{
+			ID:    id,
+			Name:  config.GetCustomBotName(),
+			IsBot: true,
+		},
+		SelfID:   id,
+		Platform: onebotv12.Platform,
+		Status:   loginStatusOnline,
+	}
+}
+
+func eventsHandler(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			mylog.Printf("Failed to set satori websocket upgrade: %+v", err)
+			return
+		}
+		mylog.Printf("satori client connected. IP: %s", c.ClientIP())
+
+		client := &Client{conn: conn}
+		defer func() {
+			hub.remove(client)
+			conn.Close()
+		}()
+
+		conn.SetReadDeadline(time.Now().Add(identifyTimeout))
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				mylog.Printf("satori client disconnected: %v", err)
+				return
+			}
+			var signal Signal
+			if err := json.Unmarshal(msg, &signal); err != nil {
+				mylog.Printf("Error unmarshalling satori signal: %v, Original message: %s", err, string(msg))
+				continue
+			}
+			switch signal.Op {
+			case OpIdentify:
+				var body identifyBody
+				if len(signal.Body) > 0 {
+					json.Unmarshal(signal.Body, &body)
+				}
+				if !checkToken("Bearer " + body.Token) {
+					mylog.Printf("satori client identify failed due to incorrect token. IP: %s", c.ClientIP())
+					return
+				}
+				conn.SetReadDeadline(time.Time{})
+				client.send(OpReady, map[string]interface{}{
+					"logins": []*Login{currentLogin()},
+				})
+				if !client.identified {
+					client.identified = true
+					// 补发客户端断线期间的事件
+					for _, event := range eventsAfter(body.Sequence) {
+						client.send(OpEvent, event)
+					}
+					hub.add(client)
+				}
+			case OpPing:
+				client.send(OpPong, map[string]interface{}{})
+			}
+		}
+	}
+}
+
+// add 添加连接
+func (h *Hub) add(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = struct{}{}
+}
+
+// remove 移除连接
+func (h *Hub) remove(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, client)
+}
+
+// BindEntry 由注册表在hub加入之前调用,记录hub在注册表中的条目
+func (h *Hub) BindEntry(entry *registry.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entry = entry
+}
+
+// Idle 没有satori连接时不计入注册表的连接数和连接列表
+func (h *Hub) Idle() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) == 0
+}
+
+// SendMessage 接收Processor广播的v11事件,转换为satori事件后放入缓冲区并推送给所有连接
+// 没有连接时返回errNoClient,与没有连接的正向ws一样视为发送失败
+func (h *Hub) SendMessage(message map[string]interface{}) error {
+	if !onebotv12.IsEvent(message) {
+		return nil
+	}
+	event := ConvertEvent(message)
+	if event == nil {
+		return nil
+	}
+	bufferEvent(event)
+
+	h.mu.Lock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	entry := h.entry
+	h.mu.Unlock()
+	if len(clients) == 0 {
+		return errNoClient
+	}
+
+	var lastErr error
+	failed := 0
+	for _, client := range clients {
+		err := client.send(OpEvent, event)
+		entry.AddSent(err)
+		if err != nil {
+			lastErr = err
+			failed++
+		}
+	}
+	// 仅当所有连接都发送失败时返回错误
+	if failed > 0 && failed == len(clients) {
+		return lastErr
+	}
+	return nil
+}
+
+// BackendName satori作为应用端的名称
+func (h *Hub) BackendName() string {
+	return router.BackendSatori
+}
+
+// Close 关闭所有satori连接
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		client.conn.Close()
+	}
+	return nil
+}
+
+// eventsAfter 返回缓冲区中序号大于sequence的事件,sequence为0时不补发
+func eventsAfter(sequence int64) []*Event {
+	if sequence <= 0 {
+		return nil
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	var events []*Event
+	for _, event := range eventBuffer {
+		if event.ID > sequence {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// bufferEvent 为事件分配序号并放入缓冲区
+func bufferEvent(event *Event) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventSeq++
+	event.ID = eventSeq
+	eventBuffer = append(eventBuffer, event)
+	if len(eventBuffer) > eventBufferSize {
+		eventBuffer = eventBuffer[len(eventBuffer)-eventBufferSize:]
+	}
+}
+
+// send 发送satori信令
+func (c *Client) send(op int, body interface{}) error {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		mylog.Println("Error marshalling satori signal:", err)
+		return err
+	}
+	msgBytes, err := json.Marshal(Signal{Op: op, Body: bodyBytes})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, msgBytes)
+}
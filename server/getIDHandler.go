@@ -256,6 +256,18 @@ func GetIDHandler(c *gin.Context) {
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"id": id})
+
+	case 18:
+		// 只读取已分配的行号,不存在时不分配
+		row, err := idmap.RetrieveRowOfIDv2(idOrRow)
+		if err == idmap.ErrKeyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ID not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"row": row})
 	}
 
 }
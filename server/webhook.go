@@ -10,13 +10,9 @@ import (
 	"log"
 	"net/http"
 	"strings"
-	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/hoshinonyaruko/gensokyo/mylog"
-	"github.com/tencent-connect/botgo/dto"
-	"github.com/tencent-connect/botgo/event"
-	"github.com/tencent-connect/botgo/websocket/client"
 )
 
 // Payload 定义请求载荷结构
@@ -33,23 +29,10 @@ type ValidationRequest struct {
 
 // WebhookPayload 定义Webhook消息结构
 type WebhookPayload struct {
-	PlainToken string `json:"plain_token"`
-	EventTs    string `json:"event_ts"`
-	RawMessage []byte // 保存原始消息内容
-}
-
-// WebhookHandler 负责处理 Webhook 的接收和消息处理
-type WebhookHandler struct {
-	messageQueue chan *WebhookPayload
-	closeChan    chan error
-}
-
-// NewWebhookHandler 创建新的 WebhookHandler 实例
-func NewWebhookHandler(queueSize int) *WebhookHandler {
-	return &WebhookHandler{
-		messageQueue: make(chan *WebhookPayload, queueSize),
-		closeChan:    make(chan error),
-	}
+	PlainToken string    `json:"plain_token"`
+	EventTs    string    `json:"event_ts"`
+	RawMessage []byte    // 保存原始消息内容
+	enqueuedAt time.Time // 进入队列的时间
 }
 
 // 在启动时生成私钥
@@ -116,22 +99,16 @@ func CreateHandleValidationSafe(wh *WebhookHandler) gin.HandlerFunc {
 			})
 
 		default:
-			// 异步推送消息到队列
-			go func(httpBody []byte, payload Payload) {
-				webhookPayload := &WebhookPayload{
-					PlainToken: payload.D.PlainToken,
-					EventTs:    payload.D.EventTs,
-					RawMessage: httpBody,
-				}
-
-				// 尝试写入队列
-				select {
-				case wh.messageQueue <- webhookPayload:
-					mylog.Println("Message enqueued successfully")
-				default:
-					log.Println("Message queue is full, dropping message")
-				}
-			}(httpBody, payload)
+			webhookPayload := &WebhookPayload{
+				PlainToken: payload.D.PlainToken,
+				EventTs:    payload.D.EventTs,
+				RawMessage: httpBody,
+			}
+			// 队列已满且webhook_overflow为reject,或正在退出时返回非200,由官方平台稍后重发
+			if err := wh.Enqueue(webhookPayload); err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
 
 			// 返回 HTTP Callback ACK 响应
 			c.JSON(http.StatusOK, gin.H{
@@ -183,32 +160,3 @@ func validateSignature(req *http.Request, publicKey ed25519.PublicKey) error {
 
 	return nil
 }
-
-// listenAndProcessMessages 启动协程处理队列中的消息
-func (wh *WebhookHandler) ListenAndProcessMessages() {
-	for payload := range wh.messageQueue {
-		go func(p *WebhookPayload) {
-			mylog.Printf("Processing Webhook event with token: %s", p.PlainToken)
-			// 业务逻辑处理的地方
-			payload := &dto.WSPayload{}
-			if err := json.Unmarshal(p.RawMessage, payload); err != nil {
-				log.Printf("%s json failed, %v", p.EventTs, err)
-				return
-			}
-			// 更新 global_s 的值
-			atomic.StoreInt64(&client.Global_s, payload.S)
-
-			payload.RawMessage = p.RawMessage
-			mylog.Printf("%s receive %s message, %s", p.EventTs, dto.OPMeans(payload.OPCode), string(p.RawMessage))
-
-			// 性能不够 报错也没用 就扬了
-			go event.ParseAndHandle(payload)
-		}(payload)
-	}
-	log.Println("Message queue is closed")
-}
-
-// Close 关闭消息队列
-func (wh *WebhookHandler) Close() {
-	close(wh.messageQueue)
-}
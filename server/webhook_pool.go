@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/botstats"
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/metrics"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/event"
+	"github.com/tencent-connect/botgo/websocket/client"
+	"github.com/tidwall/gjson"
+)
+
+// 未配置时的worker数量与队列长度
+const (
+	defaultWebhookWorkers   = 16
+	defaultWebhookQueueSize = 5000
+)
+
+// 队列满时的处理方式
+const (
+	OverflowReject     = "reject"      // 返回503,由官方平台重发
+	OverflowDropOldest = "drop_oldest" // 丢弃最早的事件,返回200
+)
+
+var (
+	// ErrQueueFull 队列已满,事件没有进入队列
+	ErrQueueFull = errors.New("webhook queue is full")
+	// ErrQueueClosed 队列已关闭,正在退出
+	ErrQueueClosed = errors.New("webhook queue is closed")
+)
+
+// conversationPaths 用于确定事件所属会话的字段,依次取第一个不为空的
+// 同一个群、子频道、频道私信或用户的事件进入同一个队列,由同一个worker依次处理
+var conversationPaths = []string{
+	"d.group_openid",
+	"d.group_id",
+	"d.channel_id",
+	"d.guild_id",
+	"d.author.user_openid",
+	"d.author.member_openid",
+	"d.author.id",
+	"d.user_openid",
+	"d.openid",
+	"id",
+}
+
+// WebhookHandler 负责处理 Webhook 的接收和消息处理
+// 每个worker有自己的队列,同一会话的事件总是进入同一个队列,保证处理顺序
+// 所有队列共享capacity个位置,某个会话的事件较多时可以使用全部空位
+type WebhookHandler struct {
+	queues    []chan *WebhookPayload
+	mu        sync.Mutex // 入队时加锁,丢弃最早的事件与写入新事件之间不被其他请求插入
+	closed    bool       // Close之后不再入队,由mu保护
+	pending   int32      // 所有队列中等待处理的事件数
+	capacity  int
+	busy      int32
+	closeOnce sync.Once
+}
+
+// NewWebhookHandler 创建新的 WebhookHandler 实例,queueSize为所有worker共享的队列长度
+func NewWebhookHandler(workers, queueSize int) *WebhookHandler {
+	if workers <= 0 {
+		workers = defaultWebhookWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultWebhookQueueSize
+	}
+	wh := &WebhookHandler{
+		queues:   make([]chan *WebhookPayload, workers),
+		capacity: queueSize,
+	}
+	for i := range wh.queues {
+		// 每个队列都能容纳全部事件,总数由pending限制
+		wh.queues[i] = make(chan *WebhookPayload, queueSize)
+	}
+	return wh
+}
+
+// conversationKey 事件所属的会话
+func conversationKey(raw []byte) string {
+	for _, path := range conversationPaths {
+		if value := gjson.GetBytes(raw, path).String(); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (wh *WebhookHandler) queueIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(wh.queues)))
+}
+
+// Enqueue 将事件放入所属会话的队列,队列已满时按webhook_overflow处理
+func (wh *WebhookHandler) Enqueue(p *WebhookPayload) error {
+	p.enqueuedAt = time.Now()
+	queue := wh.queues[wh.queueIndex(conversationKey(p.RawMessage))]
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.closed {
+		return ErrQueueClosed
+	}
+	if int(atomic.LoadInt32(&wh.pending)) < wh.capacity {
+		atomic.AddInt32(&wh.pending, 1)
+		queue <- p
+		return nil
+	}
+
+	if config.GetWebhookOverflow() != OverflowDropOldest {
+		metrics.WebhookDropped(OverflowReject)
+		mylog.Errorf("webhook队列已满,返回503等待官方平台重发 event_ts:%s", p.EventTs)
+		return ErrQueueFull
+	}
+	// 优先丢弃同一队列中最早的事件,队列按会话的哈希由多个会话共享,丢弃的不一定是同一会话的事件
+	// 该队列为空时丢弃等待最多的队列中最早的事件
+	if old, ok := wh.dropOldest(queue); ok {
+		metrics.WebhookDropped(OverflowDropOldest)
+		mylog.Errorf("webhook队列已满,丢弃最早的事件 event_ts:%s", old.EventTs)
+		queue <- p
+		return nil
+	}
+	// 丢弃前worker已经取走了全部事件,这时有空位
+	if int(atomic.LoadInt32(&wh.pending)) < wh.capacity {
+		atomic.AddInt32(&wh.pending, 1)
+		queue <- p
+		return nil
+	}
+	metrics.WebhookDropped(OverflowReject)
+	return ErrQueueFull
+}
+
+// dropOldest 取出一个最早的事件,空出的位置留给新事件,pending不变
+func (wh *WebhookHandler) dropOldest(queue chan *WebhookPayload) (*WebhookPayload, bool) {
+	select {
+	case old := <-queue:
+		return old, true
+	default:
+	}
+	longest := queue
+	for _, q := range wh.queues {
+		if len(q) > len(longest) {
+			longest = q
+		}
+	}
+	select {
+	case old := <-longest:
+		return old, true
+	default:
+		return nil, false
+	}
+}
+
+// ListenAndProcessMessages 启动worker处理队列中的事件,阻塞直到Close
+func (wh *WebhookHandler) ListenAndProcessMessages() {
+	var wg sync.WaitGroup
+	for _, queue := range wh.queues {
+		wg.Add(1)
+		go func(queue chan *WebhookPayload) {
+			defer wg.Done()
+			for p := range queue {
+				atomic.AddInt32(&wh.pending, -1)
+				wh.process(p)
+			}
+		}(queue)
+	}
+	wg.Wait()
+	log.Println("Message queue is closed")
+}
+
+// process 在worker中同步处理一个事件,处理完成后worker才取同一队列的下一个事件
+func (wh *WebhookHandler) process(p *WebhookPayload) {
+	atomic.AddInt32(&wh.busy, 1)
+	defer atomic.AddInt32(&wh.busy, -1)
+	defer func() {
+		// handler的panic不影响worker继续处理
+		if err := recover(); err != nil {
+			mylog.Errorf("处理webhook事件时发生panic: %v", err)
+		}
+	}()
+	metrics.WebhookQueueWait(time.Since(p.enqueuedAt))
+
+	mylog.Printf("Processing Webhook event with token: %s", p.PlainToken)
+	// 业务逻辑处理的地方
+	payload := &dto.WSPayload{}
+	if err := json.Unmarshal(p.RawMessage, payload); err != nil {
+		log.Printf("%s json failed, %v", p.EventTs, err)
+		return
+	}
+	// 更新 global_s 的值
+	atomic.StoreInt64(&client.Global_s, payload.S)
+
+	payload.RawMessage = p.RawMessage
+	payload.TraceID = mylog.NewTraceID()
+	payload.Ordered = true
+	mylog.WithTrace(payload.TraceID).Printf("%s receive %s message, %s", p.EventTs, dto.OPMeans(payload.OPCode), string(p.RawMessage))
+
+	botstats.RecordGatewayEvent()
+	metrics.EventReceived(string(payload.Type))
+	if err := event.ParseAndHandle(payload); err != nil {
+		mylog.WithTrace(payload.TraceID).Errorf("处理webhook事件失败: %v", err)
+	}
+}
+
+// QueueDepth 返回队列中等待处理的事件数
+func (wh *WebhookHandler) QueueDepth() int {
+	return int(atomic.LoadInt32(&wh.pending))
+}
+
+// QueueCapacity 返回所有队列共享的长度
+func (wh *WebhookHandler) QueueCapacity() int {
+	return wh.capacity
+}
+
+// BusyWorkers 返回正在处理事件的worker数
+func (wh *WebhookHandler) BusyWorkers() int {
+	return int(atomic.LoadInt32(&wh.busy))
+}
+
+// Close 关闭消息队列
+func (wh *WebhookHandler) Close() {
+	wh.closeOnce.Do(func() {
+		wh.mu.Lock()
+		defer wh.mu.Unlock()
+		wh.closed = true
+		for _, queue := range wh.queues {
+			close(queue)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"sync"
@@ -12,7 +14,11 @@ import (
 	"github.com/hoshinonyaruko/gensokyo/Processor"
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+	"github.com/hoshinonyaruko/gensokyo/registry"
+	"github.com/hoshinonyaruko/gensokyo/router"
 	"github.com/hoshinonyaruko/gensokyo/wsclient"
 	"github.com/tencent-connect/botgo/openapi"
 )
@@ -22,26 +28,55 @@ type WebSocketServerClient struct {
 	API   openapi.OpenAPI
 	APIv2 openapi.OpenAPI
 	mu    sync.Mutex // 互斥锁保护 conn
+	// 连接使用的onebot版本 11或12
+	OnebotVersion int
+	// 连接的角色 Universal API Event,与反向ws的X-Client-Role一致
+	Role string
+	// 连接在注册表中的条目,记录收发计数
+	entry *registry.Conn
 }
 
+// 确保注册时在广播可见之前设置entry
+var _ registry.EntryBinder = &WebSocketServerClient{}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
+// onebotv12连接使用的upgrader,协商12.gensokyo子协议
+var upgraderV12 = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+	Subprotocols: []string{"12." + onebotv12.Impl},
+}
+
 // 确保WebSocketServerClient实现了interfaces.WebSocketServerClienter接口
 var _ callapi.WebSocketServerClienter = &WebSocketServerClient{}
 
 // 使用闭包结构 因为gin需要c *gin.Context固定签名
 func WsHandlerWithDependencies(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processors) gin.HandlerFunc {
+	return WsRoleHandlerWithDependencies(api, apiV2, p, wsclient.RoleUniversal)
+}
+
+// 正向ws的/api和/event路径,role为wsclient.RoleAPI或wsclient.RoleEvent
+func WsRoleHandlerWithDependencies(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processors, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wsHandler(api, apiV2, p, c, 11, role)
+	}
+}
+
+// onebotv12正向ws的handler
+func WsHandlerV12WithDependencies(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processors) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		wsHandler(api, apiV2, p, c)
+		wsHandler(api, apiV2, p, c, 12, wsclient.RoleUniversal)
 	}
 }
 
 // 处理正向ws客户端的连接
-func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processors, c *gin.Context) {
+func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processors, c *gin.Context, onebotVersion int, role string) {
 	// 先从请求头中尝试获取token
 	tokenFromHeader := c.Request.Header.Get("Authorization")
 	token := ""
@@ -76,23 +111,29 @@ func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processo
 		return
 	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	wsUpgrader := upgrader
+	if onebotVersion == 12 {
+		wsUpgrader = upgraderV12
+	}
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		mylog.Printf("Failed to set websocket upgrade: %+v", err)
 		return
 	}
 
 	clientIP := c.ClientIP()
-	mylog.Printf("WebSocket client connected. IP: %s", clientIP)
+	mylog.Printf("WebSocket onebotv%d %s client connected. IP: %s", onebotVersion, role, clientIP)
 
 	// 创建WebSocketServerClient实例
 	client := &WebSocketServerClient{
-		Conn:  conn,
-		API:   api,
-		APIv2: apiV2,
+		Conn:          conn,
+		API:           api,
+		APIv2:         apiV2,
+		OnebotVersion: onebotVersion,
+		Role:          role,
 	}
-	// 将此客户端添加到Processor的WsServerClients列表中
-	p.WsServerClients = append(p.WsServerClients, client)
+	// 将此客户端添加到Processor的连接注册表中,entry在对广播可见之前由BindEntry设置
+	p.WsServerClients.Add(client, clientIP, fmt.Sprintf("onebotv%d", onebotVersion), role)
 
 	// 获取botID
 
@@ -118,17 +159,20 @@ func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processo
 
 	// 在defer语句之前运行
 	defer func() {
-		// 移除客户端从WsServerClients
-		for i, wsClient := range p.WsServerClients {
-			if wsClient == client {
-				p.WsServerClients = append(p.WsServerClients[:i], p.WsServerClients[i+1:]...)
-				break
-			}
-		}
+		// 从注册表中移除客户端
+		p.WsServerClients.Remove(client.entry)
+		router.Forget(client)
 	}()
 	//退出时候的清理
 	defer conn.Close()
 
+	// 定时发送心跳元事件,API连接不接收事件
+	if client.AcceptsEvents() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go client.sendHeartbeat(ctx, botID, config.GetHeartBeatInterval())
+	}
+
 	for {
 		messageType, p, err := conn.ReadMessage()
 		if err != nil {
@@ -136,6 +180,7 @@ func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processo
 			return
 		}
 
+		client.entry.AddReceived()
 		if messageType == websocket.TextMessage {
 			processWSMessage(client, p)
 		}
@@ -143,6 +188,15 @@ func wsHandler(api openapi.OpenAPI, apiV2 openapi.OpenAPI, p *Processor.Processo
 }
 
 func processWSMessage(client *WebSocketServerClient, msg []byte) {
+	// Event连接只上报事件,不接受action
+	if client.Role == wsclient.RoleEvent {
+		mylog.Printf("正向ws Event连接不接受action,已忽略: %s", string(msg))
+		return
+	}
+	if client.OnebotVersion == 12 {
+		processWSMessageV12(client, msg)
+		return
+	}
 	var message callapi.ActionMessage
 	err := json.Unmarshal(msg, &message)
 	if err != nil {
@@ -155,8 +209,38 @@ func processWSMessage(client *WebSocketServerClient, msg []byte) {
 	go callapi.CallAPIFromDict(client, client.API, client.APIv2, message)
 }
 
+// 处理onebotv12应用端发来的action,转换为v11后复用现有handler
+func processWSMessageV12(client *WebSocketServerClient, msg []byte) {
+	message, action, err := onebotv12.ParseAction(msg)
+	if err != nil {
+		mylog.Printf("Error unmarshalling onebotv12 message: %v, Original message: %s", err, string(msg))
+		return
+	}
+
+	mylog.Println("Received from WebSocket onebotv12 client:", wsclient.TruncateMessage(message, 500))
+	if action == onebotv12.ActionGetSupportedActions {
+		client.SendMessage(onebotv12.SupportedActionsResponse(message.Echo))
+		return
+	}
+	if !callapi.HasHandler(message.Action) {
+		client.SendMessage(onebotv12.UnsupportedActionResponse(action, message.Echo))
+		return
+	}
+	// 调用callapi,响应由onebotv12.Client转换为v12格式
+	go callapi.CallAPIFromDict(onebotv12.NewClient(client, action), client.API, client.APIv2, message)
+}
+
 // 发信息给client
 func (c *WebSocketServerClient) SendMessage(message map[string]interface{}) error {
+	// API连接只用于调用api,不接收事件
+	if !c.AcceptsEvents() && onebotv12.IsEvent(message) {
+		return nil
+	}
+	// onebotv12连接需要将v11事件转换为v12事件
+	if c.OnebotVersion == 12 && onebotv12.IsEvent(message) {
+		message = onebotv12.ConvertEvent(message)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -165,9 +249,54 @@ func (c *WebSocketServerClient) SendMessage(message map[string]interface{}) erro
 		mylog.Println("Error marshalling message:", err)
 		return err
 	}
-	return c.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+	err = c.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+	c.entry.AddSent(err)
+	return err
+}
+
+// BindEntry 由注册表在连接加入之前调用,记录连接在注册表中的条目
+func (c *WebSocketServerClient) BindEntry(entry *registry.Conn) {
+	c.entry = entry
 }
 
 func (client *WebSocketServerClient) Close() error {
 	return client.Conn.Close()
 }
+
+// BackendName 正向ws以其路径类型作为应用端名称
+func (client *WebSocketServerClient) BackendName() string {
+	if client.OnebotVersion == 12 {
+		return router.BackendWsServerV12
+	}
+	return router.BackendWsServer
+}
+
+// AcceptsEvents 是否向该连接上报事件,/api路径的连接只返回action的响应
+func (client *WebSocketServerClient) AcceptsEvents() bool {
+	return client.Role != wsclient.RoleAPI
+}
+
+// sendHeartbeat 定时向正向ws连接发送心跳元事件,避免应用端的看门狗断开连接
+func (client *WebSocketServerClient) sendHeartbeat(ctx context.Context, botID uint64, heartbeatinterval int) {
+	if heartbeatinterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(heartbeatinterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := client.SendMessage(handlers.HeartbeatEvent(botID, heartbeatinterval)); err != nil {
+				mylog.Printf("Error sending heartbeat to WebSocket client: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// EventFilter 返回该连接所在正向ws路径的事件过滤规则
+func (client *WebSocketServerClient) EventFilter() string {
+	return config.GetWsServerFilter(client.OnebotVersion)
+}
@@ -0,0 +1,197 @@
+// Package sessionstore 将网关各分片的session id与seq保存到文件,进程重启后先尝试resume,补收重启期间的事件
+package sessionstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+// FileName 保存session的文件
+const FileName = "gateway_session.json"
+
+// 内存中的变化写入文件的间隔
+const flushInterval = time.Second
+
+// Record 一个分片保存的session
+type Record struct {
+	AppID      uint64 `json:"app_id"`
+	ShardID    uint32 `json:"shard_id"`
+	ShardCount uint32 `json:"shard_count"`
+	Intent     int    `json:"intent"`
+	SessionID  string `json:"session_id"`
+	Seq        uint32 `json:"seq"`
+	UpdatedAt  int64  `json:"updated_at"` // 最近一次收到事件或心跳回应的时间
+}
+
+// Store 基于json文件的botgo session持久化实现
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]Record
+	dirty   bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	defaultStore *Store
+	closeOnce    sync.Once
+)
+
+// Init 读取上次运行保存的session并注册到botgo,session_resume_window为0时不注册,每次启动都identify
+func Init() {
+	if config.GetSessionResumeWindow() <= 0 {
+		return
+	}
+	defaultStore = New(FileName)
+	websocket.RegisterSessionStore(defaultStore)
+}
+
+// Close 将未写入的session写入文件,进程退出前调用
+func Close() {
+	if defaultStore == nil {
+		return
+	}
+	closeOnce.Do(defaultStore.Close)
+}
+
+// New 创建Store并读取文件中已保存的session
+func New(path string) *Store {
+	s := &Store{
+		path:    path,
+		records: make(map[string]Record),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var records []Record
+		if err := json.Unmarshal(data, &records); err != nil {
+			mylog.Printf("读取%s失败,将重新identify: %v", path, err)
+		}
+		for _, record := range records {
+			s.records[key(record.AppID, record.ShardID, record.ShardCount)] = record
+		}
+	} else if !os.IsNotExist(err) {
+		mylog.Printf("读取%s失败,将重新identify: %v", path, err)
+	}
+	go s.flushLoop()
+	return s
+}
+
+func key(appID uint64, shardID, shardCount uint32) string {
+	return fmt.Sprintf("%d:%d/%d", appID, shardID, shardCount)
+}
+
+func sessionKey(session *dto.Session) string {
+	return key(session.Token.GetAppID(), session.Shards.ShardID, session.Shards.ShardCount)
+}
+
+// Load 相同机器人、分片和intent的session在session_resume_window秒内更新过时,填入session id与seq
+func (s *Store) Load(session *dto.Session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[sessionKey(session)]
+	if !ok || record.SessionID == "" {
+		return false
+	}
+	window := time.Duration(config.GetSessionResumeWindow()) * time.Second
+	if age := time.Since(time.Unix(record.UpdatedAt, 0)); window <= 0 || age > window {
+		mylog.Printf("分片[%d/%d]保存的session已过期(%s前),将重新identify", record.ShardID, record.ShardCount, age.Truncate(time.Second))
+		return false
+	}
+	if record.Intent != int(session.Intent) {
+		mylog.Printf("分片[%d/%d]的intent已改变,将重新identify", record.ShardID, record.ShardCount)
+		return false
+	}
+	session.ID = record.SessionID
+	session.LastSeq = record.Seq
+	mylog.Printf("分片[%d/%d]将resume上次的session %s, seq:%d", record.ShardID, record.ShardCount, record.SessionID, record.Seq)
+	return true
+}
+
+// Save 在内存中更新session,由后台协程写入文件
+func (s *Store) Save(session *dto.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[sessionKey(session)] = Record{
+		AppID:      session.Token.GetAppID(),
+		ShardID:    session.Shards.ShardID,
+		ShardCount: session.Shards.ShardCount,
+		Intent:     int(session.Intent),
+		SessionID:  session.ID,
+		Seq:        session.LastSeq,
+		UpdatedAt:  time.Now().Unix(),
+	}
+	s.dirty = true
+}
+
+// Clear 删除分片保存的session
+func (s *Store) Clear(session *dto.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := sessionKey(session)
+	if _, ok := s.records[k]; ok {
+		delete(s.records, k)
+		s.dirty = true
+	}
+}
+
+// Close 停止后台协程并写入文件
+func (s *Store) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Store) flushLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush 有变化时写入临时文件再改名,避免写入中途退出时损坏文件
+func (s *Store) flush() {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		mylog.Printf("保存网关session失败: %v", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		mylog.Printf("保存网关session失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		mylog.Printf("保存网关session失败: %v", err)
+	}
+}
@@ -8,11 +8,17 @@ type FriendData struct {
 
 type Settings struct {
 	//反向ws设置
-	WsAddress           []string `yaml:"ws_address"`
-	WsToken             []string `yaml:"ws_token"`
-	ReconnecTimes       int      `yaml:"reconnect_times"`
-	HeartBeatInterval   int      `yaml:"heart_beat_interval"`
-	LaunchReconectTimes int      `yaml:"launch_reconnect_times"`
+	WsAddress            []string `yaml:"ws_address"`
+	WsToken              []string `yaml:"ws_token"`
+	ReconnecTimes        int      `yaml:"reconnect_times"`
+	HeartBeatInterval    int      `yaml:"heart_beat_interval"`
+	LaunchReconectTimes  int      `yaml:"launch_reconnect_times"`
+	WsOnebotVersion      []int    `yaml:"ws_onebot_version"`
+	WsFilter             []string `yaml:"ws_filter"`
+	WsRole               []string `yaml:"ws_role"`
+	ReconnectIntervalMin int      `yaml:"reconnect_interval_min"`
+	ReconnectIntervalMax int      `yaml:"reconnect_interval_max"`
+	ReconnectRedial      int      `yaml:"reconnect_redial_interval"`
 	//基础配置
 	AppID        uint64 `yaml:"app_id"`
 	Uin          int64  `yaml:"uin"`
@@ -22,6 +28,13 @@ type Settings struct {
 	ShardID      int    `yaml:"shard_id"`
 	UseUin       bool   `yaml:"use_uin"`
 	ShardNum     int    `yaml:"shard_num"`
+	//分片协调
+	ShardCoordinator     string `yaml:"shard_coordinator"`
+	ShardCoordinatorPath string `yaml:"shard_coordinator_path"`
+	ShardRedisAddr       string `yaml:"shard_redis_addr"`
+	ShardRedisPassword   string `yaml:"shard_redis_password"`
+	ShardRedisDB         int    `yaml:"shard_redis_db"`
+	ShardLeaseTTL        int    `yaml:"shard_lease_ttl"`
 	//事件订阅类
 	TextIntent []string `yaml:"text_intent"`
 	//转换类
@@ -64,9 +77,12 @@ type Settings struct {
 	ServerTempQQguild       string   `yaml:"server_temp_qqguild"`
 	ServerTempQQguildPool   []string `yaml:"server_temp_qqguild_pool"`
 	//正向ws设置
-	WsServerPath   string `yaml:"ws_server_path"`
-	EnableWsServer bool   `yaml:"enable_ws_server"`
-	WsServerToken  string `yaml:"ws_server_token"`
+	WsServerPath      string `yaml:"ws_server_path"`
+	EnableWsServer    bool   `yaml:"enable_ws_server"`
+	WsServerToken     string `yaml:"ws_server_token"`
+	WsServerPathV12   string `yaml:"ws_server_path_v12"`
+	WsServerFilter    string `yaml:"ws_server_filter"`
+	WsServerFilterV12 string `yaml:"ws_server_filter_v12"`
 	//ssl和链接转换类
 	IdentifyFile     bool     `yaml:"identify_file"`
 	IdentifyAppids   []int64  `yaml:"identify_appids"`
@@ -75,13 +91,21 @@ type Settings struct {
 	UseSelfCrt       bool     `yaml:"use_self_crt"`
 	WebhookPath      string   `yaml:"webhook_path"`
 	WebhookPrefixIp  []string `yaml:"webhook_prefix_ip"`
+	WebhookWorkers   int      `yaml:"webhook_workers"`
+	WebhookQueueSize int      `yaml:"webhook_queue_size"`
+	WebhookOverflow  string   `yaml:"webhook_overflow"`
 	ForceSSL         bool     `yaml:"force_ssl"`
 	HttpPortAfterSSL string   `yaml:"http_port_after_ssl"`
 	//日志类
-	DeveloperLog     bool `yaml:"developer_log"`
-	LogLevel         int  `yaml:"log_level"`
-	SaveLogs         bool `yaml:"save_logs"`
-	LogSuffixPerMins int  `yaml:"log_suffix_per_mins"`
+	DeveloperLog     bool   `yaml:"developer_log"`
+	LogLevel         int    `yaml:"log_level"`
+	SaveLogs         bool   `yaml:"save_logs"`
+	LogSuffixPerMins int    `yaml:"log_suffix_per_mins"`
+	LogFormat        string `yaml:"log_format"`
+	LogMaxSizeMB     int    `yaml:"log_max_size_mb"`
+	LogMaxFiles      int    `yaml:"log_max_files"`
+	LogMaxAgeDays    int    `yaml:"log_max_age_days"`
+	LogCompress      bool   `yaml:"log_compress"`
 	//webui相关
 	DisableWebui bool   `yaml:"disable_webui"`
 	Username     string `yaml:"server_user_name"`
@@ -133,12 +157,29 @@ type Settings struct {
 	PutInteractionDelay      int      `yaml:"put_interaction_delay"`
 	PutInteractionExcept     []string `yaml:"put_interaction_except"`
 	//onebot修改
-	TwoWayEcho       bool `yaml:"twoway_echo"`
-	Array            bool `yaml:"array"`
-	NativeOb11       bool `yaml:"native_ob11"`
-	DisableErrorChan bool `yaml:"disable_error_chan"`
-	StringOb11       bool `yaml:"string_ob11"`
-	StringAction     bool `yaml:"string_action"`
+	TwoWayEcho        bool `yaml:"twoway_echo"`
+	Array             bool `yaml:"array"`
+	NativeOb11        bool `yaml:"native_ob11"`
+	DisableErrorChan  bool `yaml:"disable_error_chan"`
+	StringOb11        bool `yaml:"string_ob11"`
+	StringAction      bool `yaml:"string_action"`
+	EnableMsgStore    bool `yaml:"enable_msg_store"`
+	MsgStoreRetention int  `yaml:"msg_store_retention"`
+	OutboxMaxAge      int  `yaml:"outbox_max_age"`
+	OutboxMaxSize     int  `yaml:"outbox_max_size"`
+	OutboxReplyWindow int  `yaml:"outbox_reply_window"`
+	//satori
+	EnableSatori bool   `yaml:"enable_satori"`
+	SatoriPath   string `yaml:"satori_path"`
+	SatoriToken  string `yaml:"satori_token"`
+	//监控
+	MetricsToken       string   `yaml:"metrics_token"`
+	StatsRetentionDays int      `yaml:"stats_retention_days"`
+	HealthzComponents  []string `yaml:"healthz_components"`
+	ReadyzComponents   []string `yaml:"readyz_components"`
+	//网关
+	SessionResumeWindow int `yaml:"session_resume_window"`
+	DedupTTL            int `yaml:"dedup_ttl"`
 	//url相关
 	VisibleIp    bool `yaml:"visible_ip"`
 	UrlToQrimage bool `yaml:"url_to_qrimage"`
@@ -187,6 +228,11 @@ type Settings struct {
 	PostSecret          []string `yaml:"post_secret"`
 	PostMaxRetries      []int    `yaml:"post_max_retries"`
 	PostRetriesInterval []int    `yaml:"post_retries_interval"`
+	PostFilter          []string `yaml:"post_filter"`
+	//事件路由
+	EventRoutes       []EventRouteConfig  `yaml:"event_routes"`
+	EventRouteDefault []string            `yaml:"event_route_default"`
+	BackendPools      []BackendPoolConfig `yaml:"backend_pools"`
 	//腾讯云
 	TencentBucketName   string `yaml:"t_COS_BUCKETNAME"`
 	TencentBucketRegion string `yaml:"t_COS_REGION"`
@@ -206,6 +252,24 @@ type Settings struct {
 	AliyunAudit           bool   `yaml:"a_audit"`
 }
 
+// 负载均衡池,池中的应用端每个事件只有一个会收到
+type BackendPoolConfig struct {
+	Name     string   `yaml:"name"`
+	Members  []string `yaml:"members"`
+	Strategy string   `yaml:"strategy"`
+}
+
+// 事件路由规则,填写的条件需要同时满足
+type EventRouteConfig struct {
+	Prefix      string   `yaml:"prefix"`
+	GroupID     []string `yaml:"group_id"`
+	UserID      []string `yaml:"user_id"`
+	PostType    []string `yaml:"post_type"`
+	MessageType []string `yaml:"message_type"`
+	Backends    []string `yaml:"backends"`
+	Exclusive   bool     `yaml:"exclusive"`
+}
+
 type VisualPrefixConfig struct {
 	Prefix          string   `yaml:"prefix"`
 	WhiteList       []string `yaml:"whiteList"`
@@ -6,8 +6,14 @@ settings:
   #反向ws设置
   ws_address: ["ws://<YOUR_WS_ADDRESS>:<YOUR_WS_PORT>"] # WebSocket服务的地址 支持多个["","",""]
   ws_token: ["","",""]              #连接wss地址时服务器所需的token,按顺序一一对应,如果是ws地址,没有密钥,请留空.
-  reconnect_times : 100             #反向ws连接失败后的重试次数,希望一直重试,可设置9999
-  heart_beat_interval : 5          #反向ws心跳间隔 单位秒 推荐5-10
+  reconnect_times : 100             #反向ws连接失败后的重试次数,设置为-1时无限重试
+  reconnect_interval_min : 1        #反向ws重连的初始间隔 单位秒,每次失败后间隔翻倍并加入随机抖动
+  reconnect_interval_max : 60       #反向ws重连间隔的上限 单位秒
+  reconnect_redial_interval : 300   #超过重试次数放弃重连后,每隔多少秒在后台重新尝试一轮连接,0为不再尝试
+  heart_beat_interval : 5          #正反向ws心跳元事件的间隔 单位秒 推荐5-10
+  ws_onebot_version : [11]          #反向ws使用的onebot协议版本,可选11或12,按顺序与ws_address一一对应,未填写的默认为11
+  ws_filter : []                    #反向ws的事件过滤规则,按顺序与ws_address一一对应,可填写规则文件路径或json,格式同go-cqhttp的filter.json,为空则不过滤
+  ws_role : []                      #反向ws的X-Client-Role,按顺序与ws_address一一对应,可选Universal API Event,未填写的默认为Universal.API连接只接受action,Event连接只上报事件
   launch_reconnect_times : 1        #启动时尝试反向ws连接次数,建议先打开应用端再开启gensokyo,因为启动时连接会阻塞webui启动,默认只连接一次,可自行增大
 
   #基础设置
@@ -19,6 +25,12 @@ settings:
   shard_count: 1                    #分片数量 默认1
   shard_id: 0                       #当前分片id 默认从0开始,详细请看 https://bot.q.qq.com/wiki/develop/api/gateway/reference.html
   shard_num: 1                      #接口调用超过频率限制时,如果不想要多开gsk,尝试调大.gsk会尝试连接到n个分片处理信息. n为你所配置的值.与 shard_count和shard_id互不相干.
+  shard_coordinator : ""            #自动分配分片的协调方式,""为手动配置shard_id,"bolt"为同一台机器上的多个gsk共用shard_coordinator_path文件,"redis"为多台机器共用shard_redis_addr.启用后忽略shard_id,总分片数为shard_count(为1时为shard_num),各gsk平分分片
+  shard_coordinator_path : "shards.db"  #shard_coordinator为bolt时各gsk共用的租约文件路径
+  shard_redis_addr : "127.0.0.1:6379"   #shard_coordinator为redis时的redis地址
+  shard_redis_password : ""         #redis密码
+  shard_redis_db : 0                #redis数据库编号
+  shard_lease_ttl : 30              #分片租约的有效期(秒),gsk退出或失联超过该时间后,其他gsk接管它的分片
 
   #事件订阅
   text_intent:                                       # 请根据公域 私域来选择intent,错误的intent将连接失败
@@ -85,9 +97,27 @@ settings:
   server_temp_qqguild_pool : []      #填写v3发图接口的endpoint http://127.0.0.1:12345/uploadpicv3 当填写多个时采用循环方式负载均衡,注,不包括自身,如需要自身也要填写
 
   #正向ws设置
-  ws_server_path : "ws"             #默认监听0.0.0.0:port/ws_server_path 若有安全需求,可不放通port到公网,或设置ws_server_token 若想监听/ 可改为"",若想监听到不带/地址请写nil
+  ws_server_path : "ws"             #默认监听0.0.0.0:port/ws_server_path 若有安全需求,可不放通port到公网,或设置ws_server_token 若想监听/ 可改为"",若想监听到不带/地址请写nil,同时在ws_server_path/api和ws_server_path/event提供分离的api和event连接
   enable_ws_server: true            #是否启用正向ws服务器 监听server_dir:port/ws_server_path
   ws_server_token : "12345"         #正向ws的token 不启动正向ws可忽略 可为空
+  ws_server_path_v12 : ""           #onebotv12正向ws的路径,如"v12",监听0.0.0.0:port/ws_server_path_v12,与ws_server_token共用鉴权,为空则不启用
+  ws_server_filter : ""             #正向ws(ws_server_path)的事件过滤规则,规则文件路径或json,为空则不过滤
+  ws_server_filter_v12 : ""         #onebotv12正向ws(ws_server_path_v12)的事件过滤规则,为空则不过滤
+
+  #satori设置
+  enable_satori : false             #是否启用satori协议服务端,http api为0.0.0.0:port/satori_path/v1/{method},事件推送为ws://0.0.0.0:port/satori_path/v1/events
+  satori_path : "satori"            #satori服务端的路径前缀,为空则监听0.0.0.0:port/v1
+  satori_token : ""                 #satori的token,应用端通过Authorization: Bearer <token>和IDENTIFY信令鉴权,可为空
+
+  #监控设置
+  metrics_token : ""                #prometheus指标0.0.0.0:port/metrics的token,通过Authorization: Bearer <token>或access_token参数鉴权,为空则不鉴权
+  stats_retention_days : 30         #botstats.db中按小时的历史收发统计保留天数,0为永久保留
+  healthz_components : []           #存活检查0.0.0.0:port/healthz中不健康时返回503的组件,可选gateway token idmap gensokyo_db botstats backends
+  readyz_components : ["gateway","token","idmap","gensokyo_db","botstats"]  #就绪检查0.0.0.0:port/readyz中不健康时返回503的组件,backends为至少连接一个onebot应用端
+
+  #网关设置
+  dedup_ttl : 300                   #在该秒数内按事件id和信息id丢弃重复收到的webhook与网关事件,0为只按信息id对群@信息去重5分钟
+  session_resume_window : 300       #重启后若上次的网关session在该秒数内仍活跃,先resume补收重启期间的事件,失败再identify,session保存在gateway_session.json,0为每次启动都identify
 
   #SSL配置类 和 白名单域名自动验证
   identify_file : true               #自动生成域名校验文件,在q.qq.com配置信息URL,在server_dir填入自己已备案域名,正确解析到机器人所在服务器ip地址,机器人即可发送链接
@@ -95,6 +125,9 @@ settings:
   crt : ""                           #证书路径 从你的域名服务商或云服务商申请签发SSL证书(qq要求SSL) 
   key : ""                           #密钥路径 Apache（crt文件、key文件）示例: "C:\\123.key" \需要双写成\\
   webhook_path : "webhook"           #webhook监听的地址,默认\webhook
+  webhook_workers : 16               #处理webhook事件的worker数,同一群/频道/用户的事件由同一个worker按顺序处理
+  webhook_queue_size : 5000          #webhook事件队列的总长度,由所有worker共享
+  webhook_overflow : "reject"        #队列已满时的处理方式,reject返回503由官方平台重发,drop_oldest丢弃同一队列(按会话哈希,多个会话共享)中最早的事件,该队列为空时丢弃等待最多的队列中最早的事件
   force_ssl : false                  #默认当port设置为443时启用ssl,true可以在其他port设置下强制启用ssl.
   http_port_after_ssl : "444"       # 指定启动SSL之后的备用HTTP服务器的端口号，默认为444
   
@@ -103,6 +136,11 @@ settings:
   log_level : 1                     # 0=debug 1=info 2=warning 3=error 默认1
   save_logs : false                 #自动储存日志
   log_suffix_per_mins : 0           #默认0,代表不切分日志文件,设置60代表每60分钟储存一个日志文件,如果你的日志文件太大打不开,可以设置这个到合适的时间范围.
+  log_format : "text"               #日志格式,text为文本,json为每行一个json对象,包含time、level、msg以及同一事件触发的action和官方api请求共用的trace_id
+  log_max_size_mb : 0               #单个日志文件的最大大小(MB),超过后切分,0为不限制.对日志和error日志同时生效,以下4项支持热重载
+  log_max_files : 0                 #保留的已切分日志文件数量,超过后删除最旧的,0为不限制
+  log_max_age_days : 0              #日志文件保留天数,0为永久保留
+  log_compress : false              #切分后的日志文件使用gzip压缩为.log.gz
 
   #webui设置
   disable_webui: false              #禁用webui
@@ -179,6 +217,11 @@ settings:
   disable_error_chan : false        #禁用ws断开时候将信息放入补发频道,当信息非常多时可能导致冲垮应用端,可以设置本选项为true.
   string_ob11 : false               #api不再返回转换后的int类型,而是直接转换,需应用端适配.
   string_action : false             #开启后将兼容action调用中使用string形式的user_id和group_id.
+  enable_msg_store : true           #将收到的信息储存在messages.db,供get_msg等api取回信息内容.
+  msg_store_retention : 72          #信息的保留时间,单位小时,超过后自动清理.0代表永不清理.
+  outbox_max_age : 3600             #反向ws断开期间的事件储存在outbox.db,重连后按顺序补发.事件的最长保留时间,单位秒,0代表不限制.
+  outbox_max_size : 5000            #每个反向ws地址最多储存的事件数,超过后丢弃最旧的事件,0代表不限制.
+  outbox_reply_window : 300         #被动回复的时间窗口,单位秒,超过后message事件的msg_id无法再用于回复,不再补发.0代表不限制.
 
   #URL相关
   visible_ip : false                #转换url时,如果server_dir是ip true将以ip形式发出url 默认隐藏url 将server_dir配置为自己域名可以转换url
@@ -231,11 +274,28 @@ settings:
   http_version : 11                 #暂时只支持11
   http_timeout: 5                   #反向 HTTP 超时时间, 单位秒，<5 时将被忽略
 
-  #HTTP API配置-反向http
+  #HTTP API配置-反向http 应用端在响应中返回的快速操作(reply at_sender delete ban)会自动执行
   post_url: [""]                    #反向HTTP POST地址列表 为空代表不开启 示例:http://192.168.0.100:5789
-  post_secret: [""]                 #密钥
+  post_secret: [""]                 #密钥,填写后使用HMAC-SHA1对上报内容签名,放在X-Signature请求头中,与go-cqhttp相同
   post_max_retries: [3]             #最大重试,0 时禁用
-  post_retries_interval: [1500]     #重试时间,单位毫秒,0 时立即
+  post_retries_interval: [1500]     #重试时间,单位毫秒,0 时立即,之后每次重试等待时间翻倍,最长30秒
+  post_filter: []                   #http上报的事件过滤规则,按顺序与post_url一一对应,规则文件路径或json,为空则不过滤
+
+  #事件路由 让一个gensokyo同时对接多个应用端,而不是每个应用端都收到并回复同一条信息
+  #应用端名称:反向ws和http上报填写ws_address或post_url中的地址,正向ws填写ws_server或ws_server_v12,satori填写satori
+  event_route_default: []           #未命中路由规则的事件发送到的应用端,为空则发送到所有应用端
+  event_routes: []                  #路由规则,按顺序匹配,填写的条件需要同时满足,示例如下
+  #- prefix: "/ai"                  #raw_message以该前缀开头(忽略开头的at)
+  #  group_id: []                   #群号,可填写多个
+  #  user_id: []                    #用户id,可填写多个
+  #  post_type: []                  #message notice request meta_event
+  #  message_type: []               #group private guild
+  #  backends: ["ws://127.0.0.1:8080"] #命中后发送到的应用端
+  #  exclusive: true                #true时只发送到该规则的应用端,false时同时发送到默认应用端
+  backend_pools: []                 #负载均衡池,同一个应用端的多个副本放在一个池中,每个事件只发送给池中的一个成员,示例如下
+  #- name: "bot"                    #池的名称,可以填写在event_routes的backends中
+  #  members: ["ws://127.0.0.1:8081","ws://127.0.0.1:8082"] #成员,填写应用端名称,正向ws路径上的所有连接都属于该成员
+  #  strategy: "round_robin"        #round_robin轮询 least_inflight最少发送中 hash_group按群(私聊)一致性哈希,发送失败时转移到下一个成员
 
   #腾讯云配置
   t_COS_BUCKETNAME : ""             #存储桶名称
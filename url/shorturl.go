@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
@@ -384,3 +385,13 @@ func RedirectFromShortURLHandler(c *gin.Context) {
 func CloseDB() {
 	db.Close()
 }
+
+// Ping 检查gensokyo.db是否可以读取,用于健康检查
+func Ping() error {
+	if db == nil {
+		return errors.New("database is not initialized")
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
@@ -14,7 +14,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/registry"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/host"
@@ -95,6 +97,21 @@ func CombinedMiddleware(api openapi.OpenAPI, apiV2 openapi.OpenAPI) gin.HandlerF
 				}
 				return
 			}
+			//正反向ws连接状态
+			if c.Param("filepath") == "/api/connections" && c.Request.Method == http.MethodGet {
+				handleConnections(c)
+				return
+			}
+			//断开一个正向ws或satori连接
+			if strings.HasPrefix(c.Param("filepath"), "/api/connections/") && c.Request.Method == http.MethodDelete {
+				handleKickConnection(c, strings.TrimPrefix(c.Param("filepath"), "/api/connections/"))
+				return
+			}
+			//历史收发统计
+			if c.Param("filepath") == "/api/"+appIDStr+"/stats" && c.Request.Method == http.MethodGet {
+				handleBotStats(c)
+				return
+			}
 			//更新当前选中机器人的配置并重启应用(保持地址不变)
 			if c.Param("filepath") == "/api/"+appIDStr+"/config" && c.Request.Method == http.MethodPatch {
 				handlePatchConfig(c)
@@ -342,6 +359,7 @@ func HandleAccountsRequest(c *gin.Context) {
 func HandleProcessStatusRequest(c *gin.Context) {
 	responseData := gin.H{
 		"status":     "running",
+		"bot_status": handlers.CurrentStatus(), // 与get_status一致的在线状态和统计
 		"total_logs": 0,
 		"restarts":   0,
 		"qr_uri":     nil,
@@ -512,6 +530,49 @@ func HandleCheckLoginStatusRequest(c *gin.Context) {
 	}
 }
 
+// handleConnections 返回正向ws连接列表和反向ws各地址的连接状态
+func handleConnections(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"ws_server":  registry.Default.List(),
+		"reverse_ws": registry.ReverseStates(),
+	})
+}
+
+// handleKickConnection 按connections返回的client_id断开一个正向ws或satori连接
+func handleKickConnection(c *gin.Context, clientID string) {
+	id, err := strconv.ParseUint(clientID, 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client_id"})
+		return
+	}
+	if err := registry.Default.Kick(id); err != nil {
+		mylog.Printf("断开连接[%d]失败: %v", id, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	mylog.Printf("webui已断开连接[%d]", id)
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleBotStats 返回时间范围内的收发趋势和最活跃的群,参数与get_bot_stats一致
+func handleBotStats(c *gin.Context) {
+	startTime, _ := strconv.ParseInt(c.Query("start_time"), 10, 64)
+	endTime, _ := strconv.ParseInt(c.Query("end_time"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	data, err := handlers.BotStats(handlers.BotStatsQuery{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Interval:  c.Query("interval"),
+		GroupID:   c.Query("group_id"),
+		Limit:     limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, data)
+}
+
 func handleSysInfo(c *gin.Context) {
 	// 获取CPU使用率
 	cpuPercent, _ := cpu.Percent(time.Second, false)
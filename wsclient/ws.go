@@ -3,40 +3,76 @@ package wsclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/hoshinonyaruko/gensokyo/botstats"
 	"github.com/hoshinonyaruko/gensokyo/callapi"
 	"github.com/hoshinonyaruko/gensokyo/config"
+	"github.com/hoshinonyaruko/gensokyo/handlers"
 	"github.com/hoshinonyaruko/gensokyo/mylog"
+	"github.com/hoshinonyaruko/gensokyo/onebotv12"
+	"github.com/hoshinonyaruko/gensokyo/outbox"
+	"github.com/hoshinonyaruko/gensokyo/registry"
 	"github.com/tencent-connect/botgo/openapi"
 )
 
 type WebSocketClient struct {
-	conn           *websocket.Conn
-	api            openapi.OpenAPI
-	apiv2          openapi.OpenAPI
-	botID          uint64
-	urlStr         string
-	cancel         context.CancelFunc
-	isReconnecting bool
-	sendFailures   []map[string]interface{} // 存储失败的消息
-	writeCh        chan writeRequest        // 写请求通道
-	closeCh        chan struct{}            // 用于关闭的通道
+	conn          *websocket.Conn
+	api           openapi.OpenAPI
+	apiv2         openapi.OpenAPI
+	botID         uint64
+	urlStr        string
+	cancel        context.CancelFunc
+	mu            sync.Mutex            // 保护conn、cancel和连接状态
+	status        registry.ReverseState // 连接状态,同步到registry供get_status和webui展示
+	reconnecting  int32                 // 是否有重连循环在运行
+	closed        int32                 // 是否已经关闭
+	replaying     int32                 // 是否正在补发outbox中的事件
+	writeCh       chan writeRequest     // 写请求通道
+	closeCh       chan struct{}         // 用于关闭的通道
+	onebotVersion int                   // 连接使用的onebot版本 11或12
+	role          string                // 连接的X-Client-Role Universal API Event
 }
 
+// 反向ws连接的角色,与go-cqhttp的X-Client-Role一致
+const (
+	RoleUniversal = "Universal"
+	RoleAPI       = "API"
+	RoleEvent     = "Event"
+)
+
+var (
+	errNotConnected = errors.New("websocket is not connected")
+	errClosed       = errors.New("websocket client closed")
+)
+
 type writeRequest struct {
 	messageType int
 	data        []byte
+	postType    string     // 事件的post_type,发送失败时据此决定是否进入补发队列
+	result      chan error // 不为nil时返回写操作的结果,用于补发
 }
 
 // SendMessage 发送消息，将写请求发送到写 Goroutine
 func (client *WebSocketClient) SendMessage(message map[string]interface{}) error {
+	postType, _ := message["post_type"].(string)
+	// API连接只用于调用api,不接收事件
+	if postType != "" && !client.AcceptsEvents() {
+		return nil
+	}
+	// onebotv12连接需要将v11事件转换为v12事件,action响应已由onebotv12.Client转换
+	if client.onebotVersion == 12 && onebotv12.IsEvent(message) {
+		message = onebotv12.ConvertEvent(message)
+	}
 	// 序列化消息
 	msgBytes, err := json.Marshal(message)
 	if err != nil {
@@ -44,10 +80,16 @@ func (client *WebSocketClient) SendMessage(message map[string]interface{}) error
 		return err
 	}
 
+	// 应用端断开,或者还有未补发的事件时,事件直接进入补发队列以保证顺序
+	if client.queueEvent(postType, msgBytes) {
+		return nil
+	}
+
 	// 创建专用通道，用于接收写操作的结果
 	client.writeCh <- writeRequest{
 		messageType: websocket.TextMessage,
 		data:        msgBytes,
+		postType:    postType,
 	}
 
 	// 等待写操作完成，并返回结果
@@ -56,23 +98,90 @@ func (client *WebSocketClient) SendMessage(message map[string]interface{}) error
 
 // Close 关闭 WebSocketClient，停止写 Goroutine
 func (client *WebSocketClient) Close() error {
+	if !atomic.CompareAndSwapInt32(&client.closed, 0, 1) {
+		return nil
+	}
+	client.updateStatus(func(status *registry.ReverseState) {
+		status.State = registry.StateClosed
+	})
 	close(client.closeCh)
 	close(client.writeCh)
-	client.conn.Close()
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.cancel != nil {
+		client.cancel()
+	}
+	if client.conn != nil {
+		client.conn.Close()
+	}
 	return nil
 }
 
+// BackendName 反向ws以其地址作为应用端名称
+func (client *WebSocketClient) BackendName() string {
+	return client.urlStr
+}
+
+// Connected 连接是否可用,断线重连期间返回false
+func (client *WebSocketClient) Connected() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.status.State == registry.StateConnected
+}
+
+// QueueDepth 写通道和补发队列中尚未发出的消息数,供负载均衡池的least_inflight策略使用
+func (client *WebSocketClient) QueueDepth() int {
+	return len(client.writeCh) + outbox.Pending(client.urlStr)
+}
+
+// updateStatus 修改连接状态并同步到registry
+func (client *WebSocketClient) updateStatus(update func(status *registry.ReverseState)) {
+	client.mu.Lock()
+	update(&client.status)
+	status := client.status
+	client.mu.Unlock()
+	registry.SetReverse(status)
+}
+
+// AcceptsEvents 是否向该连接上报事件,API连接只返回action的响应
+func (client *WebSocketClient) AcceptsEvents() bool {
+	return client.role != RoleAPI
+}
+
+// EventFilter 返回该连接对应ws_address的事件过滤规则
+func (client *WebSocketClient) EventFilter() string {
+	for index, address := range config.GetWsAddress() {
+		if address == client.urlStr {
+			return config.GetWsFilter(index)
+		}
+	}
+	return ""
+}
+
 // startWriter 专用的写 Goroutine
 func (client *WebSocketClient) startWriter() {
 	for {
 		select {
 		case req := <-client.writeCh:
 			// 执行写操作
-			err := client.conn.WriteMessage(req.messageType, req.data)
+			client.mu.Lock()
+			conn := client.conn
+			client.mu.Unlock()
+			err := errNotConnected
+			if conn != nil {
+				err = conn.WriteMessage(req.messageType, req.data)
+			}
+			if req.result != nil {
+				req.result <- err
+				continue
+			}
 			if err != nil {
 				log.Println("Error sending message:", err)
-				if !config.GetDisableErrorChan() {
-					client.sendFailures = append(client.sendFailures, map[string]interface{}{"message": req.data}) // 记录失败的消息
+				if persistable(req.postType) {
+					// 记录失败的消息
+					if err := outbox.Push(client.urlStr, req.postType, req.data); err != nil {
+						mylog.Printf("储存补发事件失败: %v", err)
+					}
 				}
 			}
 		case <-client.closeCh:
@@ -82,13 +191,18 @@ func (client *WebSocketClient) startWriter() {
 }
 
 // 处理onebotv11应用端发来的信息
-func (client *WebSocketClient) handleIncomingMessages(cancel context.CancelFunc) {
+func (client *WebSocketClient) handleIncomingMessages(conn *websocket.Conn, cancel context.CancelFunc) {
 	for {
-		_, msg, err := client.conn.ReadMessage()
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
 			mylog.Println("WebSocket connection closed:", err)
 			cancel() // 取消心跳 goroutine
-			if !client.isReconnecting {
+			if atomic.LoadInt32(&client.closed) == 0 {
+				botstats.RecordWsDisconnect()
+				client.updateStatus(func(status *registry.ReverseState) {
+					status.State = registry.StateReconnecting
+					status.DisconnectedAt = time.Now().Unix()
+				})
 				go client.Reconnect()
 			}
 			return // 退出循环，不再尝试读取消息
@@ -98,67 +212,130 @@ func (client *WebSocketClient) handleIncomingMessages(cancel context.CancelFunc)
 	}
 }
 
-// 断线重连
+// 断线重连,超过reconnect_times后放弃,并按reconnect_redial_interval在后台定时重新尝试
 func (client *WebSocketClient) Reconnect() {
-	client.isReconnecting = true
-
-	addresses := config.GetWsAddress()
-	tokens := config.GetWsToken()
-
-	var token string
-	for index, address := range addresses {
-		if address == client.urlStr && index < len(tokens) {
-			token = tokens[index]
-			break
-		}
+	// 同一时间只有一个重连循环
+	if !atomic.CompareAndSwapInt32(&client.reconnecting, 0, 1) {
+		return
 	}
+	defer atomic.StoreInt32(&client.reconnecting, 0)
 
-	// 检查URL中是否有access_token参数
-	mp := getParamsFromURI(client.urlStr)
-	if val, ok := mp["access_token"]; ok {
-		token = val
+	client.updateStatus(func(status *registry.ReverseState) {
+		status.State = registry.StateReconnecting
+		status.Attempts = 0
+	})
+	conn, err := client.dial(config.GetReconnecTimes())
+	if err != nil {
+		client.giveUp(err)
+		return
 	}
+	client.onConnected(conn)
 
-	headers := http.Header{
-		"User-Agent":    []string{"CQHttp/4.15.0"},
-		"X-Client-Role": []string{"Universal"},
-		"X-Self-ID":     []string{fmt.Sprintf("%d", client.botID)},
-	}
+	mylog.Printf("Successfully reconnected to WebSocket.")
+}
 
-	if token != "" {
-		headers["Authorization"] = []string{"Token " + token}
-	}
-	mylog.Printf("准备使用token[%s]重新连接到[%s]\n", token, client.urlStr)
+// dial 按指数退避连接应用端,maxRetryAttempts为-1时无限重试
+func (client *WebSocketClient) dial(maxRetryAttempts int) (*websocket.Conn, error) {
+	token := tokenFor(client.urlStr)
+	headers := buildHeaders(token, client.botID, client.onebotVersion, client.role)
+	mylog.Printf("准备使用token[%s]以onebotv%d(%s)连接到[%s]\n", token, client.onebotVersion, client.role, client.urlStr)
 	dialer := websocket.Dialer{
 		Proxy:            http.ProxyFromEnvironment,
 		HandshakeTimeout: 45 * time.Second,
 	}
 
-	var conn *websocket.Conn
-	var err error
-
-	maxRetryAttempts := config.GetReconnecTimes()
 	retryCount := 0
 	for {
 		mylog.Println("Dialing URL:", client.urlStr)
-		conn, _, err = dialer.Dial(client.urlStr, headers)
-		if err != nil {
-			retryCount++
-			if retryCount > maxRetryAttempts {
-				mylog.Printf("Exceeded maximum retry attempts for WebSocket[%v]: %v\n", client.urlStr, err)
-				return
-			}
-			mylog.Printf("Failed to connect to WebSocket[%v]: %v, retrying in 5 seconds...\n", client.urlStr, err)
-			time.Sleep(5 * time.Second) // sleep for 5 seconds before retrying
-		} else {
+		conn, _, err := dialer.Dial(client.urlStr, headers)
+		if err == nil {
 			mylog.Printf("Successfully connected to %s.\n", client.urlStr) // 输出连接成功提示
-			break                                                          // successfully connected, break the loop
+			return conn, nil
+		}
+		retryCount++
+		if maxRetryAttempts >= 0 && retryCount > maxRetryAttempts {
+			mylog.Printf("Exceeded maximum retry attempts for WebSocket[%v]: %v\n", client.urlStr, err)
+			return nil, err
+		}
+		delay := backoff(retryCount)
+		client.updateStatus(func(status *registry.ReverseState) {
+			status.Attempts = retryCount
+			status.LastError = err.Error()
+			status.NextRetry = time.Now().Add(delay).Unix()
+		})
+		mylog.Printf("Failed to connect to WebSocket[%v]: %v, retrying in %v...\n", client.urlStr, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-client.closeCh:
+			return nil, errClosed
+		}
+	}
+}
+
+// backoff 第attempt次失败后的等待时间,从reconnect_interval_min开始翻倍,不超过reconnect_interval_max,
+// 并在后一半区间内随机抖动,避免多个实例同时重连
+func backoff(attempt int) time.Duration {
+	min := time.Duration(config.GetReconnectIntervalMin()) * time.Second
+	max := time.Duration(config.GetReconnectIntervalMax()) * time.Second
+	delay := min
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// giveUp 放弃本轮重连,之后每隔reconnect_redial_interval秒在后台重新尝试一轮
+func (client *WebSocketClient) giveUp(err error) {
+	if atomic.LoadInt32(&client.closed) == 1 {
+		return
+	}
+	redial := config.GetReconnectRedial()
+	client.updateStatus(func(status *registry.ReverseState) {
+		status.State = registry.StateGaveUp
+		status.LastError = err.Error()
+		status.NextRetry = 0
+		if redial > 0 {
+			status.NextRetry = time.Now().Add(time.Duration(redial) * time.Second).Unix()
+		}
+	})
+	if redial <= 0 {
+		mylog.Printf("反向ws[%s]已放弃重连,事件将储存在补发队列中", client.urlStr)
+		return
+	}
+	mylog.Printf("反向ws[%s]已放弃重连,将在%d秒后重新尝试", client.urlStr, redial)
+	go func() {
+		select {
+		case <-time.After(time.Duration(redial) * time.Second):
+			client.Reconnect()
+		case <-client.closeCh:
 		}
+	}()
+}
+
+// onConnected 连接成功后发送生命周期元事件,启动心跳和读取,并补发断开期间的事件
+func (client *WebSocketClient) onConnected(conn *websocket.Conn) {
+	// 启动心跳和读取的goroutine,退出老的sendHeartbeat和handleIncomingMessages
+	ctx, cancel := context.WithCancel(context.Background())
+	client.mu.Lock()
+	if client.cancel != nil {
+		client.cancel()
 	}
-	// 复用现有的client完成重连
 	client.conn = conn
+	client.cancel = cancel
+	client.mu.Unlock()
+
+	client.updateStatus(func(status *registry.ReverseState) {
+		status.State = registry.StateConnected
+		status.Attempts = 0
+		status.NextRetry = 0
+		status.ConnectedAt = time.Now().Unix()
+	})
 
-	// 再次发送元事件
+	// 发送连接成功的元事件
 	message := map[string]interface{}{
 		"meta_event_type": "lifecycle",
 		"post_type":       "meta_event",
@@ -169,46 +346,88 @@ func (client *WebSocketClient) Reconnect() {
 
 	mylog.Printf("Message: %+v\n", message)
 
-	err = client.SendMessage(message)
+	err := client.SendMessage(message)
 	if err != nil {
 		// handle error
 		mylog.Printf("Error sending message: %v\n", err)
 	}
 
-	//退出老的sendHeartbeat和handleIncomingMessages
-	client.cancel()
-
-	// Starting goroutine for heartbeats and another for listening to messages
-	ctx, cancel := context.WithCancel(context.Background())
-
-	client.cancel = cancel
 	heartbeatinterval := config.GetHeartBeatInterval()
 	go client.sendHeartbeat(ctx, client.botID, heartbeatinterval)
-	go client.handleIncomingMessages(cancel)
+	go client.handleIncomingMessages(conn, cancel)
 
-	defer func() {
-		client.isReconnecting = false
-	}()
+	// 补发断开期间以及重启前未发送的事件
+	go client.processFailedMessages()
+}
 
-	mylog.Printf("Successfully reconnected to WebSocket.")
+// persistable 判断发送失败的信息是否需要补发,心跳等元事件和action响应不补发
+func persistable(postType string) bool {
+	return postType != "" && postType != "meta_event" && !config.GetDisableErrorChan()
+}
 
+// queueEvent 应用端断开或补发队列非空时将事件放入补发队列,返回是否已放入
+func (client *WebSocketClient) queueEvent(postType string, data []byte) bool {
+	if !persistable(postType) {
+		return false
+	}
+	reconnecting := !client.Connected()
+	if !reconnecting && outbox.Pending(client.urlStr) == 0 {
+		return false
+	}
+	if err := outbox.Push(client.urlStr, postType, data); err != nil {
+		mylog.Printf("储存补发事件失败: %v", err)
+		return false
+	}
+	if !reconnecting {
+		go client.processFailedMessages()
+	}
+	return true
 }
 
-// 处理发送失败的消息
+// 处理发送失败的消息,按顺序补发outbox中的事件
 func (client *WebSocketClient) processFailedMessages() {
-	for _, failedMessage := range client.sendFailures {
-		// 尝试重新发送消息
-		err := client.SendMessage(failedMessage)
-		if err != nil {
-			mylog.Printf("Error resending message: %v\n", err)
+	if !client.Connected() || outbox.Pending(client.urlStr) == 0 {
+		return
+	}
+	// 同一时间只有一个补发
+	if !atomic.CompareAndSwapInt32(&client.replaying, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&client.replaying, 0)
+
+	sent, err := outbox.Replay(client.urlStr, func(data []byte) error {
+		result := make(chan error, 1)
+		client.writeCh <- writeRequest{
+			messageType: websocket.TextMessage,
+			data:        data,
+			result:      result,
+		}
+		select {
+		case err := <-result:
+			return err
+		case <-client.closeCh:
+			return errClosed
 		}
+	})
+	if sent > 0 {
+		mylog.Printf("已向[%s]补发%d条事件", client.urlStr, sent)
+	}
+	if err != nil {
+		mylog.Printf("Error resending message: %v\n", err)
 	}
-	// 清空失败消息列表
-	client.sendFailures = []map[string]interface{}{}
 }
 
 // 处理信息,调用腾讯api
 func (client *WebSocketClient) recvMessage(msg []byte) {
+	// Event连接只上报事件,不接受action
+	if client.role == RoleEvent {
+		mylog.Printf("Event连接[%s]不接受action,已忽略: %s", client.urlStr, string(msg))
+		return
+	}
+	if client.onebotVersion == 12 {
+		client.recvMessageV12(msg)
+		return
+	}
 	var message callapi.ActionMessage
 	//mylog.Println("Received from onebotv11 server raw:", string(msg))
 	err := json.Unmarshal(msg, &message)
@@ -221,6 +440,51 @@ func (client *WebSocketClient) recvMessage(msg []byte) {
 	go callapi.CallAPIFromDict(client, client.api, client.apiv2, message)
 }
 
+// 处理onebotv12应用端发来的action,转换为v11后复用现有handler
+func (client *WebSocketClient) recvMessageV12(msg []byte) {
+	message, action, err := onebotv12.ParseAction(msg)
+	if err != nil {
+		mylog.Printf("Error unmarshalling onebotv12 message: %v, Original message: %s", err, string(msg))
+		return
+	}
+	mylog.Println("Received from onebotv12 server:", TruncateMessage(message, 800))
+	if action == onebotv12.ActionGetSupportedActions {
+		client.SendMessage(onebotv12.SupportedActionsResponse(message.Echo))
+		return
+	}
+	if !callapi.HasHandler(message.Action) {
+		client.SendMessage(onebotv12.UnsupportedActionResponse(action, message.Echo))
+		return
+	}
+	// 调用callapi,响应由onebotv12.Client转换为v12格式
+	go callapi.CallAPIFromDict(onebotv12.NewClient(client, action), client.api, client.apiv2, message)
+}
+
+// buildHeaders 构造反向ws连接的请求头,onebotv12使用Bearer鉴权和子协议
+func buildHeaders(token string, botID uint64, onebotVersion int, role string) http.Header {
+	if onebotVersion == 12 {
+		headers := http.Header{
+			"User-Agent":             []string{"OneBot/12 (qq) Gensokyo/" + onebotv12.Version},
+			"Sec-WebSocket-Protocol": []string{"12." + onebotv12.Impl},
+		}
+		if token != "" {
+			headers["Authorization"] = []string{"Bearer " + token}
+		}
+		return headers
+	}
+
+	headers := http.Header{
+		"User-Agent":    []string{"CQHttp/4.15.0"},
+		"X-Client-Role": []string{role},
+		"X-Self-ID":     []string{fmt.Sprintf("%d", botID)},
+	}
+
+	if token != "" {
+		headers["Authorization"] = []string{"Token " + token}
+	}
+	return headers
+}
+
 // 截断信息
 func TruncateMessage(message callapi.ActionMessage, maxLength int) string {
 	paramsStr, err := json.Marshal(message.Params)
@@ -244,35 +508,7 @@ func (client *WebSocketClient) sendHeartbeat(ctx context.Context, botID uint64,
 		case <-ctx.Done():
 			return
 		case <-time.After(time.Duration(heartbeatinterval) * time.Second):
-			messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
-			if err != nil {
-				mylog.Printf("心跳错误,获取机器人发信状态错误:%v", err)
-			}
-			message := map[string]interface{}{
-				"post_type":       "meta_event",
-				"meta_event_type": "heartbeat",
-				"time":            int(time.Now().Unix()),
-				"self_id":         botID,
-				"status": map[string]interface{}{
-					"app_enabled":     true,
-					"app_good":        true,
-					"app_initialized": true,
-					"good":            true,
-					"online":          true,
-					"plugins_good":    nil,
-					"stat": map[string]int{
-						"packet_received":   34933,
-						"packet_sent":       8513,
-						"packet_lost":       0,
-						"message_received":  messageReceived,
-						"message_sent":      messageSent,
-						"disconnect_times":  0,
-						"lost_times":        0,
-						"last_message_time": int(lastMessageTime),
-					},
-				},
-				"interval": 5000, // 以毫秒为单位
-			}
+			message := handlers.HeartbeatEvent(botID, heartbeatinterval)
 			client.SendMessage(message)
 			// 重发失败的消息
 			client.processFailedMessages()
@@ -281,97 +517,73 @@ func (client *WebSocketClient) sendHeartbeat(ctx context.Context, botID uint64,
 }
 
 // NewWebSocketClient 创建 WebSocketClient 实例，接受 WebSocket URL、botID 和 openapi.OpenAPI 实例
+// 连接失败时同样返回client,client会按reconnect_redial_interval在后台继续尝试连接,期间的事件进入补发队列
 func NewWebSocketClient(urlStr string, botID uint64, api openapi.OpenAPI, apiv2 openapi.OpenAPI, maxRetryAttempts int) (*WebSocketClient, error) {
-	addresses := config.GetWsAddress()
-	tokens := config.GetWsToken()
-
-	var token string
-	for index, address := range addresses {
-		if address == urlStr && index < len(tokens) {
-			token = tokens[index]
+	var onebotVersion int
+	var role string
+	for index, address := range config.GetWsAddress() {
+		if address == urlStr {
+			onebotVersion = config.GetWsOnebotVersion(index)
+			role = config.GetWsRole(index)
 			break
 		}
 	}
-
-	// 检查URL中是否有access_token参数
-	mp := getParamsFromURI(urlStr)
-	if val, ok := mp["access_token"]; ok {
-		token = val
-	}
-
-	headers := http.Header{
-		"User-Agent":    []string{"CQHttp/4.15.0"},
-		"X-Client-Role": []string{"Universal"},
-		"X-Self-ID":     []string{fmt.Sprintf("%d", botID)},
+	if onebotVersion == 0 {
+		onebotVersion = 11
 	}
 
-	if token != "" {
-		headers["Authorization"] = []string{"Token " + token}
-	}
-	mylog.Printf("准备使用token[%s]连接到[%s]\n", token, urlStr)
-	dialer := websocket.Dialer{
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 45 * time.Second,
+	if role == "" {
+		role = RoleUniversal
 	}
 
-	var conn *websocket.Conn
-	var err error
-
-	retryCount := 0
-	for {
-		mylog.Println("Dialing URL:", urlStr)
-		conn, _, err = dialer.Dial(urlStr, headers)
-		if err != nil {
-			retryCount++
-			if retryCount > maxRetryAttempts {
-				mylog.Printf("Exceeded maximum retry attempts for WebSocket[%v]: %v\n", urlStr, err)
-				return nil, err
-			}
-			mylog.Printf("Failed to connect to WebSocket[%v]: %v, retrying in 5 seconds...\n", urlStr, err)
-			time.Sleep(5 * time.Second) // sleep for 5 seconds before retrying
-		} else {
-			mylog.Printf("Successfully connected to %s.\n", urlStr) // 输出连接成功提示
-			break                                                   // successfully connected, break the loop
-		}
-	}
 	client := &WebSocketClient{
-		conn:         conn,
-		api:          api,
-		apiv2:        apiv2,
-		botID:        botID,
-		urlStr:       urlStr,
-		sendFailures: []map[string]interface{}{},
-		writeCh:      make(chan writeRequest, 5000), // 缓冲区大小可以根据需求调整
-		closeCh:      make(chan struct{}),
+		api:           api,
+		apiv2:         apiv2,
+		botID:         botID,
+		urlStr:        urlStr,
+		writeCh:       make(chan writeRequest, 5000), // 缓冲区大小可以根据需求调整
+		closeCh:       make(chan struct{}),
+		onebotVersion: onebotVersion,
+		role:          role,
+		status: registry.ReverseState{
+			Address: urlStr,
+			State:   registry.StateConnecting,
+		},
 	}
+	registry.SetReverse(client.status)
 	go client.startWriter() // 启动写 Goroutine
 
-	// Sending initial message similar to your setupB function
-	message := map[string]interface{}{
-		"meta_event_type": "lifecycle",
-		"post_type":       "meta_event",
-		"self_id":         botID,
-		"sub_type":        "connect",
-		"time":            int(time.Now().Unix()),
-	}
-
-	mylog.Printf("Message: %+v\n", message)
-
-	err = client.SendMessage(message)
+	atomic.StoreInt32(&client.reconnecting, 1)
+	defer atomic.StoreInt32(&client.reconnecting, 0)
+	conn, err := client.dial(maxRetryAttempts)
 	if err != nil {
-		// handle error
-		mylog.Printf("Error sending message: %v\n", err)
+		client.giveUp(err)
+		return client, err
 	}
+	client.onConnected(conn)
 
-	// Starting goroutine for heartbeats and another for listening to messages
-	ctx, cancel := context.WithCancel(context.Background())
+	return client, nil
+}
 
-	client.cancel = cancel
-	heartbeatinterval := config.GetHeartBeatInterval()
-	go client.sendHeartbeat(ctx, botID, heartbeatinterval)
-	go client.handleIncomingMessages(cancel)
+// tokenFor 获取反向ws地址对应的token,地址中的access_token参数优先
+func tokenFor(urlStr string) string {
+	addresses := config.GetWsAddress()
+	tokens := config.GetWsToken()
 
-	return client, nil
+	var token string
+	for index, address := range addresses {
+		if address == urlStr && index < len(tokens) {
+			token = tokens[index]
+			break
+		}
+	}
+
+	// 检查URL中是否有access_token参数
+	mp := getParamsFromURI(urlStr)
+	if val, ok := mp["access_token"]; ok {
+		token = val
+	}
+	return token
 }
 
 // getParamsFromURI 解析给定URI中的查询参数，并返回一个映射（map）